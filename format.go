@@ -0,0 +1,64 @@
+package jwx
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// IsEncrypted returns true if the token looks like a JWE message, in
+// either compact or JSON serialization. Only the structure of the token
+// is inspected: it is not parsed nor decrypted.
+func IsEncrypted(token []byte) bool {
+	token = bytes.TrimSpace(token)
+	if len(token) == 0 {
+		return false
+	}
+
+	if token[0] == '{' {
+		members, ok := jsonMembers(token)
+		if !ok {
+			return false
+		}
+		_, ok = members["ciphertext"]
+		return ok
+	}
+
+	// JWE compact serialization has five segments
+	return bytes.Count(token, []byte{'.'}) == 4
+}
+
+// IsSigned returns true if the token looks like a JWS message, in
+// either compact or JSON serialization. Only the structure of the token
+// is inspected: it is not parsed nor verified.
+func IsSigned(token []byte) bool {
+	token = bytes.TrimSpace(token)
+	if len(token) == 0 {
+		return false
+	}
+
+	if token[0] == '{' {
+		members, ok := jsonMembers(token)
+		if !ok {
+			return false
+		}
+		if _, ok := members["ciphertext"]; ok {
+			return false
+		}
+		_, signature := members["signature"]
+		_, signatures := members["signatures"]
+		return signature || signatures
+	}
+
+	// JWS compact serialization has three segments
+	return bytes.Count(token, []byte{'.'}) == 2
+}
+
+// jsonMembers returns the top level members of the JSON object. The
+// values are left undecoded.
+func jsonMembers(buf []byte) (map[string]json.RawMessage, bool) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &members); err != nil {
+		return nil, false
+	}
+	return members, true
+}
@@ -1,8 +1,11 @@
 package base64
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/binary"
+
+	"github.com/pkg/errors"
 )
 
 func EncodeToString(src []byte) string {
@@ -26,3 +29,50 @@ func EncodeUint64ToString(v uint64) string {
 func DecodeString(src string) ([]byte, error) {
 	return base64.RawURLEncoding.DecodeString(src)
 }
+
+// DecodeSegments splits a compact serialization into its `n`
+// period-separated segments, and returns each of them base64url decoded.
+// Every decoded segment is exactly as long as the data it encodes, and
+// empty segments decode to empty slices
+func DecodeSegments(compact []byte, n int) ([][]byte, error) {
+	parts := bytes.Split(compact, []byte{'.'})
+	if len(parts) != n {
+		return nil, errors.Errorf(`expected %d segments, got %d`, n, len(parts))
+	}
+
+	enc := base64.RawURLEncoding
+	segments := make([][]byte, n)
+	for i, part := range parts {
+		out := make([]byte, enc.DecodedLen(len(part)))
+		l, err := enc.Decode(out, part)
+		if err != nil {
+			return nil, errors.Wrapf(err, `failed to decode segment #%d`, i+1)
+		}
+		segments[i] = out[:l]
+	}
+	return segments, nil
+}
+
+// ErrNonCanonical is returned when a base64url value decodes
+// successfully, but is not the canonical encoding of the decoded data
+var ErrNonCanonical = errors.New(`non-canonical base64url encoding`)
+
+// CheckCanonical checks that src is the canonical unpadded base64url
+// encoding of the data it decodes to. Values whose final character has
+// non-zero unused bits, or that contain line breaks (which the decoder
+// otherwise skips), are rejected with ErrNonCanonical
+func CheckCanonical(src []byte) error {
+	enc := base64.RawURLEncoding
+	out := make([]byte, enc.DecodedLen(len(src)))
+	n, err := enc.Decode(out, src)
+	if err != nil {
+		return errors.Wrap(err, `failed to decode from base64`)
+	}
+
+	canonical := make([]byte, enc.EncodedLen(n))
+	enc.Encode(canonical, out[:n])
+	if !bytes.Equal(canonical, src) {
+		return ErrNonCanonical
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+// Package envelope extracts JOSE messages that are embedded as a string
+// in a field of a JSON object, such as {"token":"eyJ..."}
+package envelope
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// Field returns the string value of the named field of the JSON object
+// in data
+func Field(data []byte, field string) (string, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return "", errors.Wrap(err, `failed to unmarshal envelope`)
+	}
+
+	raw, ok := envelope[field]
+	if !ok {
+		return "", errors.Errorf(`missing field %q in envelope`, field)
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", errors.Errorf(`field %q in envelope must be a string`, field)
+	}
+	return s, nil
+}
@@ -0,0 +1,16 @@
+// Package httpclient holds the HTTP client that is used to fetch remote
+// resources, such as JWK sets and X.509 certificate chains, when the
+// user does not specify one
+package httpclient
+
+import (
+	"net/http"
+	"time"
+)
+
+// DefaultTimeout is the timeout of the Default client
+const DefaultTimeout = 30 * time.Second
+
+// Default is the HTTP client used when none is specified. It is shared
+// by all packages, and must not be modified
+var Default = &http.Client{Timeout: DefaultTimeout}
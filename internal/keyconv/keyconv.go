@@ -0,0 +1,85 @@
+// Package keyconv normalizes the standard library key types, so that
+// callers may pass keys either as values or as pointers.
+package keyconv
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"reflect"
+)
+
+// RSAPrivateKey returns key as a *rsa.PrivateKey. Both rsa.PrivateKey
+// and *rsa.PrivateKey are accepted. The second return value is false if
+// key is of any other type, or is a nil pointer.
+func RSAPrivateKey(key interface{}) (*rsa.PrivateKey, bool) {
+	switch v := key.(type) {
+	case *rsa.PrivateKey:
+		return v, v != nil
+	case rsa.PrivateKey:
+		return &v, true
+	}
+	return nil, false
+}
+
+// RSAPublicKey returns key as a *rsa.PublicKey. Both rsa.PublicKey
+// and *rsa.PublicKey are accepted.
+func RSAPublicKey(key interface{}) (*rsa.PublicKey, bool) {
+	switch v := key.(type) {
+	case *rsa.PublicKey:
+		return v, v != nil
+	case rsa.PublicKey:
+		return &v, true
+	}
+	return nil, false
+}
+
+// ECDSAPrivateKey returns key as a *ecdsa.PrivateKey. Both
+// ecdsa.PrivateKey and *ecdsa.PrivateKey are accepted.
+func ECDSAPrivateKey(key interface{}) (*ecdsa.PrivateKey, bool) {
+	switch v := key.(type) {
+	case *ecdsa.PrivateKey:
+		return v, v != nil
+	case ecdsa.PrivateKey:
+		return &v, true
+	}
+	return nil, false
+}
+
+// ECDSAPublicKey returns key as a *ecdsa.PublicKey. Both
+// ecdsa.PublicKey and *ecdsa.PublicKey are accepted.
+func ECDSAPublicKey(key interface{}) (*ecdsa.PublicKey, bool) {
+	switch v := key.(type) {
+	case *ecdsa.PublicKey:
+		return v, v != nil
+	case ecdsa.PublicKey:
+		return &v, true
+	}
+	return nil, false
+}
+
+// PublicKey returns the public half of RSA and ECDSA private keys.
+// Any other key is returned as is.
+func PublicKey(key interface{}) interface{} {
+	if v, ok := RSAPrivateKey(key); ok {
+		return &v.PublicKey
+	}
+	if v, ok := ECDSAPrivateKey(key); ok {
+		return &v.PublicKey
+	}
+	return key
+}
+
+// IsNil returns true if key is nil, or is an interface holding a nil
+// pointer, slice or map. Such keys would otherwise cause a panic deep
+// inside the crypto code.
+func IsNil(key interface{}) bool {
+	if key == nil {
+		return true
+	}
+
+	switch rv := reflect.ValueOf(key); rv.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+// Package pbkdf2 implements PBKDF2 as described in
+// https://tools.ietf.org/html/rfc8018#section-5.2
+package pbkdf2
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"encoding/binary"
+)
+
+// Key derives a key of keyLen bytes from the password and the salt,
+// using HMAC with the given hash as the pseudorandom function.
+func Key(hash crypto.Hash, password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(hash.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var counter [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		// U_1 = PRF(P, S || INT(i))
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Write(counter[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		// U_n = PRF(P, U_{n-1}), T = U_1 ^ U_2 ^ ... ^ U_c
+		for n := 2; n <= iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
@@ -0,0 +1,43 @@
+package pbkdf2
+
+import (
+	"crypto"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKey(t *testing.T) {
+	testcases := []struct {
+		Hash       crypto.Hash
+		Password   string
+		Salt       string
+		Iterations int
+		Expected   string
+	}{
+		// https://tools.ietf.org/html/rfc6070
+		{crypto.SHA1, "password", "salt", 1, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{crypto.SHA1, "password", "salt", 2, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{crypto.SHA1, "password", "salt", 4096, "4b007901b765489abead49d926f721d065a429c1"},
+		{crypto.SHA1, "passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, "3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038"},
+		{crypto.SHA1, "pass\x00word", "sa\x00lt", 4096, "56fa6aa75548099dcc37d7f03425e0c3"},
+		// https://stackoverflow.com/questions/5130513/pbkdf2-hmac-sha2-test-vectors
+		{crypto.SHA256, "password", "salt", 1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{crypto.SHA256, "password", "salt", 4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+
+	for _, tc := range testcases {
+		expected, err := hex.DecodeString(tc.Expected)
+		if !assert.NoError(t, err, "hex decode should succeed") {
+			return
+		}
+
+		key := Key(tc.Hash, []byte(tc.Password), []byte(tc.Salt), tc.Iterations, len(expected))
+		if !assert.Equal(t, expected, key, "derived key should match") {
+			return
+		}
+	}
+}
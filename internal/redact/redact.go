@@ -0,0 +1,68 @@
+// Package redact masks secret key parameters, so that keys and
+// headers can be safely formatted for logging
+package redact
+
+import (
+	"encoding/json"
+)
+
+// Value is the value that secret parameters are replaced with
+const Value = `REDACTED`
+
+// secrets are the names of the private (or symmetric) parameters of a
+// JWK, as described in https://tools.ietf.org/html/rfc7518#section-6
+var secrets = map[string]struct{}{
+	`d`:   {},
+	`p`:   {},
+	`q`:   {},
+	`dp`:  {},
+	`dq`:  {},
+	`qi`:  {},
+	`oth`: {},
+	`k`:   {},
+}
+
+// Map replaces the values of secret parameters in m, as well as in any
+// JSON objects nested in m, with Value. m is modified in place
+func Map(m map[string]interface{}) {
+	for name, v := range m {
+		if _, ok := secrets[name]; ok {
+			m[name] = Value
+			continue
+		}
+		walk(v)
+	}
+}
+
+func walk(v interface{}) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		Map(x)
+	case []interface{}:
+		for _, e := range x {
+			walk(e)
+		}
+	}
+}
+
+// JSON parses the JSON object in buf, and returns it with the secret
+// parameters replaced with Value
+func JSON(buf []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return nil, err
+	}
+	Map(m)
+	return m, nil
+}
+
+// Format returns the string representation of a redacted map. If
+// prefix is not empty, it is prepended to the result, as is done for
+// fmt's "%#v" verb
+func Format(prefix string, m map[string]interface{}) string {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return prefix + `{}`
+	}
+	return prefix + string(buf)
+}
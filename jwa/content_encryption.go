@@ -3,6 +3,8 @@
 package jwa
 
 import (
+	"encoding/json"
+
 	"github.com/pkg/errors"
 )
 
@@ -31,6 +33,9 @@ func (v *ContentEncryptionAlgorithm) Accept(value interface{}) error {
 	default:
 		return errors.Errorf(`invalid type for jwa.ContentEncryptionAlgorithm: %T`, value)
 	}
+	if tmp == "" {
+		return errors.Wrap(ErrEmptyAlgorithm, `invalid jwa.ContentEncryptionAlgorithm value`)
+	}
 	switch tmp {
 	case A128CBC_HS256, A128GCM, A192CBC_HS384, A192GCM, A256CBC_HS512, A256GCM:
 	default:
@@ -41,6 +46,21 @@ func (v *ContentEncryptionAlgorithm) Accept(value interface{}) error {
 	return nil
 }
 
+// UnmarshalJSON rejects JSON values that are not strings, and the
+// empty string. Unknown values are kept as is, so that they may be
+// reported by the caller
+func (v *ContentEncryptionAlgorithm) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.Wrap(err, `invalid type for jwa.ContentEncryptionAlgorithm`)
+	}
+	if s == "" {
+		return errors.Wrap(ErrEmptyAlgorithm, `invalid jwa.ContentEncryptionAlgorithm value`)
+	}
+	*v = ContentEncryptionAlgorithm(s)
+	return nil
+}
+
 // String returns the string representation of a ContentEncryptionAlgorithm
 func (v ContentEncryptionAlgorithm) String() string {
 	return string(v)
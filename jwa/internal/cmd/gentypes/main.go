@@ -39,9 +39,10 @@ func _main() error {
 			},
 		},
 		{
-			name:     `ContentEncryptionAlgorithm`,
-			comment:  `ContentEncryptionAlgorithm represents the various encryption algorithms as described in https://tools.ietf.org/html/rfc7518#section-5`,
-			filename: `content_encryption.go`,
+			name:      `ContentEncryptionAlgorithm`,
+			comment:   `ContentEncryptionAlgorithm represents the various encryption algorithms as described in https://tools.ietf.org/html/rfc7518#section-5`,
+			filename:  `content_encryption.go`,
+			algorithm: true,
 			elements: []element{
 				{
 					name:    `A128CBC_HS256`,
@@ -123,9 +124,10 @@ func _main() error {
 			},
 		},
 		{
-			name:     `SignatureAlgorithm`,
-			comment:  `SignatureAlgorithm represents the various signature algorithms as described in https://tools.ietf.org/html/rfc7518#section-3.1`,
-			filename: `signature.go`,
+			name:      `SignatureAlgorithm`,
+			comment:   `SignatureAlgorithm represents the various signature algorithms as described in https://tools.ietf.org/html/rfc7518#section-3.1`,
+			filename:  `signature.go`,
+			algorithm: true,
 			elements: []element{
 				{
 					name:  `NoSignature`,
@@ -194,9 +196,10 @@ func _main() error {
 			},
 		},
 		{
-			name:     `KeyEncryptionAlgorithm`,
-			comment:  `KeyEncryptionAlgorithm represents the various encryption algorithms as described in https://tools.ietf.org/html/rfc7518#section-4.1`,
-			filename: `key_encryption.go`,
+			name:      `KeyEncryptionAlgorithm`,
+			comment:   `KeyEncryptionAlgorithm represents the various encryption algorithms as described in https://tools.ietf.org/html/rfc7518#section-4.1`,
+			filename:  `key_encryption.go`,
+			algorithm: true,
 			elements: []element{
 				{
 					name:    `RSA1_5`,
@@ -307,6 +310,9 @@ type typ struct {
 	comment  string
 	filename string
 	elements []element
+	// algorithm types reject the empty string with ErrEmptyAlgorithm,
+	// and validate values when unmarshaled from JSON
+	algorithm bool
 }
 
 type element struct {
@@ -322,7 +328,15 @@ func (t typ) Generate() error {
 	fmt.Fprintf(&buf, "// this file was auto-generated by internal/cmd/gentypes/main.go: DO NOT EDIT")
 	fmt.Fprintf(&buf, "\n\npackage jwa")
 	fmt.Fprintf(&buf, "\n\nimport (")
-	for _, pkg := range []string{"github.com/pkg/errors"} {
+	pkgs := []string{"github.com/pkg/errors"}
+	if t.algorithm {
+		pkgs = append([]string{"encoding/json", ""}, pkgs...)
+	}
+	for _, pkg := range pkgs {
+		if pkg == "" {
+			fmt.Fprintf(&buf, "\n")
+			continue
+		}
 		fmt.Fprintf(&buf, "\n%s", strconv.Quote(pkg))
 	}
 	fmt.Fprintf(&buf, "\n)")
@@ -351,6 +365,11 @@ func (t typ) Generate() error {
 	fmt.Fprintf(&buf, "\ndefault:")
 	fmt.Fprintf(&buf, "\nreturn errors.Errorf(`invalid type for jwa.%s: %%T`, value)", t.name)
 	fmt.Fprintf(&buf, "\n}")
+	if t.algorithm {
+		fmt.Fprintf(&buf, "\nif tmp == \"\" {")
+		fmt.Fprintf(&buf, "\nreturn errors.Wrap(ErrEmptyAlgorithm, `invalid jwa.%s value`)", t.name)
+		fmt.Fprintf(&buf, "\n}")
+	}
 
 	fmt.Fprintf(&buf, "\nswitch tmp {")
 	fmt.Fprintf(&buf, "\ncase ")
@@ -377,6 +396,23 @@ func (t typ) Generate() error {
 	fmt.Fprintf(&buf, "\nreturn nil")
 	fmt.Fprintf(&buf, "\n}") // func (v *%s) Accept(v interface{})
 
+	if t.algorithm {
+		fmt.Fprintf(&buf, "\n\n// UnmarshalJSON rejects JSON values that are not strings, and the")
+		fmt.Fprintf(&buf, "\n// empty string. Unknown values are kept as is, so that they may be")
+		fmt.Fprintf(&buf, "\n// reported by the caller")
+		fmt.Fprintf(&buf, "\nfunc (v *%s) UnmarshalJSON(data []byte) error {", t.name)
+		fmt.Fprintf(&buf, "\nvar s string")
+		fmt.Fprintf(&buf, "\nif err := json.Unmarshal(data, &s); err != nil {")
+		fmt.Fprintf(&buf, "\nreturn errors.Wrap(err, `invalid type for jwa.%s`)", t.name)
+		fmt.Fprintf(&buf, "\n}")
+		fmt.Fprintf(&buf, "\nif s == \"\" {")
+		fmt.Fprintf(&buf, "\nreturn errors.Wrap(ErrEmptyAlgorithm, `invalid jwa.%s value`)", t.name)
+		fmt.Fprintf(&buf, "\n}")
+		fmt.Fprintf(&buf, "\n*v = %s(s)", t.name)
+		fmt.Fprintf(&buf, "\nreturn nil")
+		fmt.Fprintf(&buf, "\n}")
+	}
+
 	fmt.Fprintf(&buf, "\n\n// String returns the string representation of a %s", t.name)
 	fmt.Fprintf(&buf, "\nfunc (v %s) String() string {", t.name)
 	fmt.Fprintf(&buf, "\nreturn string(v)")
@@ -3,6 +3,12 @@
 // Package jwa defines the various algorithm described in https://tools.ietf.org/html/rfc7518
 package jwa
 
+import "github.com/pkg/errors"
+
+// ErrEmptyAlgorithm is returned when an algorithm is specified, but
+// its value is the empty string
+var ErrEmptyAlgorithm = errors.New("empty algorithm")
+
 // Size returns the size of the EllipticCurveAlgorithm
 func (crv EllipticCurveAlgorithm) Size() int {
 	switch crv {
@@ -3,6 +3,8 @@
 package jwa
 
 import (
+	"encoding/json"
+
 	"github.com/pkg/errors"
 )
 
@@ -42,6 +44,9 @@ func (v *KeyEncryptionAlgorithm) Accept(value interface{}) error {
 	default:
 		return errors.Errorf(`invalid type for jwa.KeyEncryptionAlgorithm: %T`, value)
 	}
+	if tmp == "" {
+		return errors.Wrap(ErrEmptyAlgorithm, `invalid jwa.KeyEncryptionAlgorithm value`)
+	}
 	switch tmp {
 	case A128GCMKW, A128KW, A192GCMKW, A192KW, A256GCMKW, A256KW, DIRECT, ECDH_ES, ECDH_ES_A128KW, ECDH_ES_A192KW, ECDH_ES_A256KW, PBES2_HS256_A128KW, PBES2_HS384_A192KW, PBES2_HS512_A256KW, RSA1_5, RSA_OAEP, RSA_OAEP_256:
 	default:
@@ -52,6 +57,21 @@ func (v *KeyEncryptionAlgorithm) Accept(value interface{}) error {
 	return nil
 }
 
+// UnmarshalJSON rejects JSON values that are not strings, and the
+// empty string. Unknown values are kept as is, so that they may be
+// reported by the caller
+func (v *KeyEncryptionAlgorithm) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.Wrap(err, `invalid type for jwa.KeyEncryptionAlgorithm`)
+	}
+	if s == "" {
+		return errors.Wrap(ErrEmptyAlgorithm, `invalid jwa.KeyEncryptionAlgorithm value`)
+	}
+	*v = KeyEncryptionAlgorithm(s)
+	return nil
+}
+
 // String returns the string representation of a KeyEncryptionAlgorithm
 func (v KeyEncryptionAlgorithm) String() string {
 	return string(v)
@@ -3,6 +3,8 @@
 package jwa
 
 import (
+	"encoding/json"
+
 	"github.com/pkg/errors"
 )
 
@@ -38,6 +40,9 @@ func (v *SignatureAlgorithm) Accept(value interface{}) error {
 	default:
 		return errors.Errorf(`invalid type for jwa.SignatureAlgorithm: %T`, value)
 	}
+	if tmp == "" {
+		return errors.Wrap(ErrEmptyAlgorithm, `invalid jwa.SignatureAlgorithm value`)
+	}
 	switch tmp {
 	case ES256, ES384, ES512, HS256, HS384, HS512, NoSignature, PS256, PS384, PS512, RS256, RS384, RS512:
 	default:
@@ -48,6 +53,21 @@ func (v *SignatureAlgorithm) Accept(value interface{}) error {
 	return nil
 }
 
+// UnmarshalJSON rejects JSON values that are not strings, and the
+// empty string. Unknown values are kept as is, so that they may be
+// reported by the caller
+func (v *SignatureAlgorithm) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.Wrap(err, `invalid type for jwa.SignatureAlgorithm`)
+	}
+	if s == "" {
+		return errors.Wrap(ErrEmptyAlgorithm, `invalid jwa.SignatureAlgorithm value`)
+	}
+	*v = SignatureAlgorithm(s)
+	return nil
+}
+
 // String returns the string representation of a SignatureAlgorithm
 func (v SignatureAlgorithm) String() string {
 	return string(v)
@@ -0,0 +1,21 @@
+package jwa
+
+// TagSize returns the length in bytes of the authentication tag produced
+// by the content encryption algorithm. AES-GCM always uses 128 bit tags,
+// while for AES-CBC-HMAC the tag is the HMAC output truncated to half its
+// length (https://tools.ietf.org/html/rfc7518#section-5.2). Unknown
+// algorithms yield 0.
+func (v ContentEncryptionAlgorithm) TagSize() int {
+	switch v {
+	case A128GCM, A192GCM, A256GCM:
+		return 16
+	case A128CBC_HS256:
+		return 16
+	case A192CBC_HS384:
+		return 24
+	case A256CBC_HS512:
+		return 32
+	default:
+		return 0
+	}
+}
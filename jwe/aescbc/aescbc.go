@@ -17,8 +17,18 @@ import (
 
 const (
 	NonceSize = 16
+
+	// LegacyTagSize is the length of the authentication tag produced by
+	// earlier versions of this package, which truncated the tag to 16
+	// bytes regardless of the key size
+	LegacyTagSize = 16
 )
 
+// errDecrypt is returned for every failure after the ciphertext length
+// has been validated. Tag mismatches and padding errors are deliberately
+// indistinguishable, so that callers cannot be used as a padding oracle
+var errDecrypt = errors.New("failed to decrypt ciphertext")
+
 type AesCbcHmac struct {
 	blockCipher  cipher.Block
 	hash         func() hash.Hash
@@ -63,10 +73,27 @@ func New(key []byte, f BlockCipherFunc) (*AesCbcHmac, error) {
 		hash:         hfunc,
 		integrityKey: ikey,
 		keysize:      keysize,
-		tagsize:      NonceSize,
+		tagsize:      keysize, // T_LEN equals the MAC key length
 	}, nil
 }
 
+// NewLegacy creates an AesCbcHmac that uses LegacyTagSize byte
+// authentication tags. It only exists so that messages created by
+// earlier versions of this package can still be decrypted
+func NewLegacy(key []byte, f BlockCipherFunc) (*AesCbcHmac, error) {
+	c, err := New(key, f)
+	if err != nil {
+		return nil, err
+	}
+	c.tagsize = LegacyTagSize
+	return c, nil
+}
+
+// TagSize returns the length of the authentication tag
+func (c AesCbcHmac) TagSize() int {
+	return c.tagsize
+}
+
 // NonceSize fulfills the crypto.AEAD interface
 func (c AesCbcHmac) NonceSize() int {
 	return NonceSize
@@ -85,12 +112,7 @@ func (c AesCbcHmac) ComputeAuthTag(aad, nonce, ciphertext []byte) []byte {
 		debug.Printf("ComputeAuthTag: integrity  = %x (%d)\n", c.integrityKey, len(c.integrityKey))
 	}
 
-	buf := make([]byte, len(aad)+len(nonce)+len(ciphertext)+8)
-	n := 0
-	n += copy(buf, aad)
-	n += copy(buf[n:], nonce)
-	n += copy(buf[n:], ciphertext)
-	binary.BigEndian.PutUint64(buf[n:], uint64(len(aad)*8))
+	buf := macInput(aad, nonce, ciphertext)
 
 	h := hmac.New(c.hash, c.integrityKey)
 	h.Write(buf)
@@ -102,6 +124,26 @@ func (c AesCbcHmac) ComputeAuthTag(aad, nonce, ciphertext []byte) []byte {
 	return s[:c.tagsize]
 }
 
+// aadLength returns AL, the number of bits in the additional
+// authenticated data expressed as a 64-bit unsigned big-endian integer.
+// See https://tools.ietf.org/html/rfc7518#section-5.2.2.1
+func aadLength(aad []byte) []byte {
+	al := make([]byte, 8)
+	binary.BigEndian.PutUint64(al, uint64(len(aad))*8)
+	return al
+}
+
+// macInput returns the input to the HMAC that computes the
+// authentication tag, which is the concatenation of the additional
+// authenticated data, the IV, the ciphertext and AL, in that order
+func macInput(aad, iv, ciphertext []byte) []byte {
+	buf := make([]byte, 0, len(aad)+len(iv)+len(ciphertext)+8)
+	buf = append(buf, aad...)
+	buf = append(buf, iv...)
+	buf = append(buf, ciphertext...)
+	return append(buf, aadLength(aad)...)
+}
+
 func ensureSize(dst []byte, n int) []byte {
 	// if the dst buffer has enough length just copy the relevant parts to it.
 	// Otherwise create a new slice that's big enough, and operate on that
@@ -165,19 +207,42 @@ func (c AesCbcHmac) Open(dst, nonce, ciphertext, data []byte) ([]byte, error) {
 			debug.Printf("provided tag = %x\n", tag)
 			debug.Printf("expected tag = %x\n", expectedTag)
 		}
-		return nil, errors.New("invalid ciphertext (tag mismatch)")
+		return nil, errDecrypt
 	}
 
+	// The padding is only inspected after the tag has been verified
 	cbc := cipher.NewCBCDecrypter(c.blockCipher, nonce)
 	buf := make([]byte, tagOffset)
 	cbc.CryptBlocks(buf, ciphertext)
 
-	plaintext, err := padbuf.PadBuffer(buf).Unpad(c.blockCipher.BlockSize())
-	if err != nil {
-		return nil, errors.Wrap(err, `failed to generate plaintext from decrypted blocks`)
+	plaintext, ok := unpad(buf, c.blockCipher.BlockSize())
+	if !ok {
+		return nil, errDecrypt
 	}
 	ret := ensureSize(dst, len(plaintext))
 	out := ret[len(dst):]
 	copy(out, plaintext)
 	return ret, nil
 }
+
+// unpad removes the PKCS#7 padding from buf. The padding bytes are
+// checked without branching on their values
+func unpad(buf []byte, blockSize int) ([]byte, bool) {
+	n := len(buf)
+	if n == 0 || n%blockSize != 0 {
+		return nil, false
+	}
+
+	padlen := int(buf[n-1])
+	good := subtle.ConstantTimeLessOrEq(1, padlen) & subtle.ConstantTimeLessOrEq(padlen, blockSize)
+	for i := 1; i <= blockSize; i++ {
+		// every byte within the padding must be equal to padlen
+		inPadding := subtle.ConstantTimeLessOrEq(i, padlen)
+		matches := subtle.ConstantTimeByteEq(buf[n-i], byte(padlen))
+		good &= subtle.ConstantTimeSelect(inPadding, matches, 1)
+	}
+	if good != 1 {
+		return nil, false
+	}
+	return buf[:n-padlen], true
+}
@@ -2,6 +2,9 @@ package aescbc
 
 import (
 	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -58,3 +61,108 @@ func TestVectorsAESCBC128(t *testing.T) {
 		return
 	}
 }
+
+func TestOpen_TamperedCiphertext(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	nonce := make([]byte, NonceSize)
+	aad := []byte("aad")
+
+	enc, err := New(key, aes.NewCipher)
+	if !assert.NoError(t, err, "New should succeed") {
+		return
+	}
+
+	// Flipping a bit in the tag invalidates the MAC
+	sealed := enc.Seal(nil, nonce, []byte("Lorem ipsum"), aad)
+	sealed[len(sealed)-1] ^= 0x01
+	_, macErr := enc.Open(nil, nonce, sealed, aad)
+	if !assert.Error(t, macErr, "Open should fail for tampered tag") {
+		return
+	}
+
+	// A block that decrypts to invalid padding, with a valid MAC
+	ciphertext := make([]byte, enc.blockCipher.BlockSize())
+	cipher.NewCBCEncrypter(enc.blockCipher, nonce).CryptBlocks(ciphertext, make([]byte, len(ciphertext)))
+	sealed = append(ciphertext, enc.ComputeAuthTag(aad, nonce, ciphertext)...)
+	_, padErr := enc.Open(nil, nonce, sealed, aad)
+	if !assert.Error(t, padErr, "Open should fail for invalid padding") {
+		return
+	}
+
+	assert.Equal(t, macErr, padErr, "errors should be indistinguishable")
+}
+
+func TestUnpad(t *testing.T) {
+	good := []byte{'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 8, 8, 8, 8, 8, 8, 8, 8}
+	out, ok := unpad(good, 16)
+	if assert.True(t, ok, "unpad should succeed") {
+		assert.Equal(t, []byte("abcdefgh"), out, "unpad should remove padding")
+	}
+
+	for _, last := range []byte{0, 17} {
+		buf := make([]byte, 16)
+		buf[15] = last
+		_, ok = unpad(buf, 16)
+		assert.False(t, ok, "unpad should fail for out of range padding")
+	}
+
+	bad := append([]byte(nil), good...)
+	bad[9] = 7
+	_, ok = unpad(bad, 16)
+	assert.False(t, ok, "unpad should fail for inconsistent padding")
+}
+
+func TestMacInput(t *testing.T) {
+	// Source: https://tools.ietf.org/html/rfc7518#appendix-B.1
+	macKey := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f}
+
+	iv := []byte{
+		0x1a, 0xf3, 0x8c, 0x2d, 0xc2, 0xb9, 0x6f, 0xfd, 0xd8, 0x66, 0x94, 0x09, 0x23, 0x41, 0xbc, 0x04}
+
+	aad := []byte("The second principle of Auguste Kerckhoffs")
+
+	ciphertext := []byte{
+		0xc8, 0x0e, 0xdf, 0xa3, 0x2d, 0xdf, 0x39, 0xd5, 0xef, 0x00, 0xc0, 0xb4, 0x68, 0x83, 0x42, 0x79,
+		0xa2, 0xe4, 0x6a, 0x1b, 0x80, 0x49, 0xf7, 0x92, 0xf7, 0x6b, 0xfe, 0x54, 0xb9, 0x03, 0xa9, 0xc9,
+		0xa9, 0x4a, 0xc9, 0xb4, 0x7a, 0xd2, 0x65, 0x5c, 0x5f, 0x10, 0xf9, 0xae, 0xf7, 0x14, 0x27, 0xe2,
+		0xfc, 0x6f, 0x9b, 0x3f, 0x39, 0x9a, 0x22, 0x14, 0x89, 0xf1, 0x63, 0x62, 0xc7, 0x03, 0x23, 0x36,
+		0x09, 0xd4, 0x5a, 0xc6, 0x98, 0x64, 0xe3, 0x32, 0x1c, 0xf8, 0x29, 0x35, 0xac, 0x40, 0x96, 0xc8,
+		0x6e, 0x13, 0x33, 0x14, 0xc5, 0x40, 0x19, 0xe8, 0xca, 0x79, 0x80, 0xdf, 0xa4, 0xb9, 0xcf, 0x1b,
+		0x38, 0x4c, 0x48, 0x6f, 0x3a, 0x54, 0xc5, 0x10, 0x78, 0x15, 0x8e, 0xe5, 0xd7, 0x9d, 0xe5, 0x9f,
+		0xbd, 0x34, 0xd8, 0x48, 0xb3, 0xd6, 0x95, 0x50, 0xa6, 0x76, 0x46, 0x34, 0x44, 0x27, 0xad, 0xe5,
+		0x4b, 0x88, 0x51, 0xff, 0xb5, 0x98, 0xf7, 0xf8, 0x00, 0x74, 0xb9, 0x47, 0x3c, 0x82, 0xe2, 0xdb}
+
+	al := []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x50}
+
+	authtag := []byte{
+		0x65, 0x2c, 0x3f, 0xa3, 0x6b, 0x0a, 0x7c, 0x5b, 0x32, 0x19, 0xfa, 0xb3, 0xa3, 0x0b, 0xc1, 0xc4}
+
+	if !assert.Equal(t, al, aadLength(aad), "AL should match") {
+		return
+	}
+
+	input := macInput(aad, iv, ciphertext)
+	if !assert.Len(t, input, len(aad)+len(iv)+len(ciphertext)+len(al), "MAC input length should match") {
+		return
+	}
+	if !assert.Equal(t, aad, input[:len(aad)], "MAC input should start with the AAD") {
+		return
+	}
+	if !assert.Equal(t, iv, input[len(aad):len(aad)+len(iv)], "MAC input should continue with the IV") {
+		return
+	}
+	if !assert.Equal(t, ciphertext, input[len(aad)+len(iv):len(input)-len(al)], "MAC input should continue with the ciphertext") {
+		return
+	}
+	if !assert.Equal(t, al, input[len(input)-len(al):], "MAC input should end with AL") {
+		return
+	}
+
+	h := hmac.New(sha256.New, macKey)
+	h.Write(input)
+	assert.Equal(t, authtag, h.Sum(nil)[:len(authtag)], "Auth tag should match")
+}
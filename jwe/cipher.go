@@ -49,6 +49,45 @@ var CbcAeadFetch = AeadFetchFunc(func(key []byte) (cipher.AEAD, error) {
 	return aead, nil
 })
 
+// gcmNonceSize is the size of the IV used with AES GCM, as mandated by
+// https://tools.ietf.org/html/rfc7518#section-5.3
+const gcmNonceSize = 12
+
+// factoryAeadFetch wraps an AEAD factory supplied via WithAEADFactory,
+// and checks that the AEADs it creates use the nonce and tag sizes that
+// JOSE mandates for AES GCM
+func factoryAeadFetch(factory func([]byte) (cipher.AEAD, error)) AeadFetchFunc {
+	return AeadFetchFunc(func(key []byte) (cipher.AEAD, error) {
+		aead, err := factory(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "AEAD factory failed")
+		}
+		if aead.NonceSize() != gcmNonceSize {
+			return nil, errors.Wrapf(ErrInvalidAEAD, `expected %d byte nonce, got %d`, gcmNonceSize, aead.NonceSize())
+		}
+		if aead.Overhead() != TagSize {
+			return nil, errors.Wrapf(ErrInvalidAEAD, `expected %d byte tag, got %d`, TagSize, aead.Overhead())
+		}
+		return aead, nil
+	})
+}
+
+// useAeadFactory makes the content cipher use the given AEAD factory,
+// if it is not nil and the algorithm is one of the AES GCM algorithms
+func useAeadFactory(c ContentCipher, alg jwa.ContentEncryptionAlgorithm, factory func([]byte) (cipher.AEAD, error)) {
+	if factory == nil {
+		return
+	}
+	switch alg {
+	case jwa.A128GCM, jwa.A192GCM, jwa.A256GCM:
+	default:
+		return
+	}
+	if aesc, ok := c.(*AesContentCipher); ok {
+		aesc.AeadFetcher = factoryAeadFetch(factory)
+	}
+}
+
 func (c AesContentCipher) KeySize() int {
 	return c.keysize
 }
@@ -85,7 +124,7 @@ func NewAesContentCipher(alg jwa.ContentEncryptionAlgorithm) (*AesContentCipher,
 
 	return &AesContentCipher{
 		keysize:     keysize,
-		tagsize:     TagSize,
+		tagsize:     alg.TagSize(),
 		AeadFetcher: fetcher,
 	}, nil
 }
@@ -125,6 +164,9 @@ func (c AesContentCipher) encrypt(cek, plaintext, aad []byte) (iv, ciphertext, t
 		return nil, nil, nil, errors.Wrap(err, "failed to generate nonce")
 	}
 	iv = bs.Bytes()
+	if len(iv) != aead.NonceSize() {
+		return nil, nil, nil, errors.Wrapf(ErrInvalidIVLength, `expected %d bytes, got %d`, aead.NonceSize(), len(iv))
+	}
 
 	combined := aead.Seal(nil, iv, plaintext, aad)
 	tagoffset := len(combined) - c.TagSize()
@@ -153,6 +195,21 @@ func (c AesContentCipher) decrypt(cek, iv, ciphertxt, tag, aad []byte) (plaintex
 		return nil, errors.Wrap(err, "failed to fetch AEAD data")
 	}
 
+	// Earlier versions of this package truncated the AES CBC HMAC tag
+	// to 16 bytes for every key size. Keep accepting those messages
+	if cbc, ok := aead.(*aescbc.AesCbcHmac); ok && len(tag) != cbc.TagSize() && len(tag) == aescbc.LegacyTagSize {
+		aead, err = aescbc.NewLegacy(cek, aes.NewCipher)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create legacy AES CBC cipher")
+		}
+	}
+
+	// JOSE mandates a fixed IV size for each content encryption
+	// algorithm (96 bits for AES GCM). Other sizes are never valid
+	if len(iv) != aead.NonceSize() {
+		return nil, errors.Wrapf(ErrInvalidIVLength, `expected %d bytes, got %d`, aead.NonceSize(), len(iv))
+	}
+
 	// Open may panic (argh!), so protect ourselves from that
 	defer func() {
 		if e := recover(); e != nil {
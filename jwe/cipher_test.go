@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -24,3 +25,34 @@ func TestAesContentCipher(t *testing.T) {
 		t.Logf("keysize = %d", c.KeySize())
 	}
 }
+
+func TestAesContentCipher_IVLength(t *testing.T) {
+	c, err := NewAesContentCipher(jwa.A128GCM)
+	if !assert.NoError(t, err, "NewAesContentCipher should succeed") {
+		return
+	}
+
+	cek := make([]byte, c.KeySize())
+	aad := []byte("Lorem ipsum")
+	iv, ciphertext, tag, err := c.encrypt(cek, []byte("dolor sit amet"), aad)
+	if !assert.NoError(t, err, "encrypt should succeed") {
+		return
+	}
+	if !assert.Len(t, iv, 12, "generated IV should be 96 bits") {
+		return
+	}
+
+	_, err = c.decrypt(cek, iv, ciphertext, tag, aad)
+	if !assert.NoError(t, err, "decrypt should succeed") {
+		return
+	}
+
+	_, err = c.decrypt(cek, make([]byte, 16), ciphertext, tag, aad)
+	if !assert.Equal(t, ErrInvalidIVLength, errors.Cause(err), "decrypt should fail with ErrInvalidIVLength") {
+		return
+	}
+
+	c.NonceGenerator = StaticKeyGenerate(make([]byte, 16))
+	_, _, _, err = c.encrypt(cek, []byte("dolor sit amet"), aad)
+	assert.Equal(t, ErrInvalidIVLength, errors.Cause(err), "encrypt should fail with ErrInvalidIVLength")
+}
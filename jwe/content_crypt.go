@@ -50,7 +50,7 @@ func NewAesCrypt(alg jwa.ContentEncryptionAlgorithm) (*GenericContentCrypt, erro
 		cipher:  cipher,
 		cekgen:  NewRandomKeyGenerate(cipher.KeySize() * 2),
 		keysize: cipher.KeySize() * 2,
-		tagsize: 16,
+		tagsize: cipher.TagSize(),
 	}, nil
 }
 
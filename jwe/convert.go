@@ -0,0 +1,125 @@
+package jwe
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// flattenedMessage is used to mechanically convert between the compact
+// and the JSON serialization formats. All values are kept in their
+// encoded form, so that the bytes that participate in the AAD and the
+// authentication tag are preserved as is.
+type flattenedMessage struct {
+	Protected    string          `json:"protected,omitempty"`
+	Unprotected  json.RawMessage `json:"unprotected,omitempty"`
+	Header       json.RawMessage `json:"header,omitempty"`
+	EncryptedKey string          `json:"encrypted_key,omitempty"`
+	AAD          *string         `json:"aad,omitempty"`
+	IV           string          `json:"iv,omitempty"`
+	CipherText   string          `json:"ciphertext"`
+	Tag          string          `json:"tag,omitempty"`
+	Recipients   []struct {
+		Header       json.RawMessage `json:"header,omitempty"`
+		EncryptedKey string          `json:"encrypted_key,omitempty"`
+	} `json:"recipients,omitempty"`
+}
+
+// ConvertCompactToJSON converts a JWE message in compact serialization
+// into the flattened JSON serialization. No decryption is performed,
+// and the encrypted contents are copied verbatim.
+func ConvertCompactToJSON(compact []byte) ([]byte, error) {
+	parts := bytes.Split(bytes.TrimSpace(compact), []byte{'.'})
+	if len(parts) != 5 {
+		return nil, ErrInvalidCompactPartsCount
+	}
+
+	var hdrbuf []byte
+	for i, part := range parts {
+		decoded, err := base64.RawURLEncoding.DecodeString(string(part))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to base64 decode part #%d", i+1)
+		}
+		if i == 0 {
+			hdrbuf = decoded
+		}
+	}
+
+	var hdr map[string]interface{}
+	if err := json.Unmarshal(hdrbuf, &hdr); err != nil {
+		return nil, errors.Wrap(err, "failed to parse header JSON")
+	}
+
+	return json.Marshal(flattenedMessage{
+		Protected:    string(parts[0]),
+		EncryptedKey: string(parts[1]),
+		IV:           string(parts[2]),
+		CipherText:   string(parts[3]),
+		Tag:          string(parts[4]),
+	})
+}
+
+// ConvertJSONToCompact converts a JWE message in JSON serialization
+// (either flattened or general) into the compact serialization. No
+// decryption is performed, and the encrypted contents are copied verbatim.
+//
+// Only messages with exactly one recipient, whose headers are all in the
+// protected header, and which do not carry AAD can be converted.
+// ErrCompactUnrepresentable is returned for all other messages.
+func ConvertJSONToCompact(jsonForm []byte) ([]byte, error) {
+	var m flattenedMessage
+	if err := json.Unmarshal(jsonForm, &m); err != nil {
+		return nil, errors.Wrap(err, "failed to parse JSON")
+	}
+
+	encryptedKey := m.EncryptedKey
+	header := m.Header
+	if len(m.Recipients) > 0 {
+		if len(m.Header) > 0 || len(m.EncryptedKey) > 0 {
+			return nil, errors.New("invalid message: mixed flattened/full json serialization")
+		}
+		if len(m.Recipients) != 1 {
+			return nil, errors.Wrap(ErrCompactUnrepresentable, "multiple recipients")
+		}
+		encryptedKey = m.Recipients[0].EncryptedKey
+		header = m.Recipients[0].Header
+	}
+
+	if len(m.Protected) == 0 {
+		return nil, errors.Wrap(ErrCompactUnrepresentable, "missing protected header")
+	}
+	if !isEmptyJSONObject(m.Unprotected) {
+		return nil, errors.Wrap(ErrCompactUnrepresentable, "unprotected header is present")
+	}
+	if !isEmptyJSONObject(header) {
+		return nil, errors.Wrap(ErrCompactUnrepresentable, "per-recipient header is present")
+	}
+	if m.AAD != nil {
+		return nil, errors.Wrap(ErrCompactUnrepresentable, "aad is present")
+	}
+
+	var buf bytes.Buffer
+	for i, part := range []string{m.Protected, encryptedKey, m.IV, m.CipherText, m.Tag} {
+		if _, err := base64.RawURLEncoding.DecodeString(part); err != nil {
+			return nil, errors.Wrapf(err, "failed to base64 decode part #%d", i+1)
+		}
+		if i > 0 {
+			buf.WriteByte('.')
+		}
+		buf.WriteString(part)
+	}
+	return buf.Bytes(), nil
+}
+
+func isEmptyJSONObject(v json.RawMessage) bool {
+	if len(v) == 0 {
+		return true
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(v, &m); err != nil {
+		return false
+	}
+	return len(m) == 0
+}
@@ -19,6 +19,21 @@ func NewMultiEncrypt(cc ContentEncrypter, kg KeyGenerator, ke ...KeyEncrypter) *
 
 // Encrypt takes the plaintext and encrypts into a JWE message.
 func (e MultiEncrypt) Encrypt(plaintext []byte) (*Message, error) {
+	return e.encrypt(plaintext, NewEncodedHeader(), nil)
+}
+
+// EncryptWithAAD is the same as Encrypt, but also integrity protects
+// the given additional authenticated data, which is stored in the "aad"
+// member of the message. Messages with AAD can only be represented in
+// the JSON serialization. An empty, non-nil aad is kept as an explicitly
+// empty "aad" member, which is authenticated differently from no AAD.
+func (e MultiEncrypt) EncryptWithAAD(plaintext, aad []byte) (*Message, error) {
+	return e.encrypt(plaintext, NewEncodedHeader(), aad)
+}
+
+// encrypt encrypts the plaintext, using the given header as the
+// basis of the protected header.
+func (e MultiEncrypt) encrypt(plaintext []byte, protected *EncodedHeader, aad []byte) (*Message, error) {
 	bk, err := e.KeyGenerator.KeyGenerate()
 	if err != nil {
 		if debug.Enabled {
@@ -32,7 +47,6 @@ func (e MultiEncrypt) Encrypt(plaintext []byte) (*Message, error) {
 		debug.Printf("Encrypt: generated cek len = %d", len(cek))
 	}
 
-	protected := NewEncodedHeader()
 	protected.Set("enc", e.ContentEncrypter.Algorithm())
 
 	// In JWE, multiple recipients may exist -- they receive an
@@ -71,13 +85,27 @@ func (e MultiEncrypt) Encrypt(plaintext []byte) (*Message, error) {
 		}
 	}
 
-	aad, err := protected.Base64Encode()
+	encoded, err := protected.Base64Encode()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to base64 encode protected headers")
 	}
 
+	// Remember the exact encoding that was used for the AAD
+	if err := protected.setEncoded(encoded); err != nil {
+		return nil, errors.Wrap(err, "failed to record encoded protected headers")
+	}
+
+	msg := NewMessage()
+	msg.ProtectedHeader = protected
+	msg.SetAAD(aad)
+
+	authenticated, err := msg.computeAAD()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compute authenticated data")
+	}
+
 	// ...on the other hand, there's only one content cipher.
-	iv, ciphertext, tag, err := e.ContentEncrypter.Encrypt(cek, plaintext, aad)
+	iv, ciphertext, tag, err := e.ContentEncrypter.Encrypt(cek, plaintext, authenticated)
 	if err != nil {
 		if debug.Enabled {
 			debug.Printf("Failed to encrypt: %s", err)
@@ -87,17 +115,14 @@ func (e MultiEncrypt) Encrypt(plaintext []byte) (*Message, error) {
 
 	if debug.Enabled {
 		debug.Printf("Encrypt.Encrypt: cek        = %x (%d)", cek, len(cek))
-		debug.Printf("Encrypt.Encrypt: aad        = %x", aad)
+		debug.Printf("Encrypt.Encrypt: aad        = %x", authenticated)
 		debug.Printf("Encrypt.Encrypt: ciphertext = %x", ciphertext)
 		debug.Printf("Encrypt.Encrypt: iv         = %x", iv)
 		debug.Printf("Encrypt.Encrypt: tag        = %x", tag)
 	}
 
-	msg := NewMessage()
-	msg.AuthenticatedData.Base64Decode(aad)
 	msg.CipherText = ciphertext
 	msg.InitializationVector = iv
-	msg.ProtectedHeader = protected
 	msg.Recipients = recipients
 	msg.Tag = tag
 
@@ -1,14 +1,17 @@
 package jwe
 
 import (
+	"crypto"
 	"crypto/cipher"
 	"crypto/ecdsa"
 	"crypto/rsa"
 	"errors"
 	"fmt"
 	"net/url"
+	"strings"
 
 	"github.com/lestrrat-go/jwx/buffer"
+	"github.com/lestrrat-go/jwx/internal/base64"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
 )
@@ -20,6 +23,23 @@ var (
 	ErrInvalidHeaderValue       = errors.New("invalid value for header key")
 	ErrUnsupportedAlgorithm     = errors.New("unsupported algorithm")
 	ErrMissingPrivateKey        = errors.New("missing private key")
+	ErrInvalidEphemeralKey      = errors.New("invalid ephemeral public key")
+	ErrCompactUnrepresentable   = errors.New("message can not be represented in compact serialization")
+	ErrMissingAlgorithm         = errors.New(`missing "alg" in JOSE header`)
+	ErrMissingContentEncryption = errors.New(`missing "enc" in JOSE header`)
+	ErrTrailingData             = errors.New("trailing data after compact serialization")
+	ErrKeyUnwrapFailed          = errors.New("keywrap: failed to unwrap key (integrity check failed)")
+	ErrNilKey                   = errors.New("key must not be nil")
+	ErrTooManyDecryptAttempts   = errors.New("too many decrypt attempts")
+	ErrDecompressedSizeExceeded = errors.New("decompressed payload exceeds size limit")
+	ErrAlgorithmPairNotAllowed  = errors.New("combination of key and content encryption algorithms is not allowed")
+	ErrInvalidIVLength          = errors.New("invalid initialization vector length")
+	ErrProtectedHeaderRequired  = errors.New("header parameter must be in the protected header")
+	ErrPBES2CountTooHigh        = errors.New(`PBES2 iteration count ("p2c") exceeds limit`)
+	ErrPBES2CountTooLow         = errors.New(`PBES2 iteration count ("p2c") is below minimum`)
+	ErrNonCanonicalBase64       = base64.ErrNonCanonical
+	ErrInvalidAEAD              = errors.New("AEAD does not use the nonce and tag sizes required by the algorithm")
+	ErrCurveNotAllowed          = errors.New("curve is not allowed for ECDH-ES")
 )
 
 type errUnsupportedAlgorithm struct {
@@ -37,6 +57,63 @@ func (e errUnsupportedAlgorithm) Error() string {
 	return fmt.Sprintf("unsupported algorithm '%s' for %s", e.alg, e.purpose)
 }
 
+// DecryptError is returned when a message could not be decrypted for
+// a recipient. RecipientIndex is the index of the recipient in the
+// message, and Err is the underlying cause.
+type DecryptError struct {
+	RecipientIndex int
+	Alg            jwa.KeyEncryptionAlgorithm
+	Err            error
+}
+
+// Error returns the string representation of the error
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("failed to decrypt for recipient #%d (alg = %s): %s", e.RecipientIndex, e.Alg, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
+
+// Cause returns the underlying error, so that errors.Cause from
+// github.com/pkg/errors works
+func (e *DecryptError) Cause() error {
+	return e.Err
+}
+
+// DecryptErrors is returned when decryption was attempted for more than
+// one recipient, and all of them failed.
+type DecryptErrors []*DecryptError
+
+// Error returns the string representation of the error
+func (e DecryptErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "failed to decrypt for all recipients: " + strings.Join(msgs, ", ")
+}
+
+// Cause returns the error for the first recipient, so that errors.Cause
+// from github.com/pkg/errors works. Unwrap, which returns all of them,
+// is only used by the standard errors package since Go 1.20
+func (e DecryptErrors) Cause() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e[0]
+}
+
+// Unwrap returns the errors for each recipient
+func (e DecryptErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
 // EssentialHeader is a set of headers that are already defined in RFC 7516`
 type EssentialHeader struct {
 	AgreementPartyUInfo    buffer.Buffer                  `json:"apu,omitempty"`
@@ -68,6 +145,7 @@ type Header struct {
 type EncodedHeader struct {
 	*Header
 	encoded buffer.Buffer // sometimes our encoding and the source encoding don't match
+	source  []byte        // JSON of the header at the time encoded was recorded
 }
 
 // ByteSource is an interface for things that return a byte sequence.
@@ -138,6 +216,26 @@ type KeyWrapEncrypt struct {
 	KeyID     string
 }
 
+// PBES2KeyEncrypt encrypts content encryption keys using PBES2, that
+// is, AES key wrap with a key derived from a password using PBKDF2.
+// Contrary to what the name implies, it also decrypt encrypted keys
+type PBES2KeyEncrypt struct {
+	alg      jwa.KeyEncryptionAlgorithm
+	password []byte
+	salt     []byte // "p2s" header value, used when decrypting
+	count    int    // "p2c" header value
+	KeyID    string
+}
+
+// ByteWithPBES2Params holds the encrypted key along with the salt input
+// and iteration count that were used to derive the key encryption key.
+// This is required to set the proper values in the JWE headers
+type ByteWithPBES2Params struct {
+	ByteKey
+	Salt  []byte
+	Count int
+}
+
 // EcdhesKeyWrapEncrypt encrypts content encryption keys using ECDH-ES.
 type EcdhesKeyWrapEncrypt struct {
 	algorithm jwa.KeyEncryptionAlgorithm
@@ -211,6 +309,8 @@ type EcdhesKeyGenerate struct {
 	algorithm jwa.KeyEncryptionAlgorithm
 	keysize   int
 	pubkey    *ecdsa.PublicKey
+	apu       []byte
+	apv       []byte
 }
 
 // Serializer converts an encrypted message into a byte buffer
@@ -272,8 +372,9 @@ type RSAOAEPKeyEncrypt struct {
 
 // RSAOAEPKeyDecrypt decrypts keys using RSA OAEP algorithm
 type RSAOAEPKeyDecrypt struct {
-	alg     jwa.KeyEncryptionAlgorithm
-	privkey *rsa.PrivateKey
+	alg      jwa.KeyEncryptionAlgorithm
+	privkey  *rsa.PrivateKey
+	mgf1Hash crypto.Hash // zero means the same hash as OAEP
 }
 
 // DirectDecrypt does not encryption (Note: Unimplemented)
@@ -4,139 +4,382 @@ package jwe
 import (
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/rsa"
 	"encoding/json"
+	"strings"
+	"unicode"
 
 	"github.com/lestrrat-go/jwx/buffer"
+	"github.com/lestrrat-go/jwx/internal/base64"
 	"github.com/lestrrat-go/jwx/internal/debug"
+	"github.com/lestrrat-go/jwx/internal/envelope"
+	"github.com/lestrrat-go/jwx/internal/keyconv"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/pkg/errors"
 )
 
 // Encrypt takes the plaintext payload and encrypts it in JWE compact format.
-func Encrypt(payload []byte, keyalg jwa.KeyEncryptionAlgorithm, key interface{}, contentalg jwa.ContentEncryptionAlgorithm, compressalg jwa.CompressionAlgorithm) ([]byte, error) {
+//
+// Specify WithAEADFactory to use a custom AEAD implementation for the
+// AES GCM content encryption algorithms.
+func Encrypt(payload []byte, keyalg jwa.KeyEncryptionAlgorithm, key interface{}, contentalg jwa.ContentEncryptionAlgorithm, compressalg jwa.CompressionAlgorithm, options ...Option) ([]byte, error) {
+	if keyconv.IsNil(key) {
+		return nil, errors.Wrap(ErrNilKey, `invalid parameter "key"`)
+	}
+
 	contentcrypt, err := NewAesCrypt(contentalg)
 	if err != nil {
 		return nil, errors.Wrap(err, `failed to create AES encrypter`)
 	}
+	useAeadFactory(contentcrypt.cipher, contentalg, aeadFactoryFromOptions(options))
+
+	keyenc, keysize, err := buildKeyEncrypter(keyalg, key, contentcrypt, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if debug.Enabled {
+		debug.Printf("Encrypt: keysize = %d", keysize)
+	}
+	enc := NewMultiEncrypt(contentcrypt, NewRandomKeyGenerate(keysize), keyenc)
+	msg, err := enc.Encrypt(payload)
+	if err != nil {
+		if debug.Enabled {
+			debug.Printf("Encrypt: failed to encrypt: %s", err)
+		}
+		return nil, errors.Wrap(err, "failed to encrypt payload")
+	}
+
+	return CompactSerialize{}.Serialize(msg)
+}
+
+// EncryptWithHeader takes the plaintext payload and encrypts it in JWE
+// compact format, using the algorithms specified by the "alg" and "enc"
+// parameters in the given protected header. All other parameters in the
+// header, including private ones, are included in the protected header
+// as is. For ECDH-ES family of algorithms, the "apu" and "apv" parameters
+// are used in the key agreement.
+func EncryptWithHeader(payload []byte, key interface{}, protected *Header, options ...Option) ([]byte, error) {
+	if keyconv.IsNil(key) {
+		return nil, errors.Wrap(ErrNilKey, `invalid parameter "key"`)
+	}
+	if protected == nil {
+		return nil, errors.New("missing protected header")
+	}
+	if protected.Algorithm == "" {
+		return nil, ErrMissingAlgorithm
+	}
+	if protected.ContentEncryption == "" {
+		return nil, ErrMissingContentEncryption
+	}
+	if protected.Compression != jwa.NoCompress {
+		return nil, errors.Errorf("unsupported compression algorithm %s", protected.Compression)
+	}
+
+	contentcrypt, err := NewAesCrypt(protected.ContentEncryption)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create AES encrypter`)
+	}
+	useAeadFactory(contentcrypt.cipher, protected.ContentEncryption, aeadFactoryFromOptions(options))
+
+	keyenc, keysize, err := buildKeyEncrypter(protected.Algorithm, key, contentcrypt, protected.AgreementPartyUInfo.Bytes(), protected.AgreementPartyVInfo.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	hdr := NewEncodedHeader()
+	if err := hdr.Header.Copy(protected); err != nil {
+		return nil, errors.Wrap(err, "failed to copy protected header")
+	}
+
+	enc := NewMultiEncrypt(contentcrypt, NewRandomKeyGenerate(keysize), keyenc)
+	msg, err := enc.encrypt(payload, hdr, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encrypt payload")
+	}
+
+	return CompactSerialize{}.Serialize(msg)
+}
 
+// buildKeyEncrypter creates the KeyEncrypter for the given algorithm, and
+// returns it along with the size of the content encryption key to generate.
+// apu and apv are only used for ECDH-ES family of algorithms.
+func buildKeyEncrypter(keyalg jwa.KeyEncryptionAlgorithm, key interface{}, contentcrypt *GenericContentCrypt, apu, apv []byte) (KeyEncrypter, int, error) {
 	var keyenc KeyEncrypter
 	var keysize int
+	var err error
 	switch keyalg {
 	case jwa.RSA1_5:
-		pubkey, ok := key.(*rsa.PublicKey)
+		pubkey, ok := keyconv.RSAPublicKey(key)
 		if !ok {
-			return nil, errors.New("invalid key: *rsa.PublicKey required")
+			return nil, 0, errors.New("invalid key: *rsa.PublicKey required")
 		}
 		keyenc, err = NewRSAPKCSKeyEncrypt(keyalg, pubkey)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to create RSA PKCS encrypter")
+			return nil, 0, errors.Wrap(err, "failed to create RSA PKCS encrypter")
 		}
 		keysize = contentcrypt.KeySize() / 2
 	case jwa.RSA_OAEP, jwa.RSA_OAEP_256:
-		pubkey, ok := key.(*rsa.PublicKey)
+		pubkey, ok := keyconv.RSAPublicKey(key)
 		if !ok {
-			return nil, errors.New("invalid key: *rsa.PublicKey required")
+			return nil, 0, errors.New("invalid key: *rsa.PublicKey required")
 		}
 		keyenc, err = NewRSAOAEPKeyEncrypt(keyalg, pubkey)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to create RSA OAEP encrypter")
+			return nil, 0, errors.Wrap(err, "failed to create RSA OAEP encrypter")
 		}
 		keysize = contentcrypt.KeySize() / 2
 	case jwa.A128KW, jwa.A192KW, jwa.A256KW:
 		sharedkey, ok := key.([]byte)
 		if !ok {
-			return nil, errors.New("invalid key: []byte required")
+			return nil, 0, errors.New("invalid key: []byte required")
 		}
 		keyenc, err = NewKeyWrapEncrypt(keyalg, sharedkey)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to create key wrap encrypter")
-		}
-		keysize = contentcrypt.KeySize()
-		switch aesKeySize := keysize / 2; aesKeySize {
-		case 16, 24, 32:
-		default:
-			return nil, errors.Errorf("unsupported keysize %d (from content encryption algorithm %s). consider using content encryption that uses 32, 48, or 64 byte keys", keysize, contentalg)
+			return nil, 0, errors.Wrap(err, "failed to create key wrap encrypter")
 		}
+		keysize = contentcrypt.KeySize() / 2
 	case jwa.ECDH_ES_A128KW, jwa.ECDH_ES_A192KW, jwa.ECDH_ES_A256KW:
-		pubkey, ok := key.(*ecdsa.PublicKey)
+		pubkey, ok := keyconv.ECDSAPublicKey(key)
 		if !ok {
-			return nil, errors.New("invalid key: *ecdsa.PublicKey required")
+			return nil, 0, errors.New("invalid key: *ecdsa.PublicKey required")
 		}
-		keyenc, err = NewEcdhesKeyWrapEncrypt(keyalg, pubkey)
+		keyenc, err = newEcdhesKeyWrapEncrypt(keyalg, pubkey, apu, apv)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to create ECDHS key wrap encrypter")
+			return nil, 0, errors.Wrap(err, "failed to create ECDHS key wrap encrypter")
+		}
+		keysize = contentcrypt.KeySize() / 2
+	case jwa.PBES2_HS256_A128KW, jwa.PBES2_HS384_A192KW, jwa.PBES2_HS512_A256KW:
+		password, ok := key.([]byte)
+		if !ok {
+			return nil, 0, errors.New("invalid key: []byte required")
+		}
+		keyenc, err = NewPBES2KeyEncrypt(keyalg, password, DefaultPBES2Count)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed to create PBES2 encrypter")
 		}
 		keysize = contentcrypt.KeySize() / 2
 	case jwa.ECDH_ES:
 		fallthrough
 	case jwa.A128GCMKW, jwa.A192GCMKW, jwa.A256GCMKW:
 		fallthrough
-	case jwa.PBES2_HS256_A128KW, jwa.PBES2_HS384_A192KW, jwa.PBES2_HS512_A256KW:
-		fallthrough
 	default:
 		if debug.Enabled {
 			debug.Printf("Encrypt: unknown key encryption algorithm: %s", keyalg)
 		}
-		return nil, errors.Wrap(ErrUnsupportedAlgorithm, "failed to create encrypter")
+		return nil, 0, errors.Wrap(ErrUnsupportedAlgorithm, "failed to create encrypter")
 	}
+	return keyenc, keysize, nil
+}
 
-	if debug.Enabled {
-		debug.Printf("Encrypt: keysize = %d", keysize)
+// Decrypt takes the key encryption algorithm and the corresponding
+// key to decrypt the JWE message, and returns the decrypted payload.
+// The JWE message can be either compact or full JSON format.
+func Decrypt(buf []byte, alg jwa.KeyEncryptionAlgorithm, key interface{}, options ...Option) ([]byte, error) {
+	if keyconv.IsNil(key) {
+		return nil, errors.Wrap(ErrNilKey, `invalid parameter "key"`)
 	}
-	enc := NewMultiEncrypt(contentcrypt, NewRandomKeyGenerate(keysize), keyenc)
-	msg, err := enc.Encrypt(payload)
+
+	msg, err := Parse(buf, options...)
 	if err != nil {
-		if debug.Enabled {
-			debug.Printf("Encrypt: failed to encrypt: %s", err)
-		}
-		return nil, errors.Wrap(err, "failed to encrypt payload")
+		return nil, errors.Wrap(err, "failed to parse buffer for Decrypt")
 	}
 
-	return CompactSerialize{}.Serialize(msg)
+	return msg.Decrypt(alg, key, options...)
 }
 
-// Decrypt takes the key encryption algorithm and the corresponding
-// key to decrypt the JWE message, and returns the decrypted payload.
-// The JWE message can be either compact or full JSON format.
-func Decrypt(buf []byte, alg jwa.KeyEncryptionAlgorithm, key interface{}) ([]byte, error) {
-	msg, err := Parse(buf)
+// DecryptWithSet decrypts the JWE message using the keys in the given
+// set. Each key is tried against every recipient whose algorithm it
+// supports, and whose "kid" (if any) matches that of the key. Keys whose
+// "use" is not "enc", or whose "key_ops" include neither "decrypt" nor
+// "unwrapKey", are skipped. Keys without "use" or "key_ops" are tried.
+//
+// The total number of attempts across all keys is limited by
+// WithMaxDecryptAttempts (DefaultMaxDecryptAttempts by default), and
+// ErrTooManyDecryptAttempts is returned once the limit is exceeded.
+func DecryptWithSet(buf []byte, set *jwk.Set, options ...Option) ([]byte, error) {
+	if set == nil {
+		return nil, errors.Wrap(ErrNilKey, `invalid parameter "set"`)
+	}
+
+	msg, err := Parse(buf, options...)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to parse buffer for Decrypt")
+		return nil, errors.Wrap(err, "failed to parse buffer for DecryptWithSet")
+	}
+
+	// The distinct algorithms used by the recipients
+	var algs []jwa.KeyEncryptionAlgorithm
+	keyAlgs, _ := msg.Algorithms()
+	seen := make(map[jwa.KeyEncryptionAlgorithm]struct{})
+	for _, alg := range keyAlgs {
+		if _, ok := seen[alg]; !ok {
+			seen[alg] = struct{}{}
+			algs = append(algs, alg)
+		}
 	}
 
-	return msg.Decrypt(alg, key)
+	cfg, err := newDecryptConfig(options)
+	if err != nil {
+		return nil, errors.Wrap(err, `invalid options`)
+	}
+	lastErr := errors.New("no key in the set could be used to decrypt the message")
+	for _, key := range set.Keys {
+		if u := key.KeyUsage(); u != "" && u != string(jwk.ForEncryption) {
+			continue
+		}
+		if !key.KeyOps().Permits(jwk.KeyOpDecrypt, jwk.KeyOpUnwrapKey) {
+			continue
+		}
+
+		_, supported := jwk.SupportedAlgorithms(key)
+		for _, alg := range algs {
+			if v := key.Algorithm(); v != "" && v != alg.String() {
+				continue
+			}
+			if !containsKeyEncryptionAlgorithm(supported, alg) {
+				continue
+			}
+
+			plaintext, err := msg.decrypt(alg, key, cfg)
+			if err == nil {
+				return plaintext, nil
+			}
+			if err == ErrTooManyDecryptAttempts {
+				return nil, err
+			}
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
+
+func containsKeyEncryptionAlgorithm(list []jwa.KeyEncryptionAlgorithm, alg jwa.KeyEncryptionAlgorithm) bool {
+	for _, v := range list {
+		if v == alg {
+			return true
+		}
+	}
+	return false
 }
 
 // Parse parses the JWE message into a Message object. The JWE message
 // can be either compact or full JSON format.
-func Parse(buf []byte) (*Message, error) {
+//
+// If WithStrictBase64 is specified, messages containing values that are
+// not canonically base64url encoded are rejected with
+// ErrNonCanonicalBase64.
+func Parse(buf []byte, options ...Option) (*Message, error) {
+	var strict bool
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyStrictBase64:
+			strict = o.Value().(bool)
+		}
+	}
+
 	buf = bytes.TrimSpace(buf)
 	if len(buf) == 0 {
 		return nil, errors.New("empty buffer")
 	}
 
+	if strict {
+		if err := checkCanonicalEncoding(buf); err != nil {
+			return nil, err
+		}
+	}
+
 	if buf[0] == '{' {
 		return parseJSON(buf)
 	}
 	return parseCompact(buf)
 }
 
+// DecodeSegments splits a JWE message in compact serialization into its
+// header, encrypted key, initialization vector, ciphertext, and
+// authentication tag segments, and returns each of them base64url
+// decoded, in that order. The segments are not interpreted in any way,
+// and nothing is decrypted.
+func DecodeSegments(compact []byte) ([][]byte, error) {
+	segments, err := base64.DecodeSegments(bytes.TrimSpace(compact), 5)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to decode compact serialization`)
+	}
+	return segments, nil
+}
+
+// checkCanonicalEncoding checks that every base64url encoded value of
+// the message in either serialization is canonically encoded
+func checkCanonicalEncoding(buf []byte) error {
+	var values []string
+	if buf[0] == '{' {
+		var raw struct {
+			AAD          string `json:"aad"`
+			CipherText   string `json:"ciphertext"`
+			EncryptedKey string `json:"encrypted_key"`
+			IV           string `json:"iv"`
+			Protected    string `json:"protected"`
+			Recipients   []struct {
+				EncryptedKey string `json:"encrypted_key"`
+			} `json:"recipients"`
+			Tag string `json:"tag"`
+		}
+		if err := json.Unmarshal(buf, &raw); err != nil {
+			return errors.Wrap(err, "failed to parse JSON")
+		}
+		values = []string{raw.AAD, raw.CipherText, raw.EncryptedKey, raw.IV, raw.Protected, raw.Tag}
+		for _, r := range raw.Recipients {
+			values = append(values, r.EncryptedKey)
+		}
+	} else {
+		values = strings.Split(string(buf), ".")
+	}
+
+	for _, v := range values {
+		if err := base64.CheckCanonical([]byte(v)); err != nil {
+			return errors.Wrap(err, "invalid base64url value")
+		}
+	}
+	return nil
+}
+
 // ParseString is the same as Parse, but takes a string.
-func ParseString(s string) (*Message, error) {
-	return Parse([]byte(s))
+func ParseString(s string, options ...Option) (*Message, error) {
+	return Parse([]byte(s), options...)
+}
+
+// ParseEnvelope parses a message that is embedded as a string in the
+// named field of a JSON object, such as {"token":"eyJ..."}. This is a
+// convenience for application level wrappers, and is unrelated to the
+// JSON serialization of JWE, which Parse handles.
+func ParseEnvelope(data []byte, field string, options ...Option) (*Message, error) {
+	s, err := envelope.Field(data, field)
+	if err != nil {
+		return nil, err
+	}
+	return ParseString(s, options...)
 }
 
 func parseJSON(buf []byte) (*Message, error) {
+	// "aad" is decoded separately, as an explicit null must be treated
+	// the same as an absent member, not as an empty AAD
 	m := struct {
 		*Message
 		*Recipient
+		AuthenticatedData *json.RawMessage `json:"aad"`
 	}{}
 
 	if err := json.Unmarshal(buf, &m); err != nil {
 		return nil, errors.Wrap(err, "failed to parse JSON")
 	}
+	if m.Message == nil {
+		m.Message = &Message{}
+	}
+
+	if m.AuthenticatedData != nil {
+		if err := json.Unmarshal(*m.AuthenticatedData, &m.Message.AuthenticatedData); err != nil {
+			return nil, errors.Wrap(err, `failed to parse "aad"`)
+		}
+	}
 
 	// if the "signature" field exist, treat it as a flattened
 	if m.Recipient != nil {
@@ -147,15 +390,86 @@ func parseJSON(buf []byte) (*Message, error) {
 		m.Message.Recipients = []Recipient{*m.Recipient}
 	}
 
+	if err := checkAlgorithmHeaders(m.Message); err != nil {
+		return nil, err
+	}
+	if err := checkCompressionHeader(m.Message); err != nil {
+		return nil, err
+	}
+
 	return m.Message, nil
 }
 
+// checkCompressionHeader checks that "zip" is only specified in the
+// protected header. It changes how the plaintext is processed, and
+// therefore must be integrity protected
+func checkCompressionHeader(m *Message) error {
+	if h := m.UnprotectedHeader; h != nil && h.EssentialHeader != nil && h.Compression != jwa.NoCompress {
+		return errors.Wrap(ErrProtectedHeaderRequired, `"zip" found in unprotected header`)
+	}
+	for i, r := range m.Recipients {
+		if h := r.Header; h != nil && h.EssentialHeader != nil && h.Compression != jwa.NoCompress {
+			return errors.Wrapf(ErrProtectedHeaderRequired, `"zip" found in header of recipient #%d`, i+1)
+		}
+	}
+	return nil
+}
+
+// checkAlgorithmHeaders checks that "enc" is specified for the message,
+// and "alg" for each of the recipients. Each may be in any of the
+// protected, unprotected, or per-recipient headers
+func checkAlgorithmHeaders(m *Message) error {
+	var enc jwa.ContentEncryptionAlgorithm
+	var alg jwa.KeyEncryptionAlgorithm
+	for _, h := range []*Header{protectedHeader(m), m.UnprotectedHeader} {
+		if h == nil {
+			continue
+		}
+		if h.ContentEncryption != "" {
+			enc = h.ContentEncryption
+		}
+		if h.Algorithm != "" {
+			alg = h.Algorithm
+		}
+	}
+
+	if enc == "" {
+		return ErrMissingContentEncryption
+	}
+
+	for i, r := range m.Recipients {
+		if alg != "" {
+			continue
+		}
+		if r.Header == nil || r.Header.Algorithm == "" {
+			return errors.Wrapf(ErrMissingAlgorithm, "recipient #%d", i+1)
+		}
+	}
+	return nil
+}
+
+func protectedHeader(m *Message) *Header {
+	if m.ProtectedHeader == nil {
+		return nil
+	}
+	return m.ProtectedHeader.Header
+}
+
 func parseCompact(buf []byte) (*Message, error) {
 	if debug.Enabled {
 		debug.Printf("Parse(Compact): buf = '%s'", buf)
 	}
+	// The buffer has already been trimmed, so any whitespace means
+	// that something follows the token
+	if bytes.IndexFunc(buf, unicode.IsSpace) >= 0 {
+		return nil, ErrTrailingData
+	}
+
 	parts := bytes.Split(buf, []byte{'.'})
-	if len(parts) != 5 {
+	switch {
+	case len(parts) > 5:
+		return nil, ErrTrailingData
+	case len(parts) < 5:
 		return nil, ErrInvalidCompactPartsCount
 	}
 
@@ -171,12 +485,26 @@ func parseCompact(buf []byte) (*Message, error) {
 	if err := json.Unmarshal(hdrbuf, hdr); err != nil {
 		return nil, errors.Wrap(err, "failed to parse header JSON")
 	}
+	if hdr.Algorithm == "" {
+		return nil, ErrMissingAlgorithm
+	}
+	if hdr.ContentEncryption == "" {
+		return nil, ErrMissingContentEncryption
+	}
 
-	// We need the protected header to contain the content encryption
-	// algorithm. XXX probably other headers need to go there too
+	// The compact serialization has a single header, but "enc" and "zip"
+	// describe how the content was processed, and are message-level
+	// parameters. Everything else pertains to the (only) recipient. Split
+	// them so that the model is the same as the JSON serialization.
+	// The original bytes are kept, as they are used as the AAD
 	protected := NewEncodedHeader()
 	protected.ContentEncryption = hdr.ContentEncryption
+	protected.Compression = hdr.Compression
+	if err := protected.setEncoded(parts[0]); err != nil {
+		return nil, errors.Wrap(err, "failed to record encoded header")
+	}
 	hdr.ContentEncryption = ""
+	hdr.Compression = jwa.NoCompress
 
 	enckeybuf := buffer.Buffer{}
 	if err := enckeybuf.Base64Decode(parts[1]); err != nil {
@@ -199,7 +527,6 @@ func parseCompact(buf []byte) (*Message, error) {
 	}
 
 	m := NewMessage()
-	m.AuthenticatedData.SetBytes(hdrbuf.Bytes())
 	m.ProtectedHeader = protected
 	m.Tag = tagbuf
 	m.CipherText = ctbuf
@@ -217,16 +544,23 @@ func parseCompact(buf []byte) (*Message, error) {
 // parameters. It is used by the Message.Decrypt method to create
 // key decrypter(s) from the given message. `keysize` is only used by
 // some decrypters. Pass the value from ContentCipher.KeySize().
+//
+// For PBES2, the iteration count ("p2c") must not exceed
+// DefaultMaxPBES2Count.
 func BuildKeyDecrypter(alg jwa.KeyEncryptionAlgorithm, h *Header, key interface{}, keysize int) (KeyDecrypter, error) {
+	return buildKeyDecrypter(alg, h, key, keysize, DefaultMaxPBES2Count)
+}
+
+func buildKeyDecrypter(alg jwa.KeyEncryptionAlgorithm, h *Header, key interface{}, keysize, maxPBES2Count int) (KeyDecrypter, error) {
 	switch alg {
 	case jwa.RSA1_5:
-		privkey, ok := key.(*rsa.PrivateKey)
+		privkey, ok := keyconv.RSAPrivateKey(key)
 		if !ok {
 			return nil, errors.New("*rsa.PrivateKey is required as the key to build this key decrypter")
 		}
 		return NewRSAPKCS15KeyDecrypt(alg, privkey, keysize/2), nil
 	case jwa.RSA_OAEP, jwa.RSA_OAEP_256:
-		privkey, ok := key.(*rsa.PrivateKey)
+		privkey, ok := keyconv.RSAPrivateKey(key)
 		if !ok {
 			return nil, errors.New("*rsa.PrivateKey is required as the key to build this key decrypter")
 		}
@@ -237,6 +571,16 @@ func BuildKeyDecrypter(alg jwa.KeyEncryptionAlgorithm, h *Header, key interface{
 			return nil, errors.New("[]byte is required as the key to build this key decrypter")
 		}
 		return NewKeyWrapEncrypt(alg, sharedkey)
+	case jwa.PBES2_HS256_A128KW, jwa.PBES2_HS384_A192KW, jwa.PBES2_HS512_A256KW:
+		password, ok := key.([]byte)
+		if !ok {
+			return nil, errors.New("[]byte is required as the key to build this key decrypter")
+		}
+		salt, count, err := pbes2HeaderParams(h)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get PBES2 parameters")
+		}
+		return newPBES2KeyDecrypt(alg, password, salt, count, maxPBES2Count)
 	case jwa.ECDH_ES_A128KW, jwa.ECDH_ES_A192KW, jwa.ECDH_ES_A256KW:
 		epkif, err := h.Get("epk")
 		if err != nil {
@@ -256,7 +600,7 @@ func BuildKeyDecrypter(alg jwa.KeyEncryptionAlgorithm, h *Header, key interface{
 			return nil, errors.Wrap(err, "failed to get public key")
 		}
 
-		privkey, ok := key.(*ecdsa.PrivateKey)
+		privkey, ok := keyconv.ECDSAPrivateKey(key)
 		if !ok {
 			return nil, errors.New("*ecdsa.PrivateKey is required as the key to build this key decrypter")
 		}
@@ -1,15 +1,30 @@
 package jwe
 
 import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
 	"testing"
 
+	"github.com/lestrrat-go/jwx/buffer"
 	"github.com/lestrrat-go/jwx/internal/rsautil"
 	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -157,7 +172,6 @@ func TestLowLevelParts_A128KW_A128CBCHS256(t *testing.T) {
 
 	msg := NewMessage()
 	msg.ProtectedHeader = protected
-	msg.AuthenticatedData = aad
 	msg.CipherText = ciphertext
 	msg.InitializationVector = iv
 	msg.Tag = tag
@@ -271,6 +285,146 @@ func TestRoundtrip_RSAES_OAEP_AES_GCM(t *testing.T) {
 	}
 }
 
+func TestRSAOAEPKeyDecrypt_MGF1Hash(t *testing.T) {
+	cek := []byte("0123456789abcdef0123456789abcdef")
+
+	t.Run("Default matches rsa.DecryptOAEP", func(t *testing.T) {
+		for alg, h := range map[jwa.KeyEncryptionAlgorithm]crypto.Hash{jwa.RSA_OAEP: crypto.SHA1, jwa.RSA_OAEP_256: crypto.SHA256} {
+			enckey, err := rsa.EncryptOAEP(h.New(), rand.Reader, &rsaPrivKey.PublicKey, cek, nil)
+			if !assert.NoError(t, err, "rsa.EncryptOAEP should succeed") {
+				return
+			}
+			expected, err := rsa.DecryptOAEP(h.New(), rand.Reader, rsaPrivKey, enckey, nil)
+			if !assert.NoError(t, err, "rsa.DecryptOAEP should succeed") {
+				return
+			}
+
+			d, err := NewRSAOAEPKeyDecrypt(alg, rsaPrivKey)
+			if !assert.NoError(t, err, "NewRSAOAEPKeyDecrypt should succeed") {
+				return
+			}
+			decrypted, err := d.KeyDecrypt(enckey)
+			if !assert.NoError(t, err, "KeyDecrypt should succeed") {
+				return
+			}
+			assert.Equal(t, expected, decrypted, "KeyDecrypt should match rsa.DecryptOAEP")
+		}
+	})
+	t.Run("Decrypt option", func(t *testing.T) {
+		encrypted, err := Encrypt([]byte(examplePayload), jwa.RSA_OAEP_256, &rsaPrivKey.PublicKey, jwa.A128GCM, jwa.NoCompress)
+		if !assert.NoError(t, err, "Encrypt should succeed") {
+			return
+		}
+
+		_, err = Decrypt(encrypted, jwa.RSA_OAEP_256, rsaPrivKey, WithOAEPMGF1Hash(crypto.SHA1))
+		assert.Error(t, err, "Decrypt should fail with a different MGF1 hash")
+
+		decrypted, err := Decrypt(encrypted, jwa.RSA_OAEP_256, rsaPrivKey, WithOAEPMGF1Hash(crypto.SHA256))
+		if !assert.NoError(t, err, "Decrypt should succeed") {
+			return
+		}
+		assert.Equal(t, []byte(examplePayload), decrypted, "Decrypt should return the payload")
+
+		for _, h := range []crypto.Hash{crypto.MD4, crypto.Hash(100)} {
+			_, err = Decrypt(encrypted, jwa.RSA_OAEP_256, rsaPrivKey, WithOAEPMGF1Hash(h))
+			assert.Error(t, err, "Decrypt should fail for unavailable hashes")
+		}
+	})
+}
+
+func TestPBES2(t *testing.T) {
+	password := []byte("correct horse battery staple")
+
+	for _, alg := range []jwa.KeyEncryptionAlgorithm{jwa.PBES2_HS256_A128KW, jwa.PBES2_HS384_A192KW, jwa.PBES2_HS512_A256KW} {
+		alg := alg
+		t.Run(alg.String(), func(t *testing.T) {
+			encrypted, err := Encrypt([]byte(examplePayload), alg, password, jwa.A128GCM, jwa.NoCompress)
+			if !assert.NoError(t, err, "Encrypt should succeed") {
+				return
+			}
+
+			decrypted, err := Decrypt(encrypted, alg, password)
+			if !assert.NoError(t, err, "Decrypt should succeed") {
+				return
+			}
+			assert.Equal(t, []byte(examplePayload), decrypted, "Decrypt should return the payload")
+
+			_, err = Decrypt(encrypted, alg, []byte("wrong password"))
+			assert.Error(t, err, "Decrypt should fail with the wrong password")
+		})
+	}
+
+	// encryptWithCount bypasses the minimum enforced by NewPBES2KeyEncrypt
+	encryptWithCount := func(count int) []byte {
+		contentcrypt, err := NewAesCrypt(jwa.A128GCM)
+		if !assert.NoError(t, err, "NewAesCrypt should succeed") {
+			t.FailNow()
+		}
+		keyenc := &PBES2KeyEncrypt{alg: jwa.PBES2_HS256_A128KW, password: password, count: count}
+		msg, err := NewMultiEncrypt(contentcrypt, NewRandomKeyGenerate(contentcrypt.KeySize()), keyenc).Encrypt([]byte(examplePayload))
+		if !assert.NoError(t, err, "Encrypt should succeed") {
+			t.FailNow()
+		}
+		encrypted, err := CompactSerialize{}.Serialize(msg)
+		if !assert.NoError(t, err, "Serialize should succeed") {
+			t.FailNow()
+		}
+		return encrypted
+	}
+
+	t.Run("Count too high", func(t *testing.T) {
+		encrypted := encryptWithCount(MinPBES2Count + 1)
+		_, err := Decrypt(encrypted, jwa.PBES2_HS256_A128KW, password, WithMaxPBES2Count(MinPBES2Count))
+		assert.Equal(t, ErrPBES2CountTooHigh, errors.Cause(err), "Decrypt should fail with ErrPBES2CountTooHigh")
+
+		encrypted = encryptWithCount(DefaultMaxPBES2Count + 1)
+		_, err = Decrypt(encrypted, jwa.PBES2_HS256_A128KW, password)
+		assert.Equal(t, ErrPBES2CountTooHigh, errors.Cause(err), "Decrypt should fail with ErrPBES2CountTooHigh by default")
+	})
+	t.Run("Count too low", func(t *testing.T) {
+		encrypted := encryptWithCount(MinPBES2Count - 1)
+		_, err := Decrypt(encrypted, jwa.PBES2_HS256_A128KW, password)
+		assert.Equal(t, ErrPBES2CountTooLow, errors.Cause(err), "Decrypt should fail with ErrPBES2CountTooLow")
+
+		_, err = NewPBES2KeyEncrypt(jwa.PBES2_HS256_A128KW, password, MinPBES2Count-1)
+		assert.Equal(t, ErrPBES2CountTooLow, errors.Cause(err), "NewPBES2KeyEncrypt should fail with ErrPBES2CountTooLow")
+	})
+	t.Run("BuildKeyDecrypter enforces the limits", func(t *testing.T) {
+		h := NewHeader()
+		h.Set("p2s", "2WCTcJZ1Rvd_CJuJripQ1w")
+		h.Set("p2c", DefaultMaxPBES2Count+1)
+		_, err := BuildKeyDecrypter(jwa.PBES2_HS256_A128KW, h, password, 0)
+		assert.Equal(t, ErrPBES2CountTooHigh, errors.Cause(err), "BuildKeyDecrypter should fail with ErrPBES2CountTooHigh")
+
+		h.Set("p2c", MinPBES2Count-1)
+		_, err = BuildKeyDecrypter(jwa.PBES2_HS256_A128KW, h, password, 0)
+		assert.Equal(t, ErrPBES2CountTooLow, errors.Cause(err), "BuildKeyDecrypter should fail with ErrPBES2CountTooLow")
+	})
+	t.Run("RFC7517 Appendix C", func(t *testing.T) {
+		h := NewHeader()
+		h.Set("p2s", "2WCTcJZ1Rvd_CJuJripQ1w")
+		h.Set("p2c", 4096)
+		k, err := BuildKeyDecrypter(jwa.PBES2_HS256_A128KW, h, []byte("Thus from my lips, by yours, my sin is purged."), 0)
+		if !assert.NoError(t, err, "BuildKeyDecrypter should succeed") {
+			return
+		}
+
+		var enckey buffer.Buffer
+		if !assert.NoError(t, enckey.Base64Decode([]byte("TrqXOwuNUfDV9VPTNbyGvEJ9JMjefAVn-TR1uIxR9p6hsRQh9Tk7BA")), "decoding the encrypted key should succeed") {
+			return
+		}
+		cek, err := k.KeyDecrypt(enckey.Bytes())
+		if !assert.NoError(t, err, "KeyDecrypt should succeed") {
+			return
+		}
+		expected := []byte{
+			111, 27, 25, 52, 66, 29, 20, 78, 92, 176, 56, 240, 65, 208, 82, 112,
+			161, 131, 36, 55, 202, 236, 185, 172, 129, 23, 153, 194, 195, 48, 253, 182,
+		}
+		assert.Equal(t, expected, cek, "content encryption key should match")
+	})
+}
+
 func TestRoundtrip_RSA1_5_A128CBC_HS256(t *testing.T) {
 	var plaintext = []byte{
 		76, 105, 118, 101, 32, 108, 111, 110, 103, 32, 97, 110, 100, 32,
@@ -391,8 +545,1417 @@ func Test_A256KW_A256CBC_HS512(t *testing.T) {
 	for i := 0; i < keysize; i++ {
 		key[i] = byte(i)
 	}
-	_, err := Encrypt([]byte(examplePayload), jwa.A256KW, key, jwa.A256CBC_HS512, jwa.NoCompress)
-	if !assert.Error(t, err, "should fail to encrypt payload") {
+	encrypted, err := Encrypt([]byte(examplePayload), jwa.A256KW, key, jwa.A256CBC_HS512, jwa.NoCompress)
+	if !assert.NoError(t, err, "Encrypt should succeed") {
+		return
+	}
+
+	decrypted, err := Decrypt(encrypted, jwa.A256KW, key)
+	if !assert.NoError(t, err, "Decrypt should succeed") {
+		return
+	}
+	assert.Equal(t, []byte(examplePayload), decrypted, "payload should match")
+}
+
+func TestEncode_KeyForms(t *testing.T) {
+	plaintext := []byte("Lorem ipsum")
+
+	ecdsakey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, "ecdsa key generated") {
+		return
+	}
+
+	testcases := []struct {
+		Name    string
+		Alg     jwa.KeyEncryptionAlgorithm
+		Encrypt interface{}
+		Decrypt interface{}
+	}{
+		{Name: "RSA pointer", Alg: jwa.RSA_OAEP, Encrypt: &rsaPrivKey.PublicKey, Decrypt: rsaPrivKey},
+		{Name: "RSA value", Alg: jwa.RSA_OAEP, Encrypt: rsaPrivKey.PublicKey, Decrypt: *rsaPrivKey},
+		{Name: "ECDSA pointer", Alg: jwa.ECDH_ES_A128KW, Encrypt: &ecdsakey.PublicKey, Decrypt: ecdsakey},
+		{Name: "ECDSA value", Alg: jwa.ECDH_ES_A128KW, Encrypt: ecdsakey.PublicKey, Decrypt: *ecdsakey},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			encrypted, err := Encrypt(plaintext, tc.Alg, tc.Encrypt, jwa.A128GCM, jwa.NoCompress)
+			if !assert.NoError(t, err, "Encrypt succeeds") {
+				return
+			}
+
+			decrypted, err := Decrypt(encrypted, tc.Alg, tc.Decrypt)
+			if !assert.NoError(t, err, "Decrypt succeeds") {
+				return
+			}
+
+			if !assert.Equal(t, plaintext, decrypted, "Decrypted payload matches") {
+				return
+			}
+		})
+	}
+}
+
+// encryptCompactA128KW creates a compact JWE message using A128KW, with
+// the raw header as the protected header
+func encryptCompactA128KW(t assert.TestingT, header string, sharedkey []byte, enc jwa.ContentEncryptionAlgorithm, plaintext []byte) (string, bool) {
+	protected, err := buffer.Buffer(header).Base64Encode()
+	if !assert.NoError(t, err, "encoding header should succeed") {
+		return "", false
+	}
+
+	contentcrypt, err := NewAesCrypt(enc)
+	if !assert.NoError(t, err, "NewAesCrypt should succeed") {
+		return "", false
+	}
+
+	cek := make([]byte, contentcrypt.KeySize())
+	if _, err := rand.Read(cek); !assert.NoError(t, err, "generating cek should succeed") {
+		return "", false
+	}
+
+	keyenc, err := NewKeyWrapEncrypt(jwa.A128KW, sharedkey)
+	if !assert.NoError(t, err, "NewKeyWrapEncrypt should succeed") {
+		return "", false
+	}
+	enckey, err := keyenc.KeyEncrypt(cek)
+	if !assert.NoError(t, err, "KeyEncrypt should succeed") {
+		return "", false
+	}
+
+	iv, ciphertext, tag, err := contentcrypt.Encrypt(cek, plaintext, protected)
+	if !assert.NoError(t, err, "Encrypt should succeed") {
+		return "", false
+	}
+
+	var parts []string
+	for _, b := range [][]byte{enckey.Bytes(), iv, ciphertext, tag} {
+		encoded, err := buffer.Buffer(b).Base64Encode()
+		if !assert.NoError(t, err, "encoding part should succeed") {
+			return "", false
+		}
+		parts = append(parts, string(encoded))
+	}
+	return string(protected) + "." + strings.Join(parts, "."), true
+}
+
+func TestRoundtrip_UnknownHeaderParameters(t *testing.T) {
+	sharedkey := []byte("0123456789abcdef")
+	plaintext := []byte(examplePayload)
+
+	// Field order is deliberately different from what our own
+	// serializer would produce
+	token, ok := encryptCompactA128KW(t, `{"vendor":"acme","enc":"A128GCM","alg":"A128KW"}`, sharedkey, jwa.A128GCM, plaintext)
+	if !ok {
+		return
+	}
+
+	msg, err := ParseString(token)
+	if !assert.NoError(t, err, "Parse should succeed") {
+		return
+	}
+
+	v, err := msg.Recipients[0].Header.Get("vendor")
+	if !assert.NoError(t, err, "Get('vendor') should succeed") {
+		return
+	}
+	if !assert.Equal(t, "acme", v, "vendor header should be preserved") {
+		return
+	}
+
+	decrypted, err := msg.Decrypt(jwa.A128KW, sharedkey)
+	if !assert.NoError(t, err, "Decrypt should succeed") {
+		return
+	}
+	if !assert.Equal(t, plaintext, decrypted, "Decrypted payload matches") {
+		return
+	}
+
+	serialized, err := CompactSerialize{}.Serialize(msg)
+	if !assert.NoError(t, err, "Serialize should succeed") {
+		return
+	}
+	if !assert.Equal(t, token, string(serialized), "Serialized message should match the original") {
+		return
+	}
+}
+
+func TestEncodedHeader_Modified(t *testing.T) {
+	sharedkey := []byte("0123456789abcdef")
+	plaintext := []byte(examplePayload)
+
+	token, ok := encryptCompactA128KW(t, `{"vendor":"acme","enc":"A128GCM","alg":"A128KW"}`, sharedkey, jwa.A128GCM, plaintext)
+	if !ok {
+		return
+	}
+
+	decodeProtected := func(t *testing.T, msg *Message) (string, bool) {
+		encoded, err := msg.ProtectedHeader.Base64Encode()
+		if !assert.NoError(t, err, "Base64Encode should succeed") {
+			return "", false
+		}
+		decoded, err := base64.RawURLEncoding.DecodeString(string(encoded))
+		if !assert.NoError(t, err, "decoding protected header should succeed") {
+			return "", false
+		}
+		return string(decoded), true
+	}
+
+	t.Run("Set", func(t *testing.T) {
+		msg, err := ParseString(token)
+		if !assert.NoError(t, err, "Parse should succeed") {
+			return
+		}
+		if !assert.NoError(t, msg.ProtectedHeader.Set("cty", "JWT"), "Set should succeed") {
+			return
+		}
+
+		decoded, ok := decodeProtected(t, msg)
+		if !ok {
+			return
+		}
+		if !assert.Contains(t, decoded, `"cty":"JWT"`, "protected header should contain the new member") {
+			return
+		}
+
+		serialized, err := CompactSerialize{}.Serialize(msg)
+		if !assert.NoError(t, err, "Serialize should succeed") {
+			return
+		}
+		assert.NotEqual(t, token, string(serialized), "Serialized message should not reuse the original header")
+	})
+	t.Run("Field", func(t *testing.T) {
+		msg, err := ParseString(token)
+		if !assert.NoError(t, err, "Parse should succeed") {
+			return
+		}
+		msg.ProtectedHeader.ContentType = "JWT"
+
+		decoded, ok := decodeProtected(t, msg)
+		if !ok {
+			return
+		}
+		assert.Contains(t, decoded, `"cty":"JWT"`, "protected header should contain the new member")
+	})
+	t.Run("Shared input", func(t *testing.T) {
+		// Spare capacity after the token must not be written to
+		buf := make([]byte, len(token), len(token)+64)
+		copy(buf, token)
+
+		msg, err := Parse(buf)
+		if !assert.NoError(t, err, "Parse should succeed") {
+			return
+		}
+		_, err = CompactSerialize{}.Serialize(msg)
+		if !assert.NoError(t, err, "Serialize should succeed") {
+			return
+		}
+		if _, err := msg.computeAAD(); !assert.NoError(t, err, "computeAAD should succeed") {
+			return
+		}
+		assert.Equal(t, make([]byte, 64), buf[len(buf):cap(buf)], "input buffer should not be modified")
+	})
+	t.Run("Unprotected algorithm", func(t *testing.T) {
+		parts := strings.Split(token, ".")
+		jsonForm := `{"protected":"` + base64.RawURLEncoding.EncodeToString([]byte(`{"enc":"A128GCM"}`)) + `",` +
+			`"header":{"alg":"A128KW"},` +
+			`"encrypted_key":"` + parts[1] + `","iv":"` + parts[2] + `","ciphertext":"` + parts[3] + `","tag":"` + parts[4] + `"}`
+		msg, err := ParseString(jsonForm)
+		if !assert.NoError(t, err, "Parse should succeed") {
+			return
+		}
+
+		_, err = CompactSerialize{}.Serialize(msg)
+		assert.Equal(t, ErrCompactUnrepresentable, errors.Cause(err), "CompactSerialize should fail with ErrCompactUnrepresentable")
+	})
+}
+
+func TestDecrypt_ECDHES_EphemeralKey(t *testing.T) {
+	plaintext := []byte("Lorem ipsum")
+	privkey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if !assert.NoError(t, err, "ecdsa key generated") {
+		return
+	}
+
+	encrypted, err := Encrypt(plaintext, jwa.ECDH_ES_A128KW, &privkey.PublicKey, jwa.A128GCM, jwa.NoCompress)
+	if !assert.NoError(t, err, "Encrypt succeeds") {
+		return
+	}
+
+	t.Run("Allowed curves", func(t *testing.T) {
+		if _, err := Decrypt(encrypted, jwa.ECDH_ES_A128KW, privkey); !assert.NoError(t, err, "Decrypt with default curves succeeds") {
+			return
+		}
+		_, err := Decrypt(encrypted, jwa.ECDH_ES_A128KW, privkey, WithAllowedCurves(jwa.P256))
+		if !assert.Equal(t, ErrCurveNotAllowed, errors.Cause(err), "Decrypt with P-384 disallowed should fail with ErrCurveNotAllowed") {
+			return
+		}
+		if _, err := Decrypt(encrypted, jwa.ECDH_ES_A128KW, privkey, WithAllowedCurves(jwa.P384)); !assert.NoError(t, err, "Decrypt with P-384 allowed succeeds") {
+			return
+		}
+	})
+	t.Run("Point not on curve", func(t *testing.T) {
+		msg, err := Parse(encrypted)
+		if !assert.NoError(t, err, "Parse succeeds") {
+			return
+		}
+
+		epk, err := msg.Recipients[0].Header.EphemeralPublicKey.Materialize()
+		if !assert.NoError(t, err, "Materialize succeeds") {
+			return
+		}
+		pubkey := epk.(*ecdsa.PublicKey)
+		pubkey.Y.Add(pubkey.Y, big.NewInt(1))
+
+		_, err = msg.Decrypt(jwa.ECDH_ES_A128KW, privkey)
+		if !assert.Equal(t, ErrInvalidEphemeralKey, errors.Cause(err), "Decrypt should fail with ErrInvalidEphemeralKey") {
+			return
+		}
+	})
+}
+
+func TestConvert(t *testing.T) {
+	plaintext := []byte(examplePayload)
+
+	compact, err := Encrypt(plaintext, jwa.RSA_OAEP, &rsaPrivKey.PublicKey, jwa.A128GCM, jwa.NoCompress)
+	if !assert.NoError(t, err, "Encrypt succeeds") {
+		return
+	}
+
+	jsonForm, err := ConvertCompactToJSON(compact)
+	if !assert.NoError(t, err, "ConvertCompactToJSON succeeds") {
+		return
+	}
+
+	decrypted, err := Decrypt(jsonForm, jwa.RSA_OAEP, rsaPrivKey)
+	if !assert.NoError(t, err, "Decrypt (JSON) succeeds") {
+		return
+	}
+	if !assert.Equal(t, plaintext, decrypted, "Decrypted payload matches") {
+		return
+	}
+
+	converted, err := ConvertJSONToCompact(jsonForm)
+	if !assert.NoError(t, err, "ConvertJSONToCompact succeeds") {
+		return
+	}
+	if !assert.Equal(t, string(compact), string(converted), "Round trip yields the original message") {
+		return
+	}
+
+	t.Run("Unrepresentable", func(t *testing.T) {
+		var m map[string]interface{}
+		if !assert.NoError(t, json.Unmarshal(jsonForm, &m), "json.Unmarshal succeeds") {
+			return
+		}
+
+		testcases := map[string]func(map[string]interface{}){
+			"aad":         func(m map[string]interface{}) { m["aad"] = "" },
+			"unprotected": func(m map[string]interface{}) { m["unprotected"] = map[string]interface{}{"kid": "foo"} },
+			"header":      func(m map[string]interface{}) { m["header"] = map[string]interface{}{"kid": "foo"} },
+			"recipients": func(m map[string]interface{}) {
+				r := map[string]interface{}{"encrypted_key": m["encrypted_key"]}
+				delete(m, "encrypted_key")
+				m["recipients"] = []interface{}{r, r}
+			},
+		}
+		for name, mutate := range testcases {
+			mutated := map[string]interface{}{}
+			for k, v := range m {
+				mutated[k] = v
+			}
+			mutate(mutated)
+
+			buf, err := json.Marshal(mutated)
+			if !assert.NoError(t, err, "json.Marshal succeeds") {
+				return
+			}
+			_, err = ConvertJSONToCompact(buf)
+			if !assert.Equal(t, ErrCompactUnrepresentable, errors.Cause(err), "ConvertJSONToCompact should fail ("+name+")") {
+				return
+			}
+		}
+	})
+}
+
+func TestParse_MissingAlgorithm(t *testing.T) {
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	testcases := []struct {
+		Header   string
+		Expected error
+	}{
+		{Header: `{"enc":"A128GCM"}`, Expected: ErrMissingAlgorithm},
+		{Header: `{"alg":"A128KW"}`, Expected: ErrMissingContentEncryption},
+	}
+
+	for _, tc := range testcases {
+		compact := encode(tc.Header) + ".AAAA.AAAA.AAAA.AAAA"
+		_, err := ParseString(compact)
+		if !assert.Equal(t, tc.Expected, errors.Cause(err), "Parse (compact) should fail for "+tc.Header) {
+			return
+		}
+
+		_, err = Decrypt([]byte(compact), jwa.A128KW, []byte("0123456789abcdef"))
+		if !assert.Equal(t, tc.Expected, errors.Cause(err), "Decrypt should fail for "+tc.Header) {
+			return
+		}
+
+		flattened := `{"protected":"` + encode(tc.Header) + `","encrypted_key":"AAAA","iv":"AAAA","ciphertext":"AAAA","tag":"AAAA"}`
+		_, err = ParseString(flattened)
+		if !assert.Equal(t, tc.Expected, errors.Cause(err), "Parse (JSON) should fail for "+tc.Header) {
+			return
+		}
+	}
+}
+
+func TestEncryptWithHeader(t *testing.T) {
+	plaintext := []byte(examplePayload)
+
+	t.Run("RSA-OAEP with private parameters", func(t *testing.T) {
+		h := NewHeader()
+		h.Set("alg", jwa.RSA_OAEP)
+		h.Set("enc", jwa.A256GCM)
+		h.Set("kid", "my-key")
+		h.Set("vendor", "acme")
+
+		encrypted, err := EncryptWithHeader(plaintext, &rsaPrivKey.PublicKey, h)
+		if !assert.NoError(t, err, "EncryptWithHeader succeeds") {
+			return
+		}
+
+		msg, err := Parse(encrypted)
+		if !assert.NoError(t, err, "Parse succeeds") {
+			return
+		}
+		if !assert.Equal(t, "my-key", msg.Recipients[0].Header.KeyID, "kid should be preserved") {
+			return
+		}
+		v, err := msg.Recipients[0].Header.Get("vendor")
+		if !assert.NoError(t, err, "Get('vendor') succeeds") {
+			return
+		}
+		if !assert.Equal(t, "acme", v, "vendor should be preserved") {
+			return
+		}
+
+		decrypted, err := msg.Decrypt(jwa.RSA_OAEP, rsaPrivKey)
+		if !assert.NoError(t, err, "Decrypt succeeds") {
+			return
+		}
+		if !assert.Equal(t, plaintext, decrypted, "Decrypted payload matches") {
+			return
+		}
+	})
+	t.Run("ECDH-ES with apu/apv", func(t *testing.T) {
+		privkey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if !assert.NoError(t, err, "ecdsa key generated") {
+			return
+		}
+
+		h := NewHeader()
+		h.Set("alg", jwa.ECDH_ES_A128KW)
+		h.Set("enc", jwa.A128CBC_HS256)
+		h.Set("apu", buffer.Buffer("Alice"))
+		h.Set("apv", buffer.Buffer("Bob"))
+
+		encrypted, err := EncryptWithHeader(plaintext, &privkey.PublicKey, h)
+		if !assert.NoError(t, err, "EncryptWithHeader succeeds") {
+			return
+		}
+
+		decrypted, err := Decrypt(encrypted, jwa.ECDH_ES_A128KW, privkey)
+		if !assert.NoError(t, err, "Decrypt succeeds") {
+			return
+		}
+		if !assert.Equal(t, plaintext, decrypted, "Decrypted payload matches") {
+			return
+		}
+	})
+	t.Run("Invalid headers", func(t *testing.T) {
+		h := NewHeader()
+		h.Set("enc", jwa.A128GCM)
+		_, err := EncryptWithHeader(plaintext, &rsaPrivKey.PublicKey, h)
+		if !assert.Equal(t, ErrMissingAlgorithm, err, "missing alg should fail") {
+			return
+		}
+
+		h = NewHeader()
+		h.Set("alg", jwa.RSA_OAEP)
+		_, err = EncryptWithHeader(plaintext, &rsaPrivKey.PublicKey, h)
+		if !assert.Equal(t, ErrMissingContentEncryption, err, "missing enc should fail") {
+			return
+		}
+
+		_, err = EncryptWithHeader(plaintext, &rsaPrivKey.PublicKey, nil)
+		if !assert.Error(t, err, "nil header should fail") {
+			return
+		}
+	})
+}
+
+func TestDecrypt_DraftContentEncryption(t *testing.T) {
+	sharedkey := []byte("0123456789abcdef")
+	plaintext := []byte(examplePayload)
+
+	// Pre-final drafts of JWA used a different key derivation and MAC
+	// for these algorithms, so they must not be treated as aliases.
+	// The content is encrypted with A128CBC-HS256, but it is never
+	// decrypted: the draft names are rejected first
+	for _, name := range []string{"A128CBC+HS256", "A192CBC+HS384", "A256CBC+HS512"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			token, ok := encryptCompactA128KW(t, `{"alg":"A128KW","enc":"`+name+`"}`, sharedkey, jwa.A128CBC_HS256, plaintext)
+			if !ok {
+				return
+			}
+
+			_, err := Decrypt([]byte(token), jwa.A128KW, sharedkey)
+			if !assert.Error(t, err, "Decrypt should fail") {
+				return
+			}
+			assert.Equal(t, ErrUnsupportedAlgorithm, errors.Cause(err), "error should be ErrUnsupportedAlgorithm")
+		})
+	}
+}
+
+func TestDecryptError(t *testing.T) {
+	plaintext := []byte(examplePayload)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, "RSA key generated") {
 		return
 	}
+
+	t.Run("Single recipient", func(t *testing.T) {
+		encrypted, err := Encrypt(plaintext, jwa.RSA_OAEP, &rsaPrivKey.PublicKey, jwa.A128GCM, jwa.NoCompress)
+		if !assert.NoError(t, err, "Encrypt succeeds") {
+			return
+		}
+
+		_, err = Decrypt(encrypted, jwa.RSA_OAEP, otherKey)
+		derr, ok := err.(*DecryptError)
+		if !assert.True(t, ok, "error should be a DecryptError") {
+			return
+		}
+		if !assert.Equal(t, 0, derr.RecipientIndex, "RecipientIndex should be 0") {
+			return
+		}
+		if !assert.Equal(t, jwa.RSA_OAEP, derr.Alg, "Alg should be RSA-OAEP") {
+			return
+		}
+	})
+	t.Run("Multiple recipients", func(t *testing.T) {
+		contentcrypt, err := NewAesCrypt(jwa.A128GCM)
+		if !assert.NoError(t, err, "NewAesCrypt succeeds") {
+			return
+		}
+
+		var encrypters []KeyEncrypter
+		for _, key := range []*rsa.PrivateKey{rsaPrivKey, otherKey} {
+			keyenc, err := NewRSAOAEPKeyEncrypt(jwa.RSA_OAEP, &key.PublicKey)
+			if !assert.NoError(t, err, "NewRSAOAEPKeyEncrypt succeeds") {
+				return
+			}
+			encrypters = append(encrypters, keyenc)
+		}
+
+		msg, err := NewMultiEncrypt(contentcrypt, NewRandomKeyGenerate(contentcrypt.KeySize()), encrypters...).Encrypt(plaintext)
+		if !assert.NoError(t, err, "Encrypt succeeds") {
+			return
+		}
+
+		serialized, err := JSONSerialize{}.Serialize(msg)
+		if !assert.NoError(t, err, "JSONSerialize succeeds") {
+			return
+		}
+
+		decrypted, err := Decrypt(serialized, jwa.RSA_OAEP, otherKey)
+		if !assert.NoError(t, err, "Decrypt with the second key succeeds") {
+			return
+		}
+		if !assert.Equal(t, plaintext, decrypted, "Decrypted payload matches") {
+			return
+		}
+
+		thirdKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if !assert.NoError(t, err, "RSA key generated") {
+			return
+		}
+
+		_, err = Decrypt(serialized, jwa.RSA_OAEP, thirdKey)
+		derrs, ok := err.(DecryptErrors)
+		if !assert.True(t, ok, "error should be DecryptErrors") {
+			return
+		}
+		if !assert.Len(t, derrs, 2, "there should be an error for each recipient") {
+			return
+		}
+		for i, derr := range derrs {
+			if !assert.Equal(t, i, derr.RecipientIndex, "RecipientIndex should match") {
+				return
+			}
+		}
+
+		if !assert.Equal(t, errors.Cause(derrs[0]), errors.Cause(err), "errors.Cause should follow the first recipient") {
+			return
+		}
+	})
+}
+
+func TestTagSize(t *testing.T) {
+	expected := map[jwa.ContentEncryptionAlgorithm]int{
+		jwa.A128GCM:       16,
+		jwa.A192GCM:       16,
+		jwa.A256GCM:       16,
+		jwa.A128CBC_HS256: 16,
+		jwa.A192CBC_HS384: 24,
+		jwa.A256CBC_HS512: 32,
+	}
+	for enc, size := range expected {
+		assert.Equal(t, size, enc.TagSize(), "tag size should match RFC 7518")
+	}
+
+	sharedkey := []byte("Lorem ipsum dolo")
+	for enc := range expected {
+		enc := enc
+		t.Run(enc.String(), func(t *testing.T) {
+			encrypted, err := Encrypt([]byte(examplePayload), jwa.A128KW, sharedkey, enc, jwa.NoCompress)
+			if !assert.NoError(t, err, "Encrypt should succeed") {
+				return
+			}
+
+			msg, err := Parse(encrypted)
+			if !assert.NoError(t, err, "Parse should succeed") {
+				return
+			}
+			if !assert.Len(t, msg.Tag.Bytes(), enc.TagSize(), "tag length should match") {
+				return
+			}
+
+			decrypted, err := msg.Decrypt(jwa.A128KW, sharedkey)
+			if !assert.NoError(t, err, "Decrypt should succeed") {
+				return
+			}
+			assert.Equal(t, []byte(examplePayload), decrypted, "payload should match")
+		})
+	}
+}
+
+// Messages created by earlier versions of this package use 16 byte
+// AES CBC HMAC tags for every key size, and A*KW wrapped CEKs that are
+// twice as long as they should be. They must still decrypt
+func TestDecrypt_LegacyCBCTag(t *testing.T) {
+	const payload = `Lorem ipsum`
+	t.Run("A128KW/A128CBC-HS256", func(t *testing.T) {
+		const serialized = `eyJhbGciOiJBMTI4S1ciLCJlbmMiOiJBMTI4Q0JDLUhTMjU2In0.Kciw1gRN4Of0qnhos0zXKRlRO2uURY31Kt5FDqDEVPM3fdF-HioFag7findgfKC4tBvtYtp2GQy_ppq-yfzDGuuhgEzBJMs8.BiEDtbi6m2xPwku5dxo8hQ.A--fEW-4S448P_42OpUnKQ.lQ_XTH-hoIhDsvCKBxkZJQ`
+		decrypted, err := Decrypt([]byte(serialized), jwa.A128KW, []byte("0123456789abcdef"))
+		if !assert.NoError(t, err, "Decrypt should succeed") {
+			return
+		}
+		assert.Equal(t, payload, string(decrypted), "payload should match")
+	})
+	t.Run("RSA-OAEP/A192CBC-HS384", func(t *testing.T) {
+		const serialized = `eyJhbGciOiJSU0EtT0FFUCIsImVuYyI6IkExOTJDQkMtSFMzODQifQ.EWsxFxYfe3Y9IsPH1QA1LHTQshjMxZBvAchgjEbuRhJtxQFE0oz821me_VdbDv01A2sXv9nBfSmgr-SmgA8LbLmAr8D_FQ-tsbYxO-Q6n01afAZSa6lRQxnz4XiNlcVkuV6Jj3F2rW01yaMKJq-5OfYkDmyhqfjMyjHOEstrbBvEKuXUj6k1Ou2XDpPHsV04-QSOurbSx6wiJJqLIigldHbUdo3mDxePgRubd3BSG1SyF584F7itkLrHSsQGRtCuXXRY5hWYo6bsZAeHiq6KbuUAeyNWc7MkLOx-wmQrU51Ta-FaPdFHczgGITp1SCf25O4-9azBatLI84e_LTxL8w.tPJWfdnHGwLv7L8PptiPxA.w4F9hCLzgloAD2H74M0-mA.jWkydaxVv4dpQLg3-_bo_Q`
+		decrypted, err := Decrypt([]byte(serialized), jwa.RSA_OAEP, rsaPrivKey)
+		if !assert.NoError(t, err, "Decrypt should succeed") {
+			return
+		}
+		assert.Equal(t, payload, string(decrypted), "payload should match")
+	})
+	t.Run("RSA-OAEP/A256CBC-HS512", func(t *testing.T) {
+		const serialized = `eyJhbGciOiJSU0EtT0FFUCIsImVuYyI6IkEyNTZDQkMtSFM1MTIifQ.l9Bgq_wCANNM8B1w79mvbdyhRqlX4ecTMq-Z4NDqBzzPjwGEbaz-f0zvvsTLciZZ3lGJYP3lrflF076YJUjY1SjNCAuwke7CebXLQYLm2KQ8R_g0tx1ZLeItp1B-0LPylcQoXwlqWgEKdsPyHchDRshOKEvKYoiVdmcraxa_qUAYbCxt_lQPF18Cfs1Mu5e2D3zfsCFpcO2y6LwhJ1_mjznBs-QotsXlSfll54srzF-6plfcNELA1ihKx7-np2qSIT1Vghvc7oHx7_QJsxPFA3xg9Itxp8HON9bSN7-8espYcCPYDLW1dh09mLu2jRvw4tixqZ24t_5qSgU6IHoiLQ.yB704MbTTvFNa9W0jQUF4Q.fJgY0cfqTHUDTGLFqsPaKA.H-iu6w5N8LTGglHnw6DC8g`
+		decrypted, err := Decrypt([]byte(serialized), jwa.RSA_OAEP, rsaPrivKey)
+		if !assert.NoError(t, err, "Decrypt should succeed") {
+			return
+		}
+		assert.Equal(t, payload, string(decrypted), "payload should match")
+	})
+}
+
+func TestRecipient_CanDecryptWith(t *testing.T) {
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, "RSA key generated") {
+		return
+	}
+	eckey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, "ECDSA key generated") {
+		return
+	}
+
+	recipient := func(alg jwa.KeyEncryptionAlgorithm, kid string) *Recipient {
+		r := NewRecipient()
+		r.Header.Algorithm = alg
+		r.Header.KeyID = kid
+		return r
+	}
+
+	assert.True(t, recipient(jwa.RSA_OAEP, "").CanDecryptWith(rsakey), "RSA key should be usable for RSA-OAEP")
+	assert.True(t, recipient(jwa.RSA1_5, "").CanDecryptWith(*rsakey), "RSA key value should be usable for RSA1_5")
+	assert.False(t, recipient(jwa.RSA_OAEP, "").CanDecryptWith(eckey), "ECDSA key should not be usable for RSA-OAEP")
+	assert.False(t, recipient(jwa.RSA_OAEP, "").CanDecryptWith(&rsakey.PublicKey), "RSA public key should not be usable")
+	assert.True(t, recipient(jwa.ECDH_ES_A128KW, "").CanDecryptWith(eckey), "ECDSA key should be usable for ECDH-ES+A128KW")
+	assert.True(t, recipient(jwa.A128KW, "").CanDecryptWith(make([]byte, 16)), "16 byte key should be usable for A128KW")
+	assert.False(t, recipient(jwa.A256KW, "").CanDecryptWith(make([]byte, 16)), "16 byte key should not be usable for A256KW")
+
+	jwkKey, err := jwk.New(rsakey)
+	if !assert.NoError(t, err, "jwk.New should succeed") {
+		return
+	}
+	jwkKey.Set(jwk.KeyIDKey, "key-1")
+	assert.True(t, recipient(jwa.RSA_OAEP, "key-1").CanDecryptWith(jwkKey), "matching kid should be usable")
+	assert.False(t, recipient(jwa.RSA_OAEP, "key-2").CanDecryptWith(jwkKey), "mismatching kid should not be usable")
+}
+
+func TestParse_TrailingData(t *testing.T) {
+	sharedkey := []byte("Lorem ipsum dolo")
+	encrypted, err := Encrypt([]byte(examplePayload), jwa.A128KW, sharedkey, jwa.A128GCM, jwa.NoCompress)
+	if !assert.NoError(t, err, "Encrypt should succeed") {
+		return
+	}
+	token := string(encrypted)
+
+	inputs := map[string]string{
+		"Trailing dot":                      token + ".",
+		"Concatenated tokens":               token + token,
+		"Concatenated tokens with space":    token + " " + token,
+		"Trailing garbage after whitespace": token + "\n garbage",
+	}
+	for name, input := range inputs {
+		input := input
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseString(input)
+			assert.Equal(t, ErrTrailingData, errors.Cause(err), "Parse should fail with ErrTrailingData")
+		})
+	}
+
+	_, err = ParseString(token + "\n")
+	assert.NoError(t, err, "trailing whitespace should be allowed")
+}
+
+func TestParse_CompactHeaderSplit(t *testing.T) {
+	const header = `{"alg":"A128KW","enc":"A128GCM","kid":"my-key","zip":"DEF"}`
+	sharedkey := []byte("Lorem ipsum dolo")
+
+	var compressed bytes.Buffer
+	w, _ := flate.NewWriter(&compressed, flate.DefaultCompression)
+	w.Write([]byte(examplePayload))
+	w.Close()
+
+	compact, ok := encryptCompactA128KW(t, header, sharedkey, jwa.A128GCM, compressed.Bytes())
+	if !ok {
+		return
+	}
+
+	fromCompact, err := ParseString(compact)
+	if !assert.NoError(t, err, "Parse (compact) should succeed") {
+		return
+	}
+
+	parts := strings.Split(compact, ".")
+	jsonForm := `{"protected":"` + base64.RawURLEncoding.EncodeToString([]byte(`{"enc":"A128GCM","zip":"DEF"}`)) + `",` +
+		`"header":{"alg":"A128KW","kid":"my-key"},` +
+		`"encrypted_key":"` + parts[1] + `","iv":"` + parts[2] + `","ciphertext":"` + parts[3] + `","tag":"` + parts[4] + `"}`
+	fromJSON, err := ParseString(jsonForm)
+	if !assert.NoError(t, err, "Parse (JSON) should succeed") {
+		return
+	}
+
+	if !assert.Equal(t, fromJSON.ProtectedHeader.Header, fromCompact.ProtectedHeader.Header, "protected headers should be equivalent") {
+		return
+	}
+	if !assert.Len(t, fromCompact.Recipients, 1, "there should be one recipient") {
+		return
+	}
+	if !assert.Equal(t, fromJSON.Recipients[0].Header, fromCompact.Recipients[0].Header, "recipient headers should be equivalent") {
+		return
+	}
+
+	decrypted, err := fromCompact.Decrypt(jwa.A128KW, sharedkey)
+	if !assert.NoError(t, err, "Decrypt should succeed") {
+		return
+	}
+	assert.Equal(t, []byte(examplePayload), decrypted, "payload should be decompressed")
+}
+
+func TestMessage_Algorithms(t *testing.T) {
+	// protected: {"enc":"A256GCM","zip":"DEF"}
+	const src = `{"protected":"eyJlbmMiOiJBMjU2R0NNIiwiemlwIjoiREVGIn0",` +
+		`"unprotected":{"alg":"RSA-OAEP"},` +
+		`"recipients":[{"header":{"alg":"A128KW"},"encrypted_key":"AAAA"},{"encrypted_key":"AAAA"}],` +
+		`"iv":"AAAA","ciphertext":"AAAA","tag":"AAAA"}`
+
+	msg, err := ParseString(src)
+	if !assert.NoError(t, err, "Parse should succeed") {
+		return
+	}
+
+	keyAlgs, enc := msg.Algorithms()
+	assert.Equal(t, []jwa.KeyEncryptionAlgorithm{jwa.A128KW, jwa.RSA_OAEP}, keyAlgs, "key algorithms should match")
+	assert.Equal(t, jwa.A256GCM, enc, "content encryption algorithm should match")
+	assert.Equal(t, jwa.Deflate, msg.Compression(), "compression algorithm should match")
+}
+
+func TestNilKey(t *testing.T) {
+	var rsakey *rsa.PublicKey
+	for _, key := range []interface{}{nil, rsakey} {
+		_, err := Encrypt([]byte("Lorem ipsum"), jwa.RSA_OAEP, key, jwa.A128GCM, jwa.NoCompress)
+		if !assert.Equal(t, ErrNilKey, errors.Cause(err), "Encrypt should fail with ErrNilKey") {
+			return
+		}
+
+		h := NewHeader()
+		h.Set("alg", jwa.RSA_OAEP)
+		h.Set("enc", jwa.A128GCM)
+		_, err = EncryptWithHeader([]byte("Lorem ipsum"), key, h)
+		if !assert.Equal(t, ErrNilKey, errors.Cause(err), "EncryptWithHeader should fail with ErrNilKey") {
+			return
+		}
+
+		_, err = Decrypt([]byte(`{}`), jwa.RSA_OAEP, key)
+		if !assert.Equal(t, ErrNilKey, errors.Cause(err), "Decrypt should fail with ErrNilKey") {
+			return
+		}
+	}
+}
+
+func TestMessage_SetAAD(t *testing.T) {
+	plaintext := []byte("Lorem ipsum")
+	aad := []byte("additional authenticated data")
+
+	contentcrypt, err := NewAesCrypt(jwa.A128GCM)
+	if !assert.NoError(t, err, "NewAesCrypt succeeds") {
+		return
+	}
+	keyenc, err := NewRSAOAEPKeyEncrypt(jwa.RSA_OAEP, &rsaPrivKey.PublicKey)
+	if !assert.NoError(t, err, "NewRSAOAEPKeyEncrypt succeeds") {
+		return
+	}
+
+	msg, err := NewMultiEncrypt(contentcrypt, NewRandomKeyGenerate(contentcrypt.KeySize()), keyenc).EncryptWithAAD(plaintext, aad)
+	if !assert.NoError(t, err, "EncryptWithAAD succeeds") {
+		return
+	}
+
+	_, err = CompactSerialize{}.Serialize(msg)
+	if !assert.Equal(t, ErrCompactUnrepresentable, errors.Cause(err), "CompactSerialize should fail with ErrCompactUnrepresentable") {
+		return
+	}
+
+	serialized, err := JSONSerialize{}.Serialize(msg)
+	if !assert.NoError(t, err, "JSONSerialize succeeds") {
+		return
+	}
+
+	parsed, err := Parse(serialized)
+	if !assert.NoError(t, err, "Parse succeeds") {
+		return
+	}
+	if !assert.Equal(t, aad, parsed.AuthenticatedData.Bytes(), "AAD should round-trip") {
+		return
+	}
+
+	decrypted, err := parsed.Decrypt(jwa.RSA_OAEP, rsaPrivKey)
+	if !assert.NoError(t, err, "Decrypt succeeds") {
+		return
+	}
+	if !assert.Equal(t, plaintext, decrypted, "Decrypted payload matches") {
+		return
+	}
+
+	// The AAD is authenticated: changing it must be detected
+	parsed.SetAAD([]byte("tampered"))
+	_, err = parsed.Decrypt(jwa.RSA_OAEP, rsaPrivKey)
+	assert.Error(t, err, "Decrypt should fail for modified AAD")
+}
+
+func TestMessage_EmptyAAD(t *testing.T) {
+	plaintext := []byte("Lorem ipsum")
+
+	contentcrypt, err := NewAesCrypt(jwa.A128GCM)
+	if !assert.NoError(t, err, "NewAesCrypt succeeds") {
+		return
+	}
+	keyenc, err := NewRSAOAEPKeyEncrypt(jwa.RSA_OAEP, &rsaPrivKey.PublicKey)
+	if !assert.NoError(t, err, "NewRSAOAEPKeyEncrypt succeeds") {
+		return
+	}
+	encrypter := NewMultiEncrypt(contentcrypt, NewRandomKeyGenerate(contentcrypt.KeySize()), keyenc)
+
+	t.Run("absent", func(t *testing.T) {
+		msg, err := encrypter.EncryptWithAAD(plaintext, nil)
+		if !assert.NoError(t, err, "EncryptWithAAD succeeds") {
+			return
+		}
+		assert.False(t, msg.HasAAD(), "message should have no AAD")
+
+		serialized, err := JSONSerialize{}.Serialize(msg)
+		if !assert.NoError(t, err, "JSONSerialize succeeds") {
+			return
+		}
+		assert.NotContains(t, string(serialized), `"aad"`, "aad member should be omitted")
+
+		parsed, err := Parse(serialized)
+		if !assert.NoError(t, err, "Parse succeeds") {
+			return
+		}
+		assert.False(t, parsed.HasAAD(), "parsed message should have no AAD")
+
+		_, err = CompactSerialize{}.Serialize(msg)
+		assert.NoError(t, err, "CompactSerialize succeeds")
+	})
+	t.Run("null", func(t *testing.T) {
+		msg, err := encrypter.EncryptWithAAD(plaintext, nil)
+		if !assert.NoError(t, err, "EncryptWithAAD succeeds") {
+			return
+		}
+
+		serialized, err := JSONSerialize{}.Serialize(msg)
+		if !assert.NoError(t, err, "JSONSerialize succeeds") {
+			return
+		}
+
+		var m map[string]interface{}
+		if !assert.NoError(t, json.Unmarshal(serialized, &m), "json.Unmarshal succeeds") {
+			return
+		}
+		m["aad"] = nil
+		serialized, err = json.Marshal(m)
+		if !assert.NoError(t, err, "json.Marshal succeeds") {
+			return
+		}
+
+		parsed, err := Parse(serialized)
+		if !assert.NoError(t, err, "Parse succeeds") {
+			return
+		}
+		assert.False(t, parsed.HasAAD(), "null aad should be treated as absent")
+
+		decrypted, err := parsed.Decrypt(jwa.RSA_OAEP, rsaPrivKey)
+		if !assert.NoError(t, err, "Decrypt succeeds") {
+			return
+		}
+		assert.Equal(t, plaintext, decrypted, "Decrypted payload matches")
+	})
+	t.Run("empty", func(t *testing.T) {
+		msg, err := encrypter.EncryptWithAAD(plaintext, []byte{})
+		if !assert.NoError(t, err, "EncryptWithAAD succeeds") {
+			return
+		}
+		assert.True(t, msg.HasAAD(), "message should have an empty AAD")
+
+		_, err = CompactSerialize{}.Serialize(msg)
+		assert.Equal(t, ErrCompactUnrepresentable, errors.Cause(err), "CompactSerialize should fail with ErrCompactUnrepresentable")
+
+		serialized, err := JSONSerialize{}.Serialize(msg)
+		if !assert.NoError(t, err, "JSONSerialize succeeds") {
+			return
+		}
+		assert.Contains(t, string(serialized), `"aad":""`, "aad member should be an empty string")
+
+		parsed, err := Parse(serialized)
+		if !assert.NoError(t, err, "Parse succeeds") {
+			return
+		}
+		assert.True(t, parsed.HasAAD(), "parsed message should have an empty AAD")
+
+		decrypted, err := parsed.Decrypt(jwa.RSA_OAEP, rsaPrivKey)
+		if !assert.NoError(t, err, "Decrypt succeeds") {
+			return
+		}
+		assert.Equal(t, plaintext, decrypted, "Decrypted payload matches")
+
+		// The presence of the empty AAD is authenticated
+		parsed.SetAAD(nil)
+		_, err = parsed.Decrypt(jwa.RSA_OAEP, rsaPrivKey)
+		assert.Error(t, err, "Decrypt should fail when the empty AAD is removed")
+	})
+}
+
+func TestEncryptPEM(t *testing.T) {
+	plaintext := []byte("Lorem ipsum")
+	pubkey, err := x509.MarshalPKIXPublicKey(&rsaPrivKey.PublicKey)
+	if !assert.NoError(t, err, "x509.MarshalPKIXPublicKey should succeed") {
+		return
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubkey})
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaPrivKey)})
+
+	encrypted, err := EncryptPEM(plaintext, jwa.RSA_OAEP, pubPEM, jwa.A128GCM, jwa.NoCompress)
+	if !assert.NoError(t, err, "EncryptPEM should succeed") {
+		return
+	}
+
+	decrypted, err := DecryptPEM(encrypted, jwa.RSA_OAEP, privPEM)
+	if !assert.NoError(t, err, "DecryptPEM should succeed") {
+		return
+	}
+	assert.Equal(t, plaintext, decrypted, "Decrypted payload matches")
+
+	_, err = DecryptPEM(encrypted, jwa.RSA_OAEP, pubPEM)
+	assert.Error(t, err, "DecryptPEM should fail with a public key")
+
+	_, err = EncryptPEM(plaintext, jwa.ECDH_ES, pubPEM, jwa.A128GCM, jwa.NoCompress)
+	assert.Error(t, err, "EncryptPEM should fail for mismatching key type")
+}
+
+func TestDecryptAttemptsLimit(t *testing.T) {
+	plaintext := []byte("Lorem ipsum")
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, "RSA key generated") {
+		return
+	}
+
+	contentcrypt, err := NewAesCrypt(jwa.A128GCM)
+	if !assert.NoError(t, err, "NewAesCrypt succeeds") {
+		return
+	}
+	var encrypters []KeyEncrypter
+	for _, key := range []*rsa.PrivateKey{rsaPrivKey, otherKey} {
+		keyenc, err := NewRSAOAEPKeyEncrypt(jwa.RSA_OAEP, &key.PublicKey)
+		if !assert.NoError(t, err, "NewRSAOAEPKeyEncrypt succeeds") {
+			return
+		}
+		encrypters = append(encrypters, keyenc)
+	}
+	msg, err := NewMultiEncrypt(contentcrypt, NewRandomKeyGenerate(contentcrypt.KeySize()), encrypters...).Encrypt(plaintext)
+	if !assert.NoError(t, err, "Encrypt succeeds") {
+		return
+	}
+	serialized, err := JSONSerialize{}.Serialize(msg)
+	if !assert.NoError(t, err, "JSONSerialize succeeds") {
+		return
+	}
+
+	t.Run("Decrypt", func(t *testing.T) {
+		// The key only matches the second recipient
+		_, err := Decrypt(serialized, jwa.RSA_OAEP, otherKey, WithMaxDecryptAttempts(1))
+		if !assert.Equal(t, ErrTooManyDecryptAttempts, errors.Cause(err), "Decrypt should fail with ErrTooManyDecryptAttempts") {
+			return
+		}
+
+		decrypted, err := Decrypt(serialized, jwa.RSA_OAEP, otherKey, WithMaxDecryptAttempts(2))
+		if !assert.NoError(t, err, "Decrypt succeeds") {
+			return
+		}
+		assert.Equal(t, plaintext, decrypted, "Decrypted payload matches")
+	})
+	t.Run("DecryptWithSet", func(t *testing.T) {
+		unrelated, err := rsa.GenerateKey(rand.Reader, 2048)
+		if !assert.NoError(t, err, "RSA key generated") {
+			return
+		}
+
+		var set jwk.Set
+		for _, key := range []*rsa.PrivateKey{unrelated, otherKey} {
+			k, err := jwk.New(key)
+			if !assert.NoError(t, err, "jwk.New succeeds") {
+				return
+			}
+			set.Keys = append(set.Keys, k)
+		}
+
+		decrypted, err := DecryptWithSet(serialized, &set)
+		if !assert.NoError(t, err, "DecryptWithSet succeeds") {
+			return
+		}
+		if !assert.Equal(t, plaintext, decrypted, "Decrypted payload matches") {
+			return
+		}
+
+		// unrelated key x 2 recipients, then the first recipient for otherKey
+		_, err = DecryptWithSet(serialized, &set, WithMaxDecryptAttempts(3))
+		assert.Equal(t, ErrTooManyDecryptAttempts, errors.Cause(err), "DecryptWithSet should fail with ErrTooManyDecryptAttempts")
+
+		// Keys that may not be used for decryption are not even attempted
+		set.Keys[0].Set(jwk.KeyOpsKey, []string{string(jwk.KeyOpSign)})
+		set.Keys[0].Set(jwk.KeyUsageKey, "sig")
+		_, err = DecryptWithSet(serialized, &set, WithMaxDecryptAttempts(3))
+		if !assert.NoError(t, err, "DecryptWithSet should skip the unrelated key") {
+			return
+		}
+
+		set.Keys[1].Set(jwk.KeyOpsKey, []string{string(jwk.KeyOpSign)})
+		_, err = DecryptWithSet(serialized, &set)
+		if !assert.Error(t, err, "key with key_ops [sign] should be skipped") {
+			return
+		}
+
+		set.Keys[1].Set(jwk.KeyOpsKey, []string{jwk.KeyOpUnwrapKey})
+		_, err = DecryptWithSet(serialized, &set)
+		assert.NoError(t, err, "key with key_ops [unwrapKey] should be used")
+	})
+}
+
+func deflate(t assert.TestingT, payload []byte) ([]byte, bool) {
+	var compressed bytes.Buffer
+	w, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if !assert.NoError(t, err, "flate.NewWriter should succeed") {
+		return nil, false
+	}
+	if _, err := w.Write(payload); !assert.NoError(t, err, "compressing should succeed") {
+		return nil, false
+	}
+	if !assert.NoError(t, w.Close(), "closing flate writer should succeed") {
+		return nil, false
+	}
+	return compressed.Bytes(), true
+}
+
+func TestInflate(t *testing.T) {
+	const header = `{"alg":"A128KW","enc":"A128GCM","zip":"DEF"}`
+	sharedkey := []byte("Lorem ipsum dolo")
+
+	// Highly compressible payload, several times larger than
+	// the maximum growth of the output buffer
+	payload := bytes.Repeat([]byte(examplePayload), 64*1024)
+	compressed, ok := deflate(t, payload)
+	if !ok {
+		return
+	}
+
+	compact, ok := encryptCompactA128KW(t, header, sharedkey, jwa.A128GCM, compressed)
+	if !ok {
+		return
+	}
+
+	t.Run("Within limit", func(t *testing.T) {
+		decrypted, err := Decrypt([]byte(compact), jwa.A128KW, sharedkey)
+		if !assert.NoError(t, err, "Decrypt should succeed") {
+			return
+		}
+		assert.Equal(t, payload, decrypted, "payload should match")
+	})
+	t.Run("Exactly at limit", func(t *testing.T) {
+		decrypted, err := Decrypt([]byte(compact), jwa.A128KW, sharedkey, WithMaxDecompressedSize(int64(len(payload))))
+		if !assert.NoError(t, err, "Decrypt should succeed") {
+			return
+		}
+		assert.Equal(t, payload, decrypted, "payload should match")
+	})
+	t.Run("Exceeds limit", func(t *testing.T) {
+		_, err := Decrypt([]byte(compact), jwa.A128KW, sharedkey, WithMaxDecompressedSize(int64(len(payload)-1)))
+		assert.Equal(t, ErrDecompressedSizeExceeded, errors.Cause(err), "Decrypt should fail with ErrDecompressedSizeExceeded")
+	})
+	t.Run("Invalid limit", func(t *testing.T) {
+		for _, limit := range []int64{0, -1} {
+			_, err := Decrypt([]byte(compact), jwa.A128KW, sharedkey, WithMaxDecompressedSize(limit))
+			assert.Error(t, err, "Decrypt should fail for a non-positive limit")
+		}
+	})
+	t.Run("Largest limit", func(t *testing.T) {
+		decrypted, err := Decrypt([]byte(compact), jwa.A128KW, sharedkey, WithMaxDecompressedSize(math.MaxInt64))
+		if !assert.NoError(t, err, "Decrypt should succeed") {
+			return
+		}
+		assert.Equal(t, payload, decrypted, "payload should match")
+	})
+	t.Run("Corrupt data", func(t *testing.T) {
+		_, err := inflate([]byte("Lorem ipsum"), DefaultMaxDecompressedSize)
+		assert.Error(t, err, "inflate should fail")
+	})
+}
+
+func TestParse_EmptyAlgorithm(t *testing.T) {
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	t.Run("Empty alg", func(t *testing.T) {
+		_, err := ParseString(encode(`{"alg":"","enc":"A256GCM"}`) + ".AAAA.AAAA.AAAA.AAAA")
+		assert.Equal(t, jwa.ErrEmptyAlgorithm, errors.Cause(err), "Parse should fail with jwa.ErrEmptyAlgorithm")
+	})
+	t.Run("Empty enc", func(t *testing.T) {
+		_, err := ParseString(encode(`{"alg":"A128KW","enc":""}`) + ".AAAA.AAAA.AAAA.AAAA")
+		assert.Equal(t, jwa.ErrEmptyAlgorithm, errors.Cause(err), "Parse should fail with jwa.ErrEmptyAlgorithm")
+	})
+	t.Run("Missing alg", func(t *testing.T) {
+		_, err := ParseString(encode(`{"enc":"A256GCM"}`) + ".AAAA.AAAA.AAAA.AAAA")
+		assert.Equal(t, ErrMissingAlgorithm, errors.Cause(err), "Parse should fail with ErrMissingAlgorithm")
+	})
+	t.Run("Empty alg in JSON serialization", func(t *testing.T) {
+		_, err := ParseString(`{"protected":"` + encode(`{"enc":"A256GCM"}`) + `","header":{"alg":""},` +
+			`"encrypted_key":"AAAA","iv":"AAAA","ciphertext":"AAAA","tag":"AAAA"}`)
+		assert.Equal(t, jwa.ErrEmptyAlgorithm, errors.Cause(err), "Parse should fail with jwa.ErrEmptyAlgorithm")
+	})
+}
+
+func TestWithAlgorithmPairs(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, "RSA key generated") {
+		return
+	}
+
+	encrypted, err := Encrypt([]byte(examplePayload), jwa.RSA_OAEP_256, &key.PublicKey, jwa.A128GCM, jwa.NoCompress)
+	if !assert.NoError(t, err, "Encrypt should succeed") {
+		return
+	}
+
+	t.Run("Listed pair", func(t *testing.T) {
+		decrypted, err := Decrypt(encrypted, jwa.RSA_OAEP_256, key, WithAlgorithmPairs(
+			AlgPair{Algorithm: jwa.RSA_OAEP_256, ContentEncryption: jwa.A256GCM},
+			AlgPair{Algorithm: jwa.RSA_OAEP_256, ContentEncryption: jwa.A128GCM},
+		))
+		if !assert.NoError(t, err, "Decrypt should succeed") {
+			return
+		}
+		assert.Equal(t, []byte(examplePayload), decrypted, "payload should match")
+	})
+	t.Run("Cross product of listed pairs", func(t *testing.T) {
+		// Both RSA-OAEP-256 and A128GCM are listed, but not together
+		_, err := Decrypt(encrypted, jwa.RSA_OAEP_256, key, WithAlgorithmPairs(
+			AlgPair{Algorithm: jwa.RSA_OAEP_256, ContentEncryption: jwa.A256GCM},
+			AlgPair{Algorithm: jwa.RSA_OAEP, ContentEncryption: jwa.A128GCM},
+		))
+		assert.Equal(t, ErrAlgorithmPairNotAllowed, errors.Cause(err), "Decrypt should fail with ErrAlgorithmPairNotAllowed")
+	})
+	t.Run("No pairs", func(t *testing.T) {
+		_, err := Decrypt(encrypted, jwa.RSA_OAEP_256, key, WithAlgorithmPairs())
+		assert.Equal(t, ErrAlgorithmPairNotAllowed, errors.Cause(err), "Decrypt should fail with ErrAlgorithmPairNotAllowed")
+
+		var pairs []AlgPair
+		_, err = Decrypt(encrypted, jwa.RSA_OAEP_256, key, WithAlgorithmPairs(pairs...))
+		assert.Equal(t, ErrAlgorithmPairNotAllowed, errors.Cause(err), "Decrypt should fail with ErrAlgorithmPairNotAllowed for a nil list")
+	})
+	t.Run("DecryptWithSet", func(t *testing.T) {
+		jwkKey, err := jwk.New(key)
+		if !assert.NoError(t, err, "jwk.New should succeed") {
+			return
+		}
+		_, err = DecryptWithSet(encrypted, &jwk.Set{Keys: []jwk.Key{jwkKey}}, WithAlgorithmPairs(
+			AlgPair{Algorithm: jwa.RSA_OAEP_256, ContentEncryption: jwa.A256GCM},
+		))
+		assert.Equal(t, ErrAlgorithmPairNotAllowed, errors.Cause(err), "DecryptWithSet should fail with ErrAlgorithmPairNotAllowed")
+	})
+}
+
+func TestHeader_AsMap(t *testing.T) {
+	h := NewHeader()
+	h.Set("alg", jwa.ECDH_ES)
+	h.Set("enc", jwa.A128GCM)
+	h.Set("apu", []byte("Alice"))
+	h.Set("jku", "https://example.com/jwks.json")
+	h.Set("kid", "my-key")
+	h.Set("custom", 42)
+
+	m := h.AsMap()
+	assert.Equal(t, map[string]interface{}{
+		"alg":    jwa.ECDH_ES,
+		"enc":    jwa.A128GCM,
+		"apu":    "QWxpY2U",
+		"jku":    "https://example.com/jwks.json",
+		"kid":    "my-key",
+		"custom": 42,
+	}, m, "AsMap should merge essential and private parameters")
+
+	m["kid"] = "other"
+	assert.Equal(t, "my-key", h.KeyID, "modifying the map should not affect the header")
+}
+
+func TestHeader_Redact(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, "ECDSA key generated") {
+		return
+	}
+	jwkKey, err := jwk.New(key)
+	if !assert.NoError(t, err, "jwk.New should succeed") {
+		return
+	}
+
+	h := NewHeader()
+	h.Set("alg", jwa.ECDH_ES)
+	h.Set("kid", "my-key")
+	h.Set("jwk", jwkKey)
+
+	serialized, err := json.Marshal(h)
+	if !assert.NoError(t, err, "json.Marshal should succeed") {
+		return
+	}
+	// Pad d to the size of the curve, as the JWK representation does
+	d := base64.RawURLEncoding.EncodeToString(append(make([]byte, 32-len(key.D.Bytes())), key.D.Bytes()...))
+	if !assert.Contains(t, string(serialized), d, "serialized header should be unaffected") {
+		return
+	}
+
+	redacted := h.Redact()
+	assert.Equal(t, "REDACTED", redacted["jwk"].(map[string]interface{})["d"], "private key should be redacted")
+	assert.Equal(t, "my-key", redacted["kid"], "kid should be kept")
+
+	for _, v := range []interface{}{h, *h} {
+		for _, format := range []string{"%v", "%s", "%#v", "%+v"} {
+			s := fmt.Sprintf(format, v)
+			if !assert.NotContains(t, s, d, "formatted header should not contain the private key") {
+				return
+			}
+			if !assert.Contains(t, s, "my-key", "formatted header should contain the kid") {
+				return
+			}
+		}
+	}
+}
+
+func TestDecodeSegments(t *testing.T) {
+	sharedkey := []byte("Lorem ipsum dolo")
+	encrypted, err := Encrypt([]byte(examplePayload), jwa.A128KW, sharedkey, jwa.A128GCM, jwa.NoCompress)
+	if !assert.NoError(t, err, "Encrypt should succeed") {
+		return
+	}
+
+	segments, err := DecodeSegments(encrypted)
+	if !assert.NoError(t, err, "DecodeSegments should succeed") {
+		return
+	}
+	if !assert.Len(t, segments, 5, "there should be 5 segments") {
+		return
+	}
+	assert.Contains(t, string(segments[0]), `"alg":"A128KW"`, "header should contain alg")
+	assert.Len(t, segments[1], 24, "wrapped A128GCM key should be 24 bytes")
+	assert.Len(t, segments[2], 12, "A128GCM IV should be 12 bytes")
+	assert.Len(t, segments[3], len(examplePayload), "ciphertext should be as long as the payload")
+	assert.Len(t, segments[4], 16, "A128GCM tag should be 16 bytes")
+
+	_, err = DecodeSegments(encrypted[:bytes.LastIndexByte(encrypted, '.')])
+	assert.Error(t, err, "DecodeSegments should fail for 4 segments")
+}
+
+func TestParse_StrictBase64(t *testing.T) {
+	sharedkey := []byte("Lorem ipsum dolo")
+	encrypted, err := Encrypt([]byte(examplePayload), jwa.A128KW, sharedkey, jwa.A128GCM, jwa.NoCompress)
+	if !assert.NoError(t, err, "Encrypt should succeed") {
+		return
+	}
+
+	// A 16 byte tag leaves 4 unused bits in the last character. Setting
+	// one of them yields a different encoding of the same bytes
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	last := strings.IndexByte(alphabet, encrypted[len(encrypted)-1])
+	tampered := append(append([]byte(nil), encrypted[:len(encrypted)-1]...), alphabet[last|1])
+
+	_, err = Decrypt(encrypted, jwa.A128KW, sharedkey, WithStrictBase64())
+	assert.NoError(t, err, "Decrypt should succeed for canonical encodings")
+
+	_, err = Decrypt(tampered, jwa.A128KW, sharedkey)
+	assert.NoError(t, err, "Decrypt should accept non-canonical encodings by default")
+
+	_, err = Decrypt(tampered, jwa.A128KW, sharedkey, WithStrictBase64())
+	assert.Equal(t, ErrNonCanonicalBase64, errors.Cause(err), "Decrypt should fail with ErrNonCanonicalBase64")
+
+	msg, err := Parse(encrypted)
+	if !assert.NoError(t, err, "Parse should succeed") {
+		return
+	}
+	serialized, err := JSONSerialize{}.Serialize(msg)
+	if !assert.NoError(t, err, "JSON serialization should succeed") {
+		return
+	}
+	i := bytes.Index(serialized, []byte(`"tag":"`)) + len(`"tag":"`) + 21
+	serialized[i] = alphabet[strings.IndexByte(alphabet, serialized[i])|1]
+	_, err = Parse(serialized, WithStrictBase64())
+	assert.Equal(t, ErrNonCanonicalBase64, errors.Cause(err), "Parse should fail with ErrNonCanonicalBase64 for JSON")
+}
+
+func TestWithAEADFactory(t *testing.T) {
+	sharedkey := []byte("Lorem ipsum dolo")
+
+	var calls int
+	factory := func(key []byte) (cipher.AEAD, error) {
+		calls++
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	}
+
+	encrypted, err := Encrypt([]byte(examplePayload), jwa.A128KW, sharedkey, jwa.A128GCM, jwa.NoCompress, WithAEADFactory(factory))
+	if !assert.NoError(t, err, "Encrypt should succeed") {
+		return
+	}
+	assert.Equal(t, 1, calls, "factory should be used to encrypt")
+
+	decrypted, err := Decrypt(encrypted, jwa.A128KW, sharedkey, WithAEADFactory(factory))
+	if !assert.NoError(t, err, "Decrypt should succeed") {
+		return
+	}
+	assert.Equal(t, examplePayload, string(decrypted), "payload should match")
+	assert.Equal(t, 2, calls, "factory should be used to decrypt")
+
+	_, err = Encrypt([]byte(examplePayload), jwa.A128KW, sharedkey, jwa.A128CBC_HS256, jwa.NoCompress, WithAEADFactory(factory))
+	assert.NoError(t, err, "Encrypt should succeed for AES CBC")
+	assert.Equal(t, 2, calls, "factory should not be used for AES CBC")
+
+	badNonce := func(key []byte) (cipher.AEAD, error) {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCMWithNonceSize(block, 16)
+	}
+	_, err = Encrypt([]byte(examplePayload), jwa.A128KW, sharedkey, jwa.A128GCM, jwa.NoCompress, WithAEADFactory(badNonce))
+	assert.Equal(t, ErrInvalidAEAD, errors.Cause(err), "Encrypt should fail with ErrInvalidAEAD for a 16 byte nonce")
+	_, err = Decrypt(encrypted, jwa.A128KW, sharedkey, WithAEADFactory(badNonce))
+	assert.Equal(t, ErrInvalidAEAD, errors.Cause(err), "Decrypt should fail with ErrInvalidAEAD for a 16 byte nonce")
+
+	badTag := func(key []byte) (cipher.AEAD, error) {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCMWithTagSize(block, 12)
+	}
+	_, err = Encrypt([]byte(examplePayload), jwa.A128KW, sharedkey, jwa.A128GCM, jwa.NoCompress, WithAEADFactory(badTag))
+	assert.Equal(t, ErrInvalidAEAD, errors.Cause(err), "Encrypt should fail with ErrInvalidAEAD for a 12 byte tag")
+}
+
+func TestParseEnvelope(t *testing.T) {
+	sharedkey := []byte("Lorem ipsum dolo")
+	encrypted, err := Encrypt([]byte(examplePayload), jwa.A128KW, sharedkey, jwa.A128GCM, jwa.NoCompress)
+	if !assert.NoError(t, err, "Encrypt should succeed") {
+		return
+	}
+
+	msg, err := ParseEnvelope([]byte(`{"token":"`+string(encrypted)+`"}`), "token")
+	if !assert.NoError(t, err, "ParseEnvelope should succeed") {
+		return
+	}
+	decrypted, err := msg.Decrypt(jwa.A128KW, sharedkey)
+	if !assert.NoError(t, err, "Decrypt should succeed") {
+		return
+	}
+	assert.Equal(t, []byte(examplePayload), decrypted, "payload should match")
+
+	_, err = ParseEnvelope([]byte(`{"id_token":"`+string(encrypted)+`"}`), "token")
+	assert.Error(t, err, "ParseEnvelope should fail for a missing field")
+
+	_, err = ParseEnvelope([]byte(`{"token":1}`), "token")
+	assert.Error(t, err, "ParseEnvelope should fail for a non-string field")
+}
+
+func TestParse_CompressionHeader(t *testing.T) {
+	protected := base64.RawURLEncoding.EncodeToString([]byte(`{"enc":"A128GCM"}`))
+	const rest = `"iv":"AAAA","ciphertext":"AAAA","tag":"AAAA"}`
+
+	t.Run("Unprotected header", func(t *testing.T) {
+		_, err := ParseString(`{"protected":"` + protected + `","unprotected":{"zip":"DEF"},` +
+			`"recipients":[{"header":{"alg":"A128KW"},"encrypted_key":"AAAA"}],` + rest)
+		assert.Equal(t, ErrProtectedHeaderRequired, errors.Cause(err), "Parse should fail with ErrProtectedHeaderRequired")
+	})
+	t.Run("Per-recipient header", func(t *testing.T) {
+		_, err := ParseString(`{"protected":"` + protected + `",` +
+			`"recipients":[{"header":{"alg":"A128KW","zip":"DEF"},"encrypted_key":"AAAA"}],` + rest)
+		assert.Equal(t, ErrProtectedHeaderRequired, errors.Cause(err), "Parse should fail with ErrProtectedHeaderRequired")
+	})
+	t.Run("Decrypt", func(t *testing.T) {
+		msg, err := ParseString(`{"protected":"` + protected + `",` +
+			`"recipients":[{"header":{"alg":"A128KW"},"encrypted_key":"AAAA"}],` + rest)
+		if !assert.NoError(t, err, "Parse should succeed") {
+			return
+		}
+		msg.Recipients[0].Header.Compression = jwa.Deflate
+		_, err = msg.Decrypt(jwa.A128KW, []byte("Lorem ipsum dolo"))
+		assert.Equal(t, ErrProtectedHeaderRequired, errors.Cause(err), "Decrypt should fail with ErrProtectedHeaderRequired")
+	})
 }
@@ -9,13 +9,17 @@ import (
 	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/sha256"
+	_ "crypto/sha512" // registers SHA-384 and SHA-512 for PBES2
 	"crypto/subtle"
 	"encoding/binary"
 	"fmt"
 	"hash"
+	"math"
 
+	"github.com/lestrrat-go/jwx/buffer"
 	"github.com/lestrrat-go/jwx/internal/concatkdf"
 	"github.com/lestrrat-go/jwx/internal/debug"
+	"github.com/lestrrat-go/jwx/internal/pbkdf2"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/pkg/errors"
 )
@@ -66,12 +70,194 @@ func (kw KeyWrapEncrypt) KeyEncrypt(cek []byte) (ByteSource, error) {
 	return ByteKey(encrypted), nil
 }
 
+// pbes2SaltSize is the number of bytes of the salt input ("p2s")
+// generated when encrypting
+const pbes2SaltSize = 16
+
+// NewPBES2KeyEncrypt creates a new key encrypter using PBES2, deriving
+// the key encryption key from `password` using `count` iterations of
+// PBKDF2. A new random salt input is generated for every key.
+func NewPBES2KeyEncrypt(alg jwa.KeyEncryptionAlgorithm, password []byte, count int) (*PBES2KeyEncrypt, error) {
+	if _, _, err := pbes2Params(alg); err != nil {
+		return nil, err
+	}
+	if count < MinPBES2Count {
+		return nil, errors.Wrapf(ErrPBES2CountTooLow, `%d < %d`, count, MinPBES2Count)
+	}
+	return &PBES2KeyEncrypt{
+		alg:      alg,
+		password: password,
+		count:    count,
+	}, nil
+}
+
+// newPBES2KeyDecrypt creates a key decrypter using PBES2. As the
+// iteration count is chosen by the sender, it must be within
+// [MinPBES2Count, max] so that no expensive derivation is performed
+// for counts outside of that range.
+func newPBES2KeyDecrypt(alg jwa.KeyEncryptionAlgorithm, password, salt []byte, count, max int) (*PBES2KeyEncrypt, error) {
+	if _, _, err := pbes2Params(alg); err != nil {
+		return nil, err
+	}
+	if count > max {
+		return nil, errors.Wrapf(ErrPBES2CountTooHigh, `%d > %d`, count, max)
+	}
+	if count < MinPBES2Count {
+		return nil, errors.Wrapf(ErrPBES2CountTooLow, `%d < %d`, count, MinPBES2Count)
+	}
+	return &PBES2KeyEncrypt{
+		alg:      alg,
+		password: password,
+		salt:     salt,
+		count:    count,
+	}, nil
+}
+
+// pbes2Params returns the PBKDF2 hash and the size of the derived key
+// for the given PBES2 algorithm
+func pbes2Params(alg jwa.KeyEncryptionAlgorithm) (crypto.Hash, int, error) {
+	switch alg {
+	case jwa.PBES2_HS256_A128KW:
+		return crypto.SHA256, 16, nil
+	case jwa.PBES2_HS384_A192KW:
+		return crypto.SHA384, 24, nil
+	case jwa.PBES2_HS512_A256KW:
+		return crypto.SHA512, 32, nil
+	}
+	return 0, 0, errors.Wrap(ErrUnsupportedAlgorithm, "invalid PBES2 algorithm")
+}
+
+// Algorithm returns the key encryption algorithm being used
+func (kw PBES2KeyEncrypt) Algorithm() jwa.KeyEncryptionAlgorithm {
+	return kw.alg
+}
+
+// Kid returns the key ID associated with this encrypter
+func (kw PBES2KeyEncrypt) Kid() string {
+	return kw.KeyID
+}
+
+// block derives the key encryption key from the password, as described
+// in https://tools.ietf.org/html/rfc7518#section-4.8.1.1
+func (kw PBES2KeyEncrypt) block(salt []byte) (cipher.Block, error) {
+	h, size, err := pbes2Params(kw.alg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The salt is UTF8(alg) || 0x00 || salt input
+	alg := kw.alg.String()
+	value := make([]byte, 0, len(alg)+1+len(salt))
+	value = append(value, alg...)
+	value = append(value, 0)
+	value = append(value, salt...)
+
+	return aes.NewCipher(pbkdf2.Key(h, kw.password, value, kw.count, size))
+}
+
+// KeyEncrypt encrypts the given content encryption key
+func (kw PBES2KeyEncrypt) KeyEncrypt(cek []byte) (ByteSource, error) {
+	salt := make([]byte, pbes2SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.Wrap(err, "failed to generate salt input")
+	}
+
+	block, err := kw.block(salt)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cipher from password")
+	}
+	encrypted, err := keywrap(block, cek)
+	if err != nil {
+		return nil, errors.Wrap(err, `keywrap: failed to wrap key`)
+	}
+	return ByteWithPBES2Params{
+		ByteKey: ByteKey(encrypted),
+		Salt:    salt,
+		Count:   kw.count,
+	}, nil
+}
+
+// KeyDecrypt decrypts the encrypted key using AES key unwrap, with the
+// salt input and iteration count taken from the JWE header
+func (kw PBES2KeyEncrypt) KeyDecrypt(enckey []byte) ([]byte, error) {
+	// https://tools.ietf.org/html/rfc7518#section-4.8.1.1
+	if len(kw.salt) < 8 {
+		return nil, errors.New(`"p2s" must be at least 8 bytes`)
+	}
+
+	block, err := kw.block(kw.salt)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cipher from password")
+	}
+	cek, err := keyunwrap(block, enckey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unwrap data")
+	}
+	return cek, nil
+}
+
+// HeaderPopulate populates the header with the salt input ("p2s") and
+// iteration count ("p2c")
+func (k ByteWithPBES2Params) HeaderPopulate(h *Header) {
+	salt, err := buffer.Buffer(k.Salt).Base64Encode()
+	if err == nil {
+		h.Set("p2s", string(salt))
+	}
+	h.Set("p2c", k.Count)
+}
+
+// pbes2HeaderParams returns the salt input ("p2s") and iteration count
+// ("p2c") from the header
+func pbes2HeaderParams(h *Header) ([]byte, int, error) {
+	v, err := h.Get("p2s")
+	if err != nil {
+		return nil, 0, errors.New(`'p2s' header is required for PBES2`)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, 0, errors.New(`'p2s' header must be a string`)
+	}
+	var salt buffer.Buffer
+	if err := salt.Base64Decode([]byte(s)); err != nil {
+		return nil, 0, errors.Wrap(err, `failed to decode 'p2s' header`)
+	}
+
+	v, err = h.Get("p2c")
+	if err != nil {
+		return nil, 0, errors.New(`'p2c' header is required for PBES2`)
+	}
+	var count int
+	switch x := v.(type) {
+	case int:
+		count = x
+	case float64:
+		if x != math.Trunc(x) {
+			return nil, 0, errors.New(`'p2c' header must be an integer`)
+		}
+		// Clamp absurd values, so that they are rejected by the limit
+		// rather than overflowing
+		if x > math.MaxInt32 {
+			x = math.MaxInt32
+		}
+		count = int(x)
+	default:
+		return nil, 0, errors.New(`'p2c' header must be an integer`)
+	}
+	return salt.Bytes(), count, nil
+}
+
 // NewEcdhesKeyWrapEncrypt creates a new key encrypter based on ECDH-ES
 func NewEcdhesKeyWrapEncrypt(alg jwa.KeyEncryptionAlgorithm, key *ecdsa.PublicKey) (*EcdhesKeyWrapEncrypt, error) {
+	return newEcdhesKeyWrapEncrypt(alg, key, nil, nil)
+}
+
+func newEcdhesKeyWrapEncrypt(alg jwa.KeyEncryptionAlgorithm, key *ecdsa.PublicKey, apu, apv []byte) (*EcdhesKeyWrapEncrypt, error) {
 	generator, err := NewEcdhesKeyGenerate(alg, key)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create key generator")
 	}
+	generator.apu = apu
+	generator.apv = apv
 	return &EcdhesKeyWrapEncrypt{
 		algorithm: alg,
 		generator: generator,
@@ -148,6 +334,19 @@ func (kw EcdhesKeyWrapDecrypt) KeyDecrypt(enckey []byte) ([]byte, error) {
 	privkey := kw.privkey
 	pubkey := kw.pubkey
 
+	// The ephemeral key must be a valid point on the same curve as our
+	// private key. Otherwise the result of the scalar multiplication may
+	// leak information about the private key (invalid curve attack)
+	if pubkey == nil || pubkey.X == nil || pubkey.Y == nil || pubkey.Curve == nil {
+		return nil, ErrInvalidEphemeralKey
+	}
+	if pubkey.Curve.Params().Name != privkey.Curve.Params().Name {
+		return nil, errors.Wrap(ErrInvalidEphemeralKey, "curve mismatch")
+	}
+	if !privkey.Curve.IsOnCurve(pubkey.X, pubkey.Y) {
+		return nil, errors.Wrap(ErrInvalidEphemeralKey, "point is not on curve")
+	}
+
 	pubinfo := make([]byte, 4)
 	binary.BigEndian.PutUint32(pubinfo, keysize*8)
 
@@ -329,16 +528,23 @@ func (d RSAOAEPKeyDecrypt) KeyDecrypt(enckey []byte) ([]byte, error) {
 	if debug.Enabled {
 		debug.Printf("START OAEP.KeyDecrypt")
 	}
-	var hash hash.Hash
+	var h crypto.Hash
 	switch d.alg {
 	case jwa.RSA_OAEP:
-		hash = sha1.New()
+		h = crypto.SHA1
 	case jwa.RSA_OAEP_256:
-		hash = sha256.New()
+		h = crypto.SHA256
 	default:
 		return nil, errors.New("failed to generate key encrypter for RSA-OAEP: RSA_OAEP/RSA_OAEP_256 required")
 	}
-	return rsa.DecryptOAEP(hash, rand.Reader, d.privkey, enckey, []byte{})
+
+	if d.mgf1Hash != 0 && !d.mgf1Hash.Available() {
+		return nil, errors.Errorf("MGF1 hash %d is not available", d.mgf1Hash)
+	}
+	if d.mgf1Hash == 0 || d.mgf1Hash == h {
+		return rsa.DecryptOAEP(h.New(), rand.Reader, d.privkey, enckey, []byte{})
+	}
+	return decryptOAEPWithMGF1(d.privkey, h, d.mgf1Hash, enckey)
 }
 
 // Decrypt for DirectDecrypt does not do anything other than
@@ -422,8 +628,10 @@ func keyunwrap(block cipher.Block, ciphertxt []byte) ([]byte, error) {
 		copy(r[t%n], buffer[keywrapChunkLen:])
 	}
 
+	// RFC 3394 section 2.2.3: the recovered IV must match the default IV,
+	// otherwise the wrapped key has been tampered with
 	if subtle.ConstantTimeCompare(buffer[:keywrapChunkLen], keywrapDefaultIV) == 0 {
-		return nil, errors.New("keywrap: failed to unwrap key")
+		return nil, ErrKeyUnwrapFailed
 	}
 
 	out := make([]byte, n*keywrapChunkLen)
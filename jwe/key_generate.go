@@ -89,7 +89,7 @@ func (g EcdhesKeyGenerate) KeyGenerate() (ByteSource, error) {
 	binary.BigEndian.PutUint32(pubinfo, uint32(g.keysize)*8)
 
 	z, _ := priv.PublicKey.Curve.ScalarMult(g.pubkey.X, g.pubkey.Y, priv.D.Bytes())
-	kdf := concatkdf.New(crypto.SHA256, []byte(g.algorithm.String()), z.Bytes(), []byte{}, []byte{}, pubinfo, []byte{})
+	kdf := concatkdf.New(crypto.SHA256, []byte(g.algorithm.String()), z.Bytes(), g.apu, g.apv, pubinfo, []byte{})
 	kek := make([]byte, g.keysize)
 	kdf.Read(kek)
 
@@ -5,6 +5,8 @@ import (
 	"encoding/hex"
 	"testing"
 
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -73,3 +75,40 @@ func TestRFC3394_Wrap(t *testing.T) {
 		}
 	}
 }
+
+func TestRFC3394_UnwrapIntegrityCheck(t *testing.T) {
+	kek := mustHexDecode("000102030405060708090A0B0C0D0E0F")
+	wrapped := mustHexDecode("1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5")
+
+	block, err := aes.NewCipher(kek)
+	if !assert.NoError(t, err, "NewCipher is successful") {
+		return
+	}
+
+	for i := range wrapped {
+		corrupted := append([]byte(nil), wrapped...)
+		corrupted[i] ^= 0x01
+
+		unwrapped, err := keyunwrap(block, corrupted)
+		if !assert.Equal(t, ErrKeyUnwrapFailed, err, "Unwrap of corrupted key should fail") {
+			return
+		}
+		assert.Nil(t, unwrapped, "Unwrap of corrupted key should not return a key")
+	}
+
+	t.Run("Message", func(t *testing.T) {
+		sharedkey := []byte("Lorem ipsum dolo")
+		encrypted, err := Encrypt([]byte("Lorem ipsum"), jwa.A128KW, sharedkey, jwa.A128GCM, jwa.NoCompress)
+		if !assert.NoError(t, err, "Encrypt should succeed") {
+			return
+		}
+		msg, err := Parse(encrypted)
+		if !assert.NoError(t, err, "Parse should succeed") {
+			return
+		}
+		msg.Recipients[0].EncryptedKey[0] ^= 0x01
+
+		_, err = msg.Decrypt(jwa.A128KW, sharedkey)
+		assert.Equal(t, ErrKeyUnwrapFailed, errors.Cause(err), "Decrypt should fail with ErrKeyUnwrapFailed")
+	})
+}
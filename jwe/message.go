@@ -3,12 +3,18 @@ package jwe
 import (
 	"bytes"
 	"compress/flate"
+	"crypto"
+	"crypto/cipher"
 	"encoding/json"
+	"io"
+	"math"
 	"net/url"
 
 	"github.com/lestrrat-go/jwx/buffer"
 	"github.com/lestrrat-go/jwx/internal/debug"
 	"github.com/lestrrat-go/jwx/internal/emap"
+	"github.com/lestrrat-go/jwx/internal/keyconv"
+	"github.com/lestrrat-go/jwx/internal/redact"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/pkg/errors"
@@ -21,6 +27,61 @@ func NewRecipient() *Recipient {
 	}
 }
 
+// CanDecryptWith performs cheap checks to see if the given key could
+// possibly be used to decrypt the CEK for this recipient: the key type
+// must be suitable for the "alg" in the recipient header, and if both
+// the header and the key (when given as a jwk.Key) specify a "kid",
+// they must match. No cryptographic operations are performed, so a
+// true return value does not guarantee that decryption succeeds.
+//
+// If the recipient header does not specify "alg", only the "kid"
+// check is performed.
+func (r *Recipient) CanDecryptWith(key interface{}) bool {
+	if r.Header == nil {
+		return true
+	}
+
+	if jwkKey, ok := key.(jwk.Key); ok {
+		if kid := jwkKey.KeyID(); kid != "" && r.Header.KeyID != "" && kid != r.Header.KeyID {
+			return false
+		}
+		materialized, err := jwkKey.Materialize()
+		if err != nil {
+			return false
+		}
+		key = materialized
+	}
+
+	switch r.Header.Algorithm {
+	case "":
+		return true
+	case jwa.RSA1_5, jwa.RSA_OAEP, jwa.RSA_OAEP_256:
+		_, ok := keyconv.RSAPrivateKey(key)
+		return ok
+	case jwa.A128KW, jwa.A192KW, jwa.A256KW:
+		sharedkey, ok := key.([]byte)
+		if !ok {
+			return false
+		}
+		switch r.Header.Algorithm {
+		case jwa.A128KW:
+			return len(sharedkey) == 16
+		case jwa.A192KW:
+			return len(sharedkey) == 24
+		default:
+			return len(sharedkey) == 32
+		}
+	case jwa.ECDH_ES_A128KW, jwa.ECDH_ES_A192KW, jwa.ECDH_ES_A256KW:
+		_, ok := keyconv.ECDSAPrivateKey(key)
+		return ok
+	case jwa.PBES2_HS256_A128KW, jwa.PBES2_HS384_A192KW, jwa.PBES2_HS512_A256KW:
+		_, ok := key.([]byte)
+		return ok
+	default:
+		return false
+	}
+}
+
 // NewHeader creates a new Header object
 func NewHeader() *Header {
 	return &Header{
@@ -335,6 +396,102 @@ func (h Header) MarshalJSON() ([]byte, error) {
 	return emap.MergeMarshal(h.EssentialHeader, h.PrivateParams)
 }
 
+// AsMap returns the parameters of this header as a single map, keyed by
+// their JOSE names. The essential parameters are merged with the private
+// parameters. URLs are rendered as strings, and binary values ("apu" and
+// "apv") as unpadded base64url strings. Other values are not copied, and
+// unset parameters are omitted
+func (h *Header) AsMap() map[string]interface{} {
+	m := make(map[string]interface{}, len(h.PrivateParams))
+	for k, v := range h.PrivateParams {
+		m[k] = v
+	}
+
+	e := h.EssentialHeader
+	if e == nil {
+		return m
+	}
+	if e.AgreementPartyUInfo.Len() > 0 {
+		v, _ := e.AgreementPartyUInfo.Base64Encode()
+		m["apu"] = string(v)
+	}
+	if e.AgreementPartyVInfo.Len() > 0 {
+		v, _ := e.AgreementPartyVInfo.Base64Encode()
+		m["apv"] = string(v)
+	}
+	if e.Algorithm != "" {
+		m["alg"] = e.Algorithm
+	}
+	if e.ContentEncryption != "" {
+		m["enc"] = e.ContentEncryption
+	}
+	if e.ContentType != "" {
+		m["cty"] = e.ContentType
+	}
+	if e.Compression != jwa.NoCompress {
+		m["zip"] = e.Compression
+	}
+	if len(e.Critical) > 0 {
+		m["crit"] = e.Critical
+	}
+	if e.EphemeralPublicKey != nil {
+		m["epk"] = e.EphemeralPublicKey
+	}
+	if e.Jwk != nil {
+		m["jwk"] = e.Jwk
+	}
+	if e.JwkSetURL != nil {
+		m["jku"] = e.JwkSetURL.String()
+	}
+	if e.KeyID != "" {
+		m["kid"] = e.KeyID
+	}
+	if e.Type != "" {
+		m["typ"] = e.Type
+	}
+	if e.X509Url != nil {
+		m["x5u"] = e.X509Url.String()
+	}
+	if len(e.X509CertChain) > 0 {
+		m["x5c"] = e.X509CertChain
+	}
+	if e.X509CertThumbprint != "" {
+		m["x5t"] = e.X509CertThumbprint
+	}
+	if e.X509CertThumbprintS256 != "" {
+		m["x5t#S256"] = e.X509CertThumbprintS256
+	}
+	return m
+}
+
+// Redact returns the JSON representation of this header, with the
+// values of secret key parameters (for example, those of a private key
+// mistakenly placed in "jwk") replaced with "REDACTED"
+func (h Header) Redact() map[string]interface{} {
+	if h.EssentialHeader == nil {
+		h.EssentialHeader = &EssentialHeader{}
+	}
+	buf, err := h.MarshalJSON()
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	m, err := redact.JSON(buf)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	return m
+}
+
+// String returns the redacted JSON representation of this header
+func (h Header) String() string {
+	return redact.Format(``, h.Redact())
+}
+
+// GoString returns the redacted JSON representation of this header
+func (h Header) GoString() string {
+	return redact.Format(`jwe.Header`, h.Redact())
+}
+
 // UnmarshalJSON parses the JSON buffer into a Header
 func (h *Header) UnmarshalJSON(data []byte) error {
 	if h.EssentialHeader == nil {
@@ -364,9 +521,50 @@ func (h *Header) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// Set sets the value of the given key in the header, and discards the
+// original encoding of the header, which no longer matches its contents
+func (e *EncodedHeader) Set(key string, value interface{}) error {
+	e.encoded = nil
+	e.source = nil
+	return e.Header.Set(key, value)
+}
+
+// setEncoded records the encoding of the header, so that it is reused
+// for as long as the contents of the header do not change
+func (e *EncodedHeader) setEncoded(encoded []byte) error {
+	source, err := json.Marshal(e.Header)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal encoded header into JSON")
+	}
+	e.encoded = buffer.Buffer(append([]byte(nil), encoded...))
+	e.source = source
+	return nil
+}
+
+// recordedEncoding returns a copy of the recorded encoding of the
+// header, provided that the header has not been modified since
+func (e EncodedHeader) recordedEncoding() ([]byte, bool) {
+	if len(e.encoded) == 0 {
+		return nil, false
+	}
+	buf, err := json.Marshal(e.Header)
+	if err != nil || !bytes.Equal(buf, e.source) {
+		return nil, false
+	}
+	return append([]byte(nil), e.encoded...), true
+}
+
 // Base64Encode creates the base64 encoded version of the JSON
-// representation of this header
+// representation of this header. If the header was parsed from an
+// existing message and has not been modified since, the original
+// encoding is returned as is, so that the bytes that participate in
+// the AAD are not altered. The returned slice is never shared with
+// the header
 func (e EncodedHeader) Base64Encode() ([]byte, error) {
+	if buf, ok := e.recordedEncoding(); ok {
+		return buf, nil
+	}
+
 	buf, err := json.Marshal(e.Header)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to marshal encoded header into JSON")
@@ -401,6 +599,15 @@ func (e *EncodedHeader) UnmarshalJSON(buf []byte) error {
 		return errors.Wrap(err, "failed to unmarshal buffer")
 	}
 
+	// Remember the original encoding
+	var encoded string
+	if err := json.Unmarshal(buf, &encoded); err != nil {
+		return errors.Wrap(err, "failed to unmarshal encoded header")
+	}
+	if err := e.setEncoded([]byte(encoded)); err != nil {
+		return errors.Wrap(err, "failed to record encoded header")
+	}
+
 	return nil
 }
 
@@ -412,51 +619,263 @@ func NewMessage() *Message {
 	}
 }
 
-// Decrypt decrypts the message using the specified algorithm and key
-func (m *Message) Decrypt(alg jwa.KeyEncryptionAlgorithm, key interface{}) ([]byte, error) {
+// SetAAD sets the additional authenticated data ("aad") of the message.
+// The AAD is integrity protected along with the protected header, and
+// is included in the authenticated data when the message is decrypted.
+// Messages with AAD can not be represented in the compact serialization,
+// so serializing them in that format fails with ErrCompactUnrepresentable.
+//
+// An empty, non-nil aad is not the same as no AAD: the "aad" member is
+// then serialized as an empty string, and the authenticated data is the
+// protected header followed by a '.'. Passing nil removes the AAD.
+//
+// Note that changing the AAD of an encrypted message invalidates it:
+// to create a message with AAD, use MultiEncrypt.EncryptWithAAD.
+func (m *Message) SetAAD(aad []byte) {
+	if aad == nil {
+		m.AuthenticatedData = nil
+		return
+	}
+	m.AuthenticatedData = buffer.Buffer(append([]byte{}, aad...))
+}
+
+// HasAAD returns true if the message has an "aad" member, even if it
+// is empty.
+func (m *Message) HasAAD() bool {
+	return m.AuthenticatedData != nil
+}
+
+// MarshalJSON generates the JSON representation of this message. The
+// "aad" member is omitted if the message has no AAD, and is an empty
+// string if the AAD is explicitly empty.
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	proxy := struct {
+		message
+		AuthenticatedData *buffer.Buffer `json:"aad,omitempty"`
+	}{message: message(m)}
+	if m.AuthenticatedData != nil {
+		proxy.AuthenticatedData = &m.AuthenticatedData
+	}
+	return json.Marshal(proxy)
+}
+
+// Algorithms returns the key encryption algorithm of each recipient,
+// and the content encryption algorithm shared by all recipients. No
+// decryption is performed, so the values have not been authenticated
+// in any way: use them for logging or for allow-list checks only.
+//
+// The key encryption algorithms are listed in the same order as the
+// recipients. Headers are merged in the same way as during decryption,
+// so a recipient without an "alg" of its own reports the one found in
+// the shared headers.
+func (m *Message) Algorithms() (keyAlgs []jwa.KeyEncryptionAlgorithm, enc jwa.ContentEncryptionAlgorithm) {
+	h := m.sharedHeader()
+	enc = h.ContentEncryption
+
+	keyAlgs = make([]jwa.KeyEncryptionAlgorithm, len(m.Recipients))
+	for i, recipient := range m.Recipients {
+		keyAlgs[i] = h.Algorithm
+		if recipient.Header != nil && recipient.Header.Algorithm != "" {
+			keyAlgs[i] = recipient.Header.Algorithm
+		}
+	}
+	return keyAlgs, enc
+}
+
+// Compression returns the compression algorithm ("zip") used for the
+// message, or an empty value if the payload is not compressed. Like
+// Algorithms, it does not perform any decryption.
+func (m *Message) Compression() jwa.CompressionAlgorithm {
+	return m.sharedHeader().Compression
+}
+
+// sharedHeader returns the protected and unprotected headers merged
+// together. Values that fail to merge are ignored
+func (m *Message) sharedHeader() *Header {
+	h := NewHeader()
+	if m.ProtectedHeader != nil && m.ProtectedHeader.Header != nil {
+		h.Copy(m.ProtectedHeader.Header)
+	}
+	if m.UnprotectedHeader != nil {
+		if merged, err := h.Merge(m.UnprotectedHeader); err == nil {
+			h = merged
+		}
+	}
+	return h
+}
+
+// Decrypt decrypts the message using the specified algorithm and key.
+// For ECDH-ES family of algorithms, the curve of the ephemeral public key
+// must be one of DefaultAllowedCurves, unless WithAllowedCurves is
+// specified.
+//
+// At most DefaultMaxDecryptAttempts recipients are tried, unless
+// WithMaxDecryptAttempts is specified. Once the limit is exceeded,
+// ErrTooManyDecryptAttempts is returned.
+//
+// Compressed payloads may inflate to at most DefaultMaxDecompressedSize
+// bytes, unless WithMaxDecompressedSize is specified.
+//
+// If WithAlgorithmPairs is specified, the combination of `alg` and the
+// content encryption algorithm of the message must be one of the pairs.
+//
+// WithOAEPMGF1Hash may be used to decrypt RSA-OAEP keys produced with a
+// non-standard MGF1 hash.
+func (m *Message) Decrypt(alg jwa.KeyEncryptionAlgorithm, key interface{}, options ...Option) ([]byte, error) {
+	if keyconv.IsNil(key) {
+		return nil, errors.Wrap(ErrNilKey, `invalid parameter "key"`)
+	}
+
+	cfg, err := newDecryptConfig(options)
+	if err != nil {
+		return nil, errors.Wrap(err, `invalid options`)
+	}
+	return m.decrypt(alg, key, cfg)
+}
+
+// decryptConfig holds the settings for a single call to one of the
+// decryption functions. The attempt budget is shared by every key
+// tried during that call
+type decryptConfig struct {
+	aeadFactory         func([]byte) (cipher.AEAD, error)
+	algorithmPairs      []AlgPair
+	restrictPairs       bool
+	allowedCurves       []jwa.EllipticCurveAlgorithm
+	maxDecompressedSize int64
+	maxPBES2Count       int
+	oaepMGF1Hash        crypto.Hash
+	remainingAttempts   int
+}
+
+func newDecryptConfig(options []Option) (*decryptConfig, error) {
+	cfg := &decryptConfig{
+		allowedCurves:       DefaultAllowedCurves,
+		maxDecompressedSize: DefaultMaxDecompressedSize,
+		maxPBES2Count:       DefaultMaxPBES2Count,
+		remainingAttempts:   DefaultMaxDecryptAttempts,
+	}
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyAEADFactory:
+			cfg.aeadFactory = o.Value().(func([]byte) (cipher.AEAD, error))
+		case optkeyAlgorithmPairs:
+			cfg.algorithmPairs = o.Value().([]AlgPair)
+			cfg.restrictPairs = true
+		case optkeyAllowedCurves:
+			cfg.allowedCurves = o.Value().([]jwa.EllipticCurveAlgorithm)
+		case optkeyMaxDecompressedSize:
+			cfg.maxDecompressedSize = o.Value().(int64)
+		case optkeyMaxDecryptAttempts:
+			cfg.remainingAttempts = o.Value().(int)
+		case optkeyMaxPBES2Count:
+			cfg.maxPBES2Count = o.Value().(int)
+		case optkeyOAEPMGF1Hash:
+			cfg.oaepMGF1Hash = o.Value().(crypto.Hash)
+		}
+	}
+
+	if cfg.oaepMGF1Hash != 0 && !cfg.oaepMGF1Hash.Available() {
+		return nil, errors.Errorf(`MGF1 hash %d is not available`, cfg.oaepMGF1Hash)
+	}
+	if cfg.maxDecompressedSize <= 0 {
+		return nil, errors.Errorf(`invalid maximum decompressed size %d: must be positive`, cfg.maxDecompressedSize)
+	}
+	return cfg, nil
+}
+
+func (m *Message) decrypt(alg jwa.KeyEncryptionAlgorithm, key interface{}, cfg *decryptConfig) ([]byte, error) {
 	var err error
 
+	// jwk.Key is accepted so that CanDecryptWith may compare the "kid",
+	// but the key decrypters require the raw key
+	rawKey := key
+	if jwkKey, ok := key.(jwk.Key); ok {
+		rawKey, err = jwkKey.Materialize()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to materialize key")
+		}
+	}
+
 	if len(m.Recipients) == 0 {
 		return nil, errors.New("no recipients, can not proceed with decrypt")
 	}
 
-	enc := m.ProtectedHeader.ContentEncryption
+	if m.ProtectedHeader == nil || m.ProtectedHeader.Header == nil {
+		return nil, errors.New("missing protected header")
+	}
+	if err := checkCompressionHeader(m); err != nil {
+		return nil, err
+	}
 
 	h := NewHeader()
 	if err := h.Copy(m.ProtectedHeader.Header); err != nil {
 		return nil, errors.Wrap(err, `failed to copy protected headers`)
 	}
-	h, err = h.Merge(m.UnprotectedHeader)
-	if err != nil {
-		if debug.Enabled {
-			debug.Printf("failed to merge unprotected header")
+	if m.UnprotectedHeader != nil {
+		h, err = h.Merge(m.UnprotectedHeader)
+		if err != nil {
+			if debug.Enabled {
+				debug.Printf("failed to merge unprotected header")
+			}
+			return nil, errors.Wrap(err, "failed to merge headers for message decryption")
 		}
-		return nil, errors.Wrap(err, "failed to merge headers for message decryption")
+	}
+	enc := h.ContentEncryption
+	if enc == "" {
+		return nil, ErrMissingContentEncryption
+	}
+	if cfg.restrictPairs && !containsAlgPair(cfg.algorithmPairs, AlgPair{Algorithm: alg, ContentEncryption: enc}) {
+		return nil, errors.Wrapf(ErrAlgorithmPairNotAllowed, `%s with %s`, alg, enc)
 	}
 
-	aad, err := m.AuthenticatedData.Base64Encode()
+	aad, err := m.computeAAD()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to base64 encode authenticated data for message decryption")
+		return nil, errors.Wrap(err, "failed to compute authenticated data for message decryption")
 	}
 	ciphertext := m.CipherText.Bytes()
 	iv := m.InitializationVector.Bytes()
 	tag := m.Tag.Bytes()
 
-	cipher, err := buildContentCipher(enc)
+	contentcipher, err := buildContentCipher(enc)
 	if err != nil {
 		return nil, errors.Wrap(err, "unsupported content cipher algorithm '"+enc.String()+"'")
 	}
-	keysize := cipher.KeySize()
+	useAeadFactory(contentcipher, enc, cfg.aeadFactory)
+	keysize := contentcipher.KeySize()
 
-	var plaintext []byte
-	for _, recipient := range m.Recipients {
-		if debug.Enabled {
-			debug.Printf("Attempting to check if we can decode for recipient (alg = %s)", recipient.Header.Algorithm)
+	// attempt tries to decrypt the message using the given recipient
+	attempt := func(h2 *Header, recipient Recipient) ([]byte, error) {
+		switch h2.Algorithm {
+		case jwa.ECDH_ES, jwa.ECDH_ES_A128KW, jwa.ECDH_ES_A192KW, jwa.ECDH_ES_A256KW:
+			if err := checkEphemeralKeyCurve(h2, cfg.allowedCurves); err != nil {
+				return nil, errors.Wrap(err, "ephemeral key rejected")
+			}
 		}
-		if recipient.Header.Algorithm != alg {
-			continue
+
+		k, err := buildKeyDecrypter(h2.Algorithm, h2, rawKey, keysize, cfg.maxPBES2Count)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create key decrypter")
+		}
+		if d, ok := k.(*RSAOAEPKeyDecrypt); ok {
+			d.mgf1Hash = cfg.oaepMGF1Hash
+		}
+
+		cek, err := k.KeyDecrypt(recipient.EncryptedKey.Bytes())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decrypt key")
 		}
 
+		plaintext, err := contentcipher.decrypt(cek, iv, ciphertext, tag, aad)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decrypt content")
+		}
+		return plaintext, nil
+	}
+
+	var plaintext []byte
+	var decryptErrors DecryptErrors
+	for i, recipient := range m.Recipients {
 		h2 := NewHeader()
 		if err := h2.Copy(h); err != nil {
 			if debug.Enabled {
@@ -465,64 +884,150 @@ func (m *Message) Decrypt(alg jwa.KeyEncryptionAlgorithm, key interface{}) ([]by
 			continue
 		}
 
-		h2, err := h2.Merge(recipient.Header)
-		if err != nil {
-			if debug.Enabled {
-				debug.Printf("Failed to merge! %s", err)
+		// The per-recipient header is optional, as "alg" may be
+		// specified in the protected header
+		if recipient.Header != nil {
+			h2, err = h2.Merge(recipient.Header)
+			if err != nil {
+				if debug.Enabled {
+					debug.Printf("Failed to merge! %s", err)
+				}
+				continue
 			}
-			continue
 		}
 
-		k, err := BuildKeyDecrypter(h2.Algorithm, h2, key, keysize)
-		if err != nil {
-			if debug.Enabled {
-				debug.Printf("failed to create key decrypter: %s", err)
-			}
+		if debug.Enabled {
+			debug.Printf("Attempting to check if we can decode for recipient (alg = %s)", h2.Algorithm)
+		}
+		if h2.Algorithm != alg {
 			continue
 		}
 
-		cek, err := k.KeyDecrypt(recipient.EncryptedKey.Bytes())
-		if err != nil {
+		// Skip recipients that the key obviously can not be used for,
+		// before doing any expensive key unwrapping
+		if !(&Recipient{Header: h2}).CanDecryptWith(key) {
 			if debug.Enabled {
-				debug.Printf("failed to decrypt key: %s", err)
+				debug.Printf("DecryptMessage: key is not compatible with recipient %d", i)
 			}
 			continue
 		}
 
-		plaintext, err = cipher.decrypt(cek, iv, ciphertext, tag, aad)
+		if cfg.remainingAttempts <= 0 {
+			return nil, ErrTooManyDecryptAttempts
+		}
+		cfg.remainingAttempts--
+
+		plaintext, err = attempt(h2, recipient)
 		if err == nil {
 			break
 		}
 		if debug.Enabled {
 			debug.Printf("DecryptMessage: failed to decrypt using %s: %s", h2.Algorithm, err)
 		}
+		decryptErrors = append(decryptErrors, &DecryptError{
+			RecipientIndex: i,
+			Alg:            h2.Algorithm,
+			Err:            err,
+		})
 		// Keep looping because there might be another key with the same algo
 	}
 
 	if plaintext == nil {
-		return nil, errors.New("failed to find matching recipient to decrypt key")
+		switch len(decryptErrors) {
+		case 0:
+			return nil, errors.New("failed to find matching recipient to decrypt key")
+		case 1:
+			return nil, decryptErrors[0]
+		default:
+			return nil, decryptErrors
+		}
 	}
 
 	if h.Compression == jwa.Deflate {
-		output := bytes.Buffer{}
-		w, _ := flate.NewWriter(&output, 1)
-		in := plaintext
-		for len(in) > 0 {
-			n, err := w.Write(in)
-			if err != nil {
-				return nil, errors.Wrap(err, `failed to write to compression writer`)
+		output, err := inflate(plaintext, cfg.maxDecompressedSize)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to decompress payload`)
+		}
+		plaintext = output
+	}
+
+	return plaintext, nil
+}
+
+const (
+	// inflateRatioHint is the expected compression ratio, used to
+	// pre-size the output buffer from the size of the compressed input
+	inflateRatioHint = 4
+	// inflateMinGrowth and inflateMaxGrowth bound the number of bytes
+	// the output buffer grows by at a time
+	inflateMinGrowth = 512
+	inflateMaxGrowth = 1024 * 1024
+)
+
+// inflate decompresses DEFLATE compressed data, reading at most `limit`
+// bytes of output. The output buffer is initially sized from the size of
+// the compressed data, and grows in bounded increments, so that a small
+// input can not cause a single huge allocation
+func inflate(compressed []byte, limit int64) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(compressed))
+	defer r.Close()
+
+	hint := int64(len(compressed)) * inflateRatioHint
+	if hint > limit {
+		hint = limit
+	}
+	if hint > inflateMaxGrowth {
+		hint = inflateMaxGrowth
+	}
+
+	// Read one byte past the limit so that we can tell a payload that
+	// is exactly `limit` bytes long from one that exceeds it
+	if limit == math.MaxInt64 {
+		limit--
+	}
+	src := io.LimitReader(r, limit+1)
+	out := make([]byte, 0, hint)
+	for {
+		if len(out) == cap(out) {
+			growth := cap(out)
+			if growth < inflateMinGrowth {
+				growth = inflateMinGrowth
 			}
-			in = in[n:]
+			if growth > inflateMaxGrowth {
+				growth = inflateMaxGrowth
+			}
+			grown := make([]byte, len(out), cap(out)+growth)
+			copy(grown, out)
+			out = grown
+		}
+
+		n, err := src.Read(out[len(out):cap(out)])
+		out = out[:len(out)+n]
+		if int64(len(out)) > limit {
+			return nil, ErrDecompressedSizeExceeded
 		}
-		if err := w.Close(); err != nil {
-			return nil, errors.Wrap(err, "failed to close compression writer")
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
 		}
-		plaintext = output.Bytes()
 	}
+}
 
-	return plaintext, nil
+func containsAlgPair(list []AlgPair, pair AlgPair) bool {
+	for _, v := range list {
+		if v == pair {
+			return true
+		}
+	}
+	return false
 }
 
+// buildContentCipher only knows the RFC 7518 algorithms. The names used
+// by pre-final JWA drafts (such as "A128CBC+HS256") are not aliases of
+// their RFC counterparts: the drafts derived the keys and computed the
+// MAC differently, so they are rejected as unsupported
 func buildContentCipher(alg jwa.ContentEncryptionAlgorithm) (ContentCipher, error) {
 	switch alg {
 	case jwa.A128GCM, jwa.A192GCM, jwa.A256GCM, jwa.A128CBC_HS256, jwa.A192CBC_HS384, jwa.A256CBC_HS512:
@@ -531,3 +1036,37 @@ func buildContentCipher(alg jwa.ContentEncryptionAlgorithm) (ContentCipher, erro
 
 	return nil, ErrUnsupportedAlgorithm
 }
+
+func checkEphemeralKeyCurve(h *Header, allowed []jwa.EllipticCurveAlgorithm) error {
+	if h.EphemeralPublicKey == nil {
+		return errors.Wrap(ErrInvalidEphemeralKey, "missing 'epk' header")
+	}
+
+	crv := h.EphemeralPublicKey.Curve()
+	for _, v := range allowed {
+		if v == crv {
+			return nil
+		}
+	}
+	return errors.Wrapf(ErrCurveNotAllowed, "curve %s", crv)
+}
+
+// computeAAD computes the additional authenticated data used for the
+// content encryption, as described in
+// https://tools.ietf.org/html/rfc7516#section-5.1 step 14
+func (m *Message) computeAAD() ([]byte, error) {
+	aad, err := m.ProtectedHeader.Base64Encode()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to base64 encode protected header")
+	}
+
+	// An explicitly empty AAD still appends the '.'
+	if m.AuthenticatedData != nil {
+		encoded, err := m.AuthenticatedData.Base64Encode()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to base64 encode authenticated data")
+		}
+		aad = append(append(aad, '.'), encoded...)
+	}
+	return aad, nil
+}
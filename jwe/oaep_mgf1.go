@@ -0,0 +1,20 @@
+//go:build go1.20
+// +build go1.20
+
+package jwe
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+)
+
+// decryptOAEPWithMGF1 decrypts enckey using RSA-OAEP, with h as the
+// label digest and mgf1 as the MGF1 hash. rsa.OAEPOptions.MGFHash is
+// only available since Go 1.20
+func decryptOAEPWithMGF1(privkey *rsa.PrivateKey, h, mgf1 crypto.Hash, enckey []byte) ([]byte, error) {
+	return privkey.Decrypt(rand.Reader, enckey, &rsa.OAEPOptions{
+		Hash:    h,
+		MGFHash: mgf1,
+	})
+}
@@ -0,0 +1,17 @@
+//go:build !go1.20
+// +build !go1.20
+
+package jwe
+
+import (
+	"crypto"
+	"crypto/rsa"
+
+	"github.com/pkg/errors"
+)
+
+// decryptOAEPWithMGF1 always fails: before Go 1.20, crypto/rsa can not
+// use a MGF1 hash that differs from the label digest
+func decryptOAEPWithMGF1(_ *rsa.PrivateKey, _, _ crypto.Hash, _ []byte) ([]byte, error) {
+	return nil, errors.New("a MGF1 hash distinct from the OAEP hash requires Go 1.20 or later")
+}
@@ -0,0 +1,86 @@
+//go:build go1.20
+// +build go1.20
+
+package jwe
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"math/big"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/stretchr/testify/assert"
+)
+
+// encryptOAEPWithMGF1 implements RSAES-OAEP-ENCRYPT from RFC 8017 with
+// an empty label, using h for the label digest and mgf1 for MGF1
+func encryptOAEPWithMGF1(pub *rsa.PublicKey, h, mgf1 crypto.Hash, msg []byte) ([]byte, error) {
+	k := (pub.N.BitLen() + 7) / 8
+	hash := h.New()
+	hLen := hash.Size()
+
+	db := make([]byte, k-hLen-1)
+	copy(db, hash.Sum(nil))
+	db[len(db)-len(msg)-1] = 1
+	copy(db[len(db)-len(msg):], msg)
+
+	seed := make([]byte, hLen)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	mgf1XOR(db, mgf1, seed)
+	mgf1XOR(seed, mgf1, db)
+
+	em := make([]byte, k)
+	copy(em[1:], seed)
+	copy(em[1+hLen:], db)
+
+	c := new(big.Int).Exp(new(big.Int).SetBytes(em), big.NewInt(int64(pub.E)), pub.N)
+	out := make([]byte, k)
+	cb := c.Bytes()
+	copy(out[k-len(cb):], cb)
+	return out, nil
+}
+
+func mgf1XOR(out []byte, h crypto.Hash, seed []byte) {
+	var counter [4]byte
+	for i, done := uint32(0), 0; done < len(out); i++ {
+		binary.BigEndian.PutUint32(counter[:], i)
+		d := h.New()
+		d.Write(seed)
+		d.Write(counter[:])
+		for _, b := range d.Sum(nil) {
+			if done == len(out) {
+				break
+			}
+			out[done] ^= b
+			done++
+		}
+	}
+}
+
+func TestRSAOAEPKeyDecrypt_DistinctMGF1Hash(t *testing.T) {
+	cek := []byte("0123456789abcdef0123456789abcdef")
+
+	enckey, err := encryptOAEPWithMGF1(&rsaPrivKey.PublicKey, crypto.SHA256, crypto.SHA1, cek)
+	if !assert.NoError(t, err, "encryptOAEPWithMGF1 should succeed") {
+		return
+	}
+
+	d, err := NewRSAOAEPKeyDecrypt(jwa.RSA_OAEP_256, rsaPrivKey)
+	if !assert.NoError(t, err, "NewRSAOAEPKeyDecrypt should succeed") {
+		return
+	}
+	_, err = d.KeyDecrypt(enckey)
+	assert.Error(t, err, "KeyDecrypt should fail with the standard MGF1 hash")
+
+	d.mgf1Hash = crypto.SHA1
+	decrypted, err := d.KeyDecrypt(enckey)
+	if !assert.NoError(t, err, "KeyDecrypt should succeed") {
+		return
+	}
+	assert.Equal(t, cek, decrypted, "KeyDecrypt should return the key")
+}
@@ -0,0 +1,144 @@
+package jwe
+
+import (
+	"crypto"
+	"crypto/cipher"
+
+	"github.com/lestrrat-go/jwx/internal/option"
+	"github.com/lestrrat-go/jwx/jwa"
+)
+
+type Option = option.Interface
+
+const (
+	optkeyAEADFactory         = `aead-factory`
+	optkeyAlgorithmPairs      = `algorithm-pairs`
+	optkeyAllowedCurves       = `allowed-curves`
+	optkeyMaxDecompressedSize = `max-decompressed-size`
+	optkeyMaxDecryptAttempts  = `max-decrypt-attempts`
+	optkeyMaxPBES2Count       = `max-pbes2-count`
+	optkeyOAEPMGF1Hash        = `oaep-mgf1-hash`
+	optkeyStrictBase64        = `strict-base64`
+)
+
+// DefaultMaxDecompressedSize is the maximum number of bytes that a
+// compressed ("zip":"DEF") payload may inflate to, unless specified
+// otherwise via WithMaxDecompressedSize.
+const DefaultMaxDecompressedSize int64 = 10 * 1024 * 1024
+
+// DefaultMaxDecryptAttempts is the maximum number of recipients that a
+// single call to Decrypt or DecryptWithSet tries to decrypt, unless
+// specified otherwise via WithMaxDecryptAttempts.
+const DefaultMaxDecryptAttempts = 256
+
+// DefaultPBES2Count is the PBKDF2 iteration count ("p2c") used when
+// encrypting with the PBES2 algorithms.
+const DefaultPBES2Count = 100000
+
+// DefaultMaxPBES2Count is the largest PBKDF2 iteration count ("p2c")
+// accepted when decrypting, unless specified otherwise via
+// WithMaxPBES2Count.
+const DefaultMaxPBES2Count = 1000000
+
+// MinPBES2Count is the smallest PBKDF2 iteration count ("p2c") accepted
+// when encrypting or decrypting, as recommended by RFC 7518.
+const MinPBES2Count = 1000
+
+// DefaultAllowedCurves is the list of curves that are accepted for
+// the ephemeral public key in ECDH-ES key agreement, unless specified
+// otherwise via WithAllowedCurves.
+var DefaultAllowedCurves = []jwa.EllipticCurveAlgorithm{jwa.P256, jwa.P384, jwa.P521}
+
+// WithAllowedCurves specifies the curves that are accepted for the
+// ephemeral public key ("epk") when decrypting ECDH-ES messages.
+// Messages using any other curve are rejected before key agreement
+// is attempted, with an error whose cause is ErrCurveNotAllowed.
+func WithAllowedCurves(curves ...jwa.EllipticCurveAlgorithm) Option {
+	return option.New(optkeyAllowedCurves, curves)
+}
+
+// AlgPair is a combination of key encryption algorithm ("alg") and
+// content encryption algorithm ("enc")
+type AlgPair struct {
+	Algorithm         jwa.KeyEncryptionAlgorithm
+	ContentEncryption jwa.ContentEncryptionAlgorithm
+}
+
+// WithAlgorithmPairs specifies the combinations of "alg" and "enc" that
+// are accepted when decrypting. Messages using any other combination are
+// rejected with ErrAlgorithmPairNotAllowed before any key is unwrapped.
+// Unlike independent lists of algorithms, this does not permit every
+// combination of the listed "alg" and "enc" values. If no pairs are
+// given, every message is rejected.
+func WithAlgorithmPairs(pairs ...AlgPair) Option {
+	return option.New(optkeyAlgorithmPairs, pairs)
+}
+
+// WithMaxDecryptAttempts specifies the maximum number of recipients
+// that a single call to Decrypt or DecryptWithSet tries to decrypt.
+// Every combination of recipient and key that passes the cheap
+// compatibility checks counts as one attempt. This bounds the amount
+// of work a message with many recipients can cause.
+func WithMaxDecryptAttempts(n int) Option {
+	return option.New(optkeyMaxDecryptAttempts, n)
+}
+
+// WithMaxDecompressedSize specifies the maximum number of bytes that a
+// compressed payload may inflate to when decrypting. Payloads exceeding
+// the limit are rejected with ErrDecompressedSizeExceeded, which protects
+// against highly compressed inputs that would otherwise exhaust memory.
+// The limit must be positive, or decryption fails.
+func WithMaxDecompressedSize(n int64) Option {
+	return option.New(optkeyMaxDecompressedSize, n)
+}
+
+// WithMaxPBES2Count specifies the largest PBKDF2 iteration count ("p2c")
+// accepted when decrypting PBES2 messages. As the count is chosen by the
+// sender, messages declaring a larger count are rejected with
+// ErrPBES2CountTooHigh before any key derivation is performed.
+func WithMaxPBES2Count(n int) Option {
+	return option.New(optkeyMaxPBES2Count, n)
+}
+
+// WithOAEPMGF1Hash specifies the hash function used by the MGF1 mask
+// generation function when decrypting RSA-OAEP and RSA-OAEP-256 keys.
+//
+// This is NOT standard: RFC 7518 uses the same hash for the label digest
+// and MGF1, that is, SHA-1 for "RSA-OAEP" and SHA-256 for "RSA-OAEP-256".
+// Only use this to interoperate with producers that differ. A MGF1 hash
+// other than the standard one requires Go 1.20 or later; with older
+// versions, decryption fails.
+func WithOAEPMGF1Hash(h crypto.Hash) Option {
+	return option.New(optkeyOAEPMGF1Hash, h)
+}
+
+// WithStrictBase64 specifies that Parse (and therefore Decrypt) must
+// reject messages containing values that are not canonically base64url
+// encoded, that is, whose last character has non-zero unused bits, or
+// that contain line breaks. The standard library accepts such encodings,
+// which allows several encodings of the same tag. By default, they are
+// accepted.
+func WithStrictBase64() Option {
+	return option.New(optkeyStrictBase64, true)
+}
+
+// WithAEADFactory specifies the function used to create the AEAD for the
+// AES GCM content encryption algorithms (A128GCM, A192GCM, and A256GCM),
+// instead of the standard library implementation. This allows, for
+// example, hardware backed or FIPS validated implementations to be used.
+// The AEAD must use a 12 byte nonce and a 16 byte tag, or encryption and
+// decryption fail with ErrInvalidAEAD. The AES CBC algorithms are not
+// affected.
+func WithAEADFactory(f func(key []byte) (cipher.AEAD, error)) Option {
+	return option.New(optkeyAEADFactory, f)
+}
+
+func aeadFactoryFromOptions(options []Option) func([]byte) (cipher.AEAD, error) {
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyAEADFactory:
+			return o.Value().(func([]byte) (cipher.AEAD, error))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package jwe
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+
+	"github.com/lestrrat-go/jwx/internal/keyconv"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/pkg/errors"
+)
+
+// EncryptPEM is the same as Encrypt, but takes the key as PEM encoded
+// bytes. See jwk.ParsePEM for the supported formats. If a private key
+// is given, its public half is used.
+func EncryptPEM(payload []byte, keyalg jwa.KeyEncryptionAlgorithm, pemKey []byte, contentalg jwa.ContentEncryptionAlgorithm, compressalg jwa.CompressionAlgorithm) ([]byte, error) {
+	raw, err := parsePEMKey(pemKey, keyalg)
+	if err != nil {
+		return nil, err
+	}
+	return Encrypt(payload, keyalg, keyconv.PublicKey(raw), contentalg, compressalg)
+}
+
+// DecryptPEM is the same as Decrypt, but takes the private key as PEM
+// encoded bytes. See jwk.ParsePEM for the supported formats.
+func DecryptPEM(buf []byte, alg jwa.KeyEncryptionAlgorithm, pemKey []byte, options ...Option) ([]byte, error) {
+	raw, err := parsePEMKey(pemKey, alg)
+	if err != nil {
+		return nil, err
+	}
+	switch raw.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+	default:
+		return nil, errors.Errorf(`a private key is required for decryption, got %T`, raw)
+	}
+	return Decrypt(buf, alg, raw, options...)
+}
+
+// parsePEMKey parses the PEM encoded key, and makes sure that it can
+// be used with the given algorithm
+func parsePEMKey(pemKey []byte, alg jwa.KeyEncryptionAlgorithm) (interface{}, error) {
+	key, err := jwk.ParsePEM(pemKey)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to parse PEM key`)
+	}
+
+	raw, err := key.Materialize()
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to materialize key`)
+	}
+
+	_, algs := jwk.SupportedAlgorithms(raw)
+	for _, v := range algs {
+		if v == alg {
+			return raw, nil
+		}
+	}
+	return nil, errors.Errorf(`key of type %T can not be used with %s`, raw, alg)
+}
@@ -1,8 +1,10 @@
 package jwe
 
 import (
+	"bytes"
 	"encoding/json"
 
+	"github.com/lestrrat-go/jwx/buffer"
 	"github.com/pkg/errors"
 )
 
@@ -11,6 +13,9 @@ func (s CompactSerialize) Serialize(m *Message) ([]byte, error) {
 	if len(m.Recipients) != 1 {
 		return nil, errors.New("wrong number of recipients for compact serialization")
 	}
+	if m.HasAAD() {
+		return nil, errors.Wrap(ErrCompactUnrepresentable, "aad is present")
+	}
 
 	recipient := m.Recipients[0]
 
@@ -26,18 +31,33 @@ func (s CompactSerialize) Serialize(m *Message) ([]byte, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to copy protected header")
 	}
-	hcopy, err = hcopy.Merge(m.UnprotectedHeader)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to merge unprotected header")
+	if m.UnprotectedHeader != nil {
+		hcopy, err = hcopy.Merge(m.UnprotectedHeader)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to merge unprotected header")
+		}
 	}
-	hcopy, err = hcopy.Merge(recipient.Header)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to merge recipient header")
+	if recipient.Header != nil {
+		hcopy, err = hcopy.Merge(recipient.Header)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to merge recipient header")
+		}
 	}
 
-	protected, err := EncodedHeader{Header: hcopy}.Base64Encode()
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to encode header")
+	// If the protected header was encoded when the message was encrypted
+	// or parsed, those bytes are the AAD and are reused as is. Members of
+	// the unprotected or recipient headers can not be moved into them
+	// without invalidating the authentication tag
+	protected, ok := m.ProtectedHeader.recordedEncoding()
+	if ok {
+		if err := checkCompactHeader(protected, hcopy); err != nil {
+			return nil, err
+		}
+	} else {
+		protected, err = EncodedHeader{Header: hcopy}.Base64Encode()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to encode header")
+		}
 	}
 
 	encryptedKey, err := recipient.EncryptedKey.Base64Encode()
@@ -64,6 +84,32 @@ func (s CompactSerialize) Serialize(m *Message) ([]byte, error) {
 	return buf, nil
 }
 
+// checkCompactHeader checks that the encoded protected header carries
+// the same members as the merged header h
+func checkCompactHeader(protected []byte, h *Header) error {
+	decoded := buffer.Buffer{}
+	if err := decoded.Base64Decode(protected); err != nil {
+		return errors.Wrap(err, "failed to decode protected header")
+	}
+	ph := NewHeader()
+	if err := json.Unmarshal(decoded.Bytes(), ph); err != nil {
+		return errors.Wrap(err, "failed to parse protected header")
+	}
+
+	expected, err := json.Marshal(h)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal merged header")
+	}
+	actual, err := json.Marshal(ph)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal protected header")
+	}
+	if !bytes.Equal(expected, actual) {
+		return errors.Wrap(ErrCompactUnrepresentable, "unprotected or recipient header members are not in the protected header")
+	}
+	return nil
+}
+
 // Serialize converts the message into a JWE JSON serialize format byte buffer
 func (s JSONSerialize) Serialize(m *Message) ([]byte, error) {
 	if s.Pretty {
@@ -3,6 +3,8 @@ package jwe
 import (
 	"bytes"
 	"testing"
+
+	"github.com/lestrrat-go/jwx/jwa"
 )
 
 var s = []byte(`eyJhbGciOiJSU0EtT0FFUCIsImVuYyI6IkEyNTZHQ00ifQ.OKOawDo13gRp2ojaHV7LFpZcgV7T6DVZKTyKOMTYUmKoTCVJRgckCL9kiMT03JGeipsEdY3mx_etLbbWSrFr05kLzcSr4qKAq7YN7e9jwQRb23nfa6c9d-StnImGyFDbSv04uVuxIp5Zms1gNxKKK2Da14B8S4rzVRltdYwam_lDp5XnZAYpQdb76FdIKLaVmqgfwX7XWRxv2322i-vDxRfqNzo_tETKzpVLzfiwQyeyPGLBIO56YJ7eObdv0je81860ppamavo35UgoRdbYaBcoh9QcfylQr66oc6vFWXRcZ_ZT2LawVCWTIy3brGPi6UklfCpIMfIjf7iGdXKHzg.48V1_ALb6US04U3b.5eym8TW_c8SuK0ltJ3rpYIzOeDQz7TALvtu6UG9oMo4vpzs9tX_EFShS8iB7j6jiSdiwkIr3ajwQzaBtQD_A.XFBoMYUZodetZdvTiFvSkQ`)
@@ -48,3 +50,25 @@ func SplitManual(parts [][]byte, buf []byte) {
 
 	parts[4] = buf
 }
+
+func BenchmarkCompressedRoundTrip(b *testing.B) {
+	const header = `{"alg":"A128KW","enc":"A128GCM","zip":"DEF"}`
+	sharedkey := []byte("Lorem ipsum dolo")
+	payload := bytes.Repeat([]byte(examplePayload), 16*1024)
+
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		compressed, ok := deflate(b, payload)
+		if !ok {
+			return
+		}
+		compact, ok := encryptCompactA128KW(b, header, sharedkey, jwa.A128GCM, compressed)
+		if !ok {
+			return
+		}
+		if _, err := Decrypt([]byte(compact), jwa.A128KW, sharedkey); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package jwk
+
+import (
+	"crypto/elliptic"
+
+	"github.com/lestrrat-go/jwx/internal/keyconv"
+	"github.com/lestrrat-go/jwx/jwa"
+)
+
+// SupportedAlgorithms returns the signature and key encryption algorithms
+// that can be used with the given key. The key may either be a jwk.Key,
+// or a raw key (*rsa.PrivateKey, *rsa.PublicKey, *ecdsa.PrivateKey,
+// *ecdsa.PublicKey, or []byte). Both values and pointers to the
+// RSA/ECDSA keys are accepted.
+//
+// Keys of unknown types result in empty lists.
+func SupportedAlgorithms(key interface{}) (sig []jwa.SignatureAlgorithm, keyenc []jwa.KeyEncryptionAlgorithm) {
+	if jwkKey, ok := key.(Key); ok {
+		raw, err := jwkKey.Materialize()
+		if err != nil {
+			return nil, nil
+		}
+		key = raw
+	}
+
+	if _, ok := keyconv.RSAPrivateKey(key); ok {
+		return rsaAlgorithms()
+	}
+	if _, ok := keyconv.RSAPublicKey(key); ok {
+		return rsaAlgorithms()
+	}
+	if privkey, ok := keyconv.ECDSAPrivateKey(key); ok {
+		return ecdsaAlgorithms(privkey.Curve)
+	}
+	if pubkey, ok := keyconv.ECDSAPublicKey(key); ok {
+		return ecdsaAlgorithms(pubkey.Curve)
+	}
+	if _, ok := key.([]byte); ok {
+		sig = []jwa.SignatureAlgorithm{jwa.HS256, jwa.HS384, jwa.HS512}
+		keyenc = []jwa.KeyEncryptionAlgorithm{
+			jwa.A128KW, jwa.A192KW, jwa.A256KW,
+			jwa.A128GCMKW, jwa.A192GCMKW, jwa.A256GCMKW,
+			jwa.DIRECT,
+			jwa.PBES2_HS256_A128KW, jwa.PBES2_HS384_A192KW, jwa.PBES2_HS512_A256KW,
+		}
+		return sig, keyenc
+	}
+	return nil, nil
+}
+
+func rsaAlgorithms() ([]jwa.SignatureAlgorithm, []jwa.KeyEncryptionAlgorithm) {
+	sig := []jwa.SignatureAlgorithm{jwa.RS256, jwa.RS384, jwa.RS512, jwa.PS256, jwa.PS384, jwa.PS512}
+	keyenc := []jwa.KeyEncryptionAlgorithm{jwa.RSA1_5, jwa.RSA_OAEP, jwa.RSA_OAEP_256}
+	return sig, keyenc
+}
+
+func ecdsaAlgorithms(crv elliptic.Curve) ([]jwa.SignatureAlgorithm, []jwa.KeyEncryptionAlgorithm) {
+	var sig []jwa.SignatureAlgorithm
+	if crv != nil {
+		// ECDSA signatures are bound to a specific curve
+		switch jwa.EllipticCurveAlgorithm(crv.Params().Name) {
+		case jwa.P256:
+			sig = []jwa.SignatureAlgorithm{jwa.ES256}
+		case jwa.P384:
+			sig = []jwa.SignatureAlgorithm{jwa.ES384}
+		case jwa.P521:
+			sig = []jwa.SignatureAlgorithm{jwa.ES512}
+		}
+	}
+	keyenc := []jwa.KeyEncryptionAlgorithm{jwa.ECDH_ES, jwa.ECDH_ES_A128KW, jwa.ECDH_ES_A192KW, jwa.ECDH_ES_A256KW}
+	return sig, keyenc
+}
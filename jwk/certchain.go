@@ -1,8 +1,12 @@
 package jwk
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -47,3 +51,38 @@ func (c *CertificateChain) Accept(v interface{}) error {
 		return errors.Errorf(`invalid value %T`, v)
 	}
 }
+
+// verifyX509Thumbprints checks that the "x5t" and "x5t#S256" parameters
+// of the key, if present, match the leaf certificate of its "x5c"
+// parameter. Keys without a certificate chain are not checked
+func verifyX509Thumbprints(k Key) error {
+	certs := k.X509CertChain()
+	if len(certs) == 0 {
+		return nil
+	}
+	leaf := certs[0].Raw
+
+	s1 := sha1.Sum(leaf)
+	if err := compareThumbprint(X509CertThumbprintKey, k.X509CertThumbprint(), s1[:]); err != nil {
+		return err
+	}
+	s256 := sha256.Sum256(leaf)
+	return compareThumbprint(X509CertThumbprintS256Key, k.X509CertThumbprintS256(), s256[:])
+}
+
+func compareThumbprint(name, encoded string, expected []byte) error {
+	if encoded == "" {
+		return nil
+	}
+
+	// Be lenient about padding, which is not allowed but is sometimes
+	// found in the wild
+	actual, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return errors.Wrapf(err, `failed to decode %s`, name)
+	}
+	if !bytes.Equal(actual, expected) {
+		return errors.Wrapf(ErrThumbprintMismatch, `invalid %s`, name)
+	}
+	return nil
+}
@@ -75,8 +75,8 @@ func (k ECDSAPublicKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
 	return ecdsaThumbprint(
 		hash,
 		k.key.Curve.Params().Name,
-		base64.EncodeToString(k.key.X.Bytes()),
-		base64.EncodeToString(k.key.Y.Bytes()),
+		base64.EncodeToString(curveBytes(k.key.Curve, k.key.X)),
+		base64.EncodeToString(curveBytes(k.key.Curve, k.key.Y)),
 	), nil
 }
 
@@ -86,8 +86,8 @@ func (k ECDSAPrivateKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
 	return ecdsaThumbprint(
 		hash,
 		k.key.Curve.Params().Name,
-		base64.EncodeToString(k.key.X.Bytes()),
-		base64.EncodeToString(k.key.Y.Bytes()),
+		base64.EncodeToString(curveBytes(k.key.Curve, k.key.X)),
+		base64.EncodeToString(curveBytes(k.key.Curve, k.key.Y)),
 	), nil
 }
 
@@ -110,6 +110,11 @@ func (k ECDSAPublicKey) MarshalJSON() (buf []byte, err error) {
 	return json.Marshal(m)
 }
 
+// MarshalPublicJSON is the same as MarshalJSON for public keys
+func (k ECDSAPublicKey) MarshalPublicJSON() ([]byte, error) {
+	return k.MarshalJSON()
+}
+
 func (k ECDSAPublicKey) PopulateMap(m map[string]interface{}) (err error) {
 	if pdebug.Enabled {
 		g := pdebug.Marker("jwk.ECDSAPublicKey.PopulateJSON").BindError(&err)
@@ -125,8 +130,8 @@ func (k ECDSAPublicKey) PopulateMap(m map[string]interface{}) (err error) {
 		yKey   = `y`
 		crvKey = `crv`
 	)
-	m[xKey] = base64.EncodeToString(k.key.X.Bytes())
-	m[yKey] = base64.EncodeToString(k.key.Y.Bytes())
+	m[xKey] = base64.EncodeToString(curveBytes(k.key.Curve, k.key.X))
+	m[yKey] = base64.EncodeToString(curveBytes(k.key.Curve, k.key.Y))
 	m[crvKey] = k.key.Curve.Params().Name
 
 	return nil
@@ -146,6 +151,11 @@ func (k ECDSAPrivateKey) MarshalJSON() (buf []byte, err error) {
 	return json.Marshal(m)
 }
 
+// MarshalPublicJSON serializes the key, omitting all private parameters
+func (k ECDSAPrivateKey) MarshalPublicJSON() ([]byte, error) {
+	return ECDSAPublicKey{headers: k.headers, key: &k.key.PublicKey}.MarshalJSON()
+}
+
 func (k ECDSAPrivateKey) PopulateMap(m map[string]interface{}) (err error) {
 	if pdebug.Enabled {
 		g := pdebug.Marker("jwk.ECDSAPrivateKey.PopulateJSON").BindError(&err)
@@ -165,7 +175,7 @@ func (k ECDSAPrivateKey) PopulateMap(m map[string]interface{}) (err error) {
 		return errors.Wrap(err, `failed to populate public key values`)
 	}
 
-	m[`d`] = base64.EncodeToString(k.key.D.Bytes())
+	m[`d`] = base64.EncodeToString(curveBytes(k.key.Curve, k.key.D))
 
 	return nil
 }
@@ -234,10 +244,22 @@ func (k *ECDSAPublicKey) ExtractMap(m map[string]interface{}) (err error) {
 	}
 	delete(m, yKey)
 
+	// Coordinates must be encoded using the full length of the curve
+	// https://tools.ietf.org/html/rfc7518#section-6.2.1.2
+	// Some producers drop leading zero bytes, so shorter coordinates are
+	// accepted as if they were left-padded. Longer ones are rejected
+	if size := crv.Size(); len(xbuf) > size || len(ybuf) > size {
+		return errors.Wrapf(ErrCoordinateLengthMismatch, `expected at most %d bytes for %s, got x = %d, y = %d`, size, crv, len(xbuf), len(ybuf))
+	}
+
 	var x, y big.Int
 	x.SetBytes(xbuf)
 	y.SetBytes(ybuf)
 
+	if !curve.IsOnCurve(&x, &y) {
+		return ErrInvalidCurvePoint
+	}
+
 	var hdrs StandardHeaders
 	if err := hdrs.ExtractMap(m); err != nil {
 		return errors.Wrap(err, `failed to extract header values`)
@@ -305,3 +327,17 @@ func (k *ECDSAPrivateKey) ExtractMap(m map[string]interface{}) (err error) {
 	pubkey.headers = nil
 	return nil
 }
+
+// curveBytes returns the big-endian representation of v, padded to the
+// byte length of the curve
+func curveBytes(curve elliptic.Curve, v *big.Int) []byte {
+	buf := v.Bytes()
+	size := (curve.Params().BitSize + 7) / 8
+	if len(buf) >= size {
+		return buf
+	}
+
+	padded := make([]byte, size)
+	copy(padded[size-len(buf):], buf)
+	return padded
+}
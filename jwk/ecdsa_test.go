@@ -1,13 +1,17 @@
 package jwk_test
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"encoding/json"
 	"testing"
 
+	"github.com/lestrrat-go/jwx/internal/base64"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -119,3 +123,123 @@ func TestECDSA(t *testing.T) {
 		}
 	})
 }
+
+func TestECDSA_CoordinateValidation(t *testing.T) {
+	// Public keys taken from RFC 7517 (P-256) and RFC 7520 (P-521)
+	vectors := []struct {
+		Curve string
+		X     string
+		Y     string
+	}{
+		{
+			Curve: "P-256",
+			X:     "MKBCTNIcKUSDii11ySs3526iDZ8AiTo7Tu6KPAqv7D4",
+			Y:     "4Etl6SRW2YiLUrN5vfvVHuhp7x8PxltmWWlbbM4IFyM",
+		},
+		{
+			Curve: "P-384",
+			X:     "YHVZ4gc1RDoqxKm4NzaN_Y1r7R7h3RM3JMteC478apSKUiLVb4UNytqWaLoE6ygH",
+			Y:     "CRKSqP-aYTIsqJfg_wZEEYUayUR5JhZaS2m4NLk2t1DfXZgfApAJ2lBO0vWKnUMp",
+		},
+		{
+			Curve: "P-521",
+			X:     "AHKZLLOsCOzz5cY97ewNUajB957y-C-U88c3v13nmGZx6sYl_oJXu9A5RkTKqjqvjyekWF-7ytDyRXYgCF5cj0Kt",
+			Y:     "AdymlHvOiLxXkEhayXQnNCvDX4h9htZaCJN34kfmC6pV5OhQHiraVySsUdaQkAgDPrwQrJmbnX9cwlGfP-HqHZR1",
+		},
+	}
+
+	build := func(crv, x, y string) string {
+		return `{"kty":"EC","crv":"` + crv + `","x":"` + x + `","y":"` + y + `"}`
+	}
+
+	for _, v := range vectors {
+		v := v
+		t.Run(v.Curve, func(t *testing.T) {
+			if _, err := jwk.ParseString(build(v.Curve, v.X, v.Y)); !assert.NoError(t, err, "valid key should be accepted") {
+				return
+			}
+
+			xbuf, err := base64.DecodeString(v.X)
+			if !assert.NoError(t, err, "decoding x should succeed") {
+				return
+			}
+			ybuf, err := base64.DecodeString(v.Y)
+			if !assert.NoError(t, err, "decoding y should succeed") {
+				return
+			}
+
+			// Oversized coordinate
+			oversized := base64.EncodeToString(append([]byte{0}, xbuf...))
+			_, err = jwk.ParseString(build(v.Curve, oversized, v.Y))
+			if !assert.Equal(t, jwk.ErrCoordinateLengthMismatch, errors.Cause(err), "oversized x should be rejected") {
+				return
+			}
+
+			// Truncated coordinate. Shorter coordinates are accepted as if
+			// left-padded, but dropping a non-zero byte moves the point
+			truncated := base64.EncodeToString(ybuf[1:])
+			_, err = jwk.ParseString(build(v.Curve, v.X, truncated))
+			if !assert.Equal(t, jwk.ErrInvalidCurvePoint, errors.Cause(err), "truncated y should be rejected") {
+				return
+			}
+
+			// Point not on curve
+			ybuf[len(ybuf)-1] ^= 0x01
+			_, err = jwk.ParseString(build(v.Curve, v.X, base64.EncodeToString(ybuf)))
+			if !assert.Equal(t, jwk.ErrInvalidCurvePoint, errors.Cause(err), "point not on curve should be rejected") {
+				return
+			}
+		})
+	}
+
+	t.Run("Roundtrip short coordinates", func(t *testing.T) {
+		// Find a key whose x coordinate has a leading zero byte, which
+		// must still be serialized using the full length
+		for i := 0; i < 10000; i++ {
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			if !assert.NoError(t, err, "key generation should succeed") {
+				return
+			}
+			if len(key.X.Bytes()) == 32 {
+				continue
+			}
+
+			jwkkey, err := jwk.New(&key.PublicKey)
+			if !assert.NoError(t, err, "jwk.New should succeed") {
+				return
+			}
+			buf, err := json.Marshal(jwkkey)
+			if !assert.NoError(t, err, "json.Marshal should succeed") {
+				return
+			}
+			if _, err := jwk.Parse(buf); !assert.NoError(t, err, "parsing serialized key should succeed") {
+				return
+			}
+
+			// The same key, with the leading zero byte of x dropped
+			var m map[string]interface{}
+			if !assert.NoError(t, json.Unmarshal(buf, &m), "json.Unmarshal should succeed") {
+				return
+			}
+			m["x"] = base64.EncodeToString(key.X.Bytes())
+			short, err := json.Marshal(m)
+			if !assert.NoError(t, err, "json.Marshal should succeed") {
+				return
+			}
+			parsed, err := jwk.Parse(short)
+			if !assert.NoError(t, err, "parsing a key with a short x should succeed") {
+				return
+			}
+			expected, err := jwkkey.Thumbprint(crypto.SHA256)
+			if !assert.NoError(t, err, "Thumbprint should succeed") {
+				return
+			}
+			actual, err := parsed.Keys[0].Thumbprint(crypto.SHA256)
+			if !assert.NoError(t, err, "Thumbprint should succeed") {
+				return
+			}
+			assert.Equal(t, expected, actual, "thumbprint should not depend on the encoding of x")
+			return
+		}
+	})
+}
@@ -26,10 +26,13 @@ type CertificateChain struct {
 
 // Errors related to JWK
 var (
-	ErrInvalidHeaderName  = errors.New("invalid header name")
-	ErrInvalidHeaderValue = errors.New("invalid value for header key")
-	ErrUnsupportedKty     = errors.New("unsupported kty")
-	ErrUnsupportedCurve   = errors.New("unsupported curve")
+	ErrInvalidHeaderName        = errors.New("invalid header name")
+	ErrInvalidHeaderValue       = errors.New("invalid value for header key")
+	ErrUnsupportedKty           = errors.New("unsupported kty")
+	ErrUnsupportedCurve         = errors.New("unsupported curve")
+	ErrCoordinateLengthMismatch = errors.New("coordinate length does not match curve")
+	ErrInvalidCurvePoint        = errors.New("point is not on curve")
+	ErrThumbprintMismatch       = errors.New("certificate thumbprint does not match x5c")
 )
 
 type KeyOperation string
@@ -70,6 +73,18 @@ type Key interface {
 	Thumbprint(crypto.Hash) ([]byte, error)
 }
 
+// publicJSONMarshaler is implemented by keys that can serialize only
+// their public parameters. See PublicJSON
+type publicJSONMarshaler interface {
+	MarshalPublicJSON() ([]byte, error)
+}
+
+// redacter is implemented by keys that can redact their secret
+// parameters. See Redact
+type redacter interface {
+	Redact() map[string]interface{}
+}
+
 type headers interface {
 	Headers
 }
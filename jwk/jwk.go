@@ -4,6 +4,7 @@
 package jwk
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
 	"encoding/json"
@@ -18,29 +19,88 @@ import (
 )
 
 // New creates a jwk.Key from the given key.
-func New(key interface{}) (Key, error) {
+//
+// If WithAutoKeyID is specified, the "kid" of the key is set to its
+// RFC 7638 thumbprint.
+func New(key interface{}, options ...Option) (Key, error) {
 	if key == nil {
 		return nil, errors.New(`jwk.New requires a non-nil key`)
 	}
 
+	var k Key
+	var err error
 	switch v := key.(type) {
 	case *rsa.PrivateKey:
-		return newRSAPrivateKey(v)
+		k, err = newRSAPrivateKey(v)
 	case *rsa.PublicKey:
-		return newRSAPublicKey(v)
+		k, err = newRSAPublicKey(v)
 	case *ecdsa.PrivateKey:
-		return newECDSAPrivateKey(v)
+		k, err = newECDSAPrivateKey(v)
 	case *ecdsa.PublicKey:
-		return newECDSAPublicKey(v)
+		k, err = newECDSAPublicKey(v)
 	case []byte:
-		return newSymmetricKey(v)
+		k, err = newSymmetricKey(v)
 	default:
 		return nil, errors.Errorf(`invalid key type %T`, key)
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyImportOptions(k, options); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// applyImportOptions applies the options that are common to all
+// functions that import keys
+func applyImportOptions(k Key, options []Option) error {
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyAutoKeyID:
+			if !option.Value().(bool) || k.KeyID() != "" {
+				continue
+			}
+			kid, err := ThumbprintKeyID(k)
+			if err != nil {
+				return errors.Wrap(err, `failed to compute key ID`)
+			}
+			if err := k.Set(KeyIDKey, kid); err != nil {
+				return errors.Wrap(err, `failed to set key ID`)
+			}
+		}
+	}
+	return nil
 }
 
-// Fetch fetches a JWK resource specified by a URL
-func Fetch(urlstring string) (*Set, error) {
+// ThumbprintKeyID returns the base64url encoded SHA-256 thumbprint
+// (https://tools.ietf.org/html/rfc7638) of the key, which is suitable
+// for use as a "kid"
+func ThumbprintKeyID(k Key) (string, error) {
+	tp, err := k.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", errors.Wrap(err, `failed to compute thumbprint`)
+	}
+	return base64.EncodeToString(tp), nil
+}
+
+// PublicJSON serializes only the public parameters of the key, even if
+// private parameters are present. This is useful to publish keys (e.g.
+// in a JWKS endpoint) without leaking private material. Symmetric keys
+// have no public parameters, and return an error, as do keys that do
+// not implement MarshalPublicJSON() ([]byte, error).
+func PublicJSON(k Key) ([]byte, error) {
+	pk, ok := k.(publicJSONMarshaler)
+	if !ok {
+		return nil, errors.Errorf(`key of type %T can not serialize its public parameters`, k)
+	}
+	return pk.MarshalPublicJSON()
+}
+
+// Fetch fetches a JWK resource specified by a URL. Remote resources
+// are fetched using the client specified by WithHTTPClient.
+func Fetch(urlstring string, options ...Option) (*Set, error) {
 	u, err := url.Parse(urlstring)
 	if err != nil {
 		return nil, errors.Wrap(err, `failed to parse url`)
@@ -49,7 +109,7 @@ func Fetch(urlstring string) (*Set, error) {
 	var src []byte
 	switch u.Scheme {
 	case "http", "https":
-		res, err := http.Get(u.String())
+		res, err := httpClientFromOptions(options).Get(u.String())
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to fetch remote JWK")
 		}
@@ -81,12 +141,14 @@ func Fetch(urlstring string) (*Set, error) {
 		return nil, errors.Errorf(`invalid url scheme %s`, u.Scheme)
 	}
 
-	return Parse(src)
+	return Parse(src, options...)
 }
 
-// FetchHTTP fetches the remote JWK and parses its contents
-func FetchHTTP(jwkurl string) (*Set, error) {
-	res, err := http.Get(jwkurl)
+// FetchHTTP fetches the remote JWK and parses its contents. The
+// request is made using the client specified by WithHTTPClient.
+// The options are also passed to Parse.
+func FetchHTTP(jwkurl string, options ...Option) (*Set, error) {
+	res, err := httpClientFromOptions(options).Get(jwkurl)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to fetch remote JWK")
 	}
@@ -102,7 +164,7 @@ func FetchHTTP(jwkurl string) (*Set, error) {
 	}
 	defer res.Body.Close()
 
-	return Parse(buf)
+	return Parse(buf, options...)
 }
 
 func (set *Set) UnmarshalJSON(data []byte) error {
@@ -115,7 +177,35 @@ func (set *Set) UnmarshalJSON(data []byte) error {
 }
 
 // Parse parses JWK from the incoming byte buffer.
-func Parse(buf []byte) (*Set, error) {
+//
+// If WithStrictThumbprint is specified, the "x5t" and "x5t#S256"
+// parameters of each key must match the leaf certificate of its
+// "x5c" parameter, if both are present.
+func Parse(buf []byte, options ...Option) (*Set, error) {
+	var strictThumbprint bool
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyStrictThumbprint:
+			strictThumbprint = option.Value().(bool)
+		}
+	}
+
+	set, err := parse(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if strictThumbprint {
+		for _, key := range set.Keys {
+			if err := verifyX509Thumbprints(key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return set, nil
+}
+
+func parse(buf []byte) (*Set, error) {
 	m := make(map[string]interface{})
 	if err := json.Unmarshal(buf, &m); err != nil {
 		return nil, errors.Wrap(err, "failed to unmarshal JWK")
@@ -141,8 +231,8 @@ func Parse(buf []byte) (*Set, error) {
 }
 
 // ParseString parses JWK from the incoming string.
-func ParseString(s string) (*Set, error) {
-	return Parse([]byte(s))
+func ParseString(s string, options ...Option) (*Set, error) {
+	return Parse([]byte(s), options...)
 }
 
 // LookupKeyID looks for keys matching the given key id. Note that the
@@ -1,12 +1,22 @@
 package jwk_test
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	stdbase64 "encoding/base64"
 	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/lestrrat-go/jwx/internal/base64"
 	"github.com/lestrrat-go/jwx/jwa"
@@ -436,3 +446,346 @@ func TestAppendix(t *testing.T) {
 		}
 	})
 }
+
+func TestSupportedAlgorithms(t *testing.T) {
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, "RSA key generated") {
+		return
+	}
+	ecdsakey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if !assert.NoError(t, err, "ECDSA key generated") {
+		return
+	}
+	jwkkey, err := jwk.New(&rsakey.PublicKey)
+	if !assert.NoError(t, err, "jwk.New should succeed") {
+		return
+	}
+
+	t.Run("RSA", func(t *testing.T) {
+		for _, key := range []interface{}{rsakey, rsakey.PublicKey, jwkkey} {
+			sig, keyenc := jwk.SupportedAlgorithms(key)
+			if !assert.Contains(t, sig, jwa.PS256, "PS256 should be supported") {
+				return
+			}
+			if !assert.Contains(t, keyenc, jwa.RSA_OAEP, "RSA-OAEP should be supported") {
+				return
+			}
+			if !assert.NotContains(t, sig, jwa.ES256, "ES256 should not be supported") {
+				return
+			}
+		}
+	})
+	t.Run("ECDSA", func(t *testing.T) {
+		sig, keyenc := jwk.SupportedAlgorithms(&ecdsakey.PublicKey)
+		if !assert.Equal(t, []jwa.SignatureAlgorithm{jwa.ES384}, sig, "only ES384 should be supported") {
+			return
+		}
+		if !assert.Contains(t, keyenc, jwa.ECDH_ES_A256KW, "ECDH-ES+A256KW should be supported") {
+			return
+		}
+	})
+	t.Run("Symmetric", func(t *testing.T) {
+		sig, keyenc := jwk.SupportedAlgorithms([]byte("secret"))
+		if !assert.Contains(t, sig, jwa.HS512, "HS512 should be supported") {
+			return
+		}
+		if !assert.Contains(t, keyenc, jwa.DIRECT, "dir should be supported") {
+			return
+		}
+	})
+	t.Run("Unknown", func(t *testing.T) {
+		sig, keyenc := jwk.SupportedAlgorithms("foo")
+		if !assert.Empty(t, sig, "no signature algorithms") {
+			return
+		}
+		if !assert.Empty(t, keyenc, "no key encryption algorithms") {
+			return
+		}
+	})
+}
+
+func TestPublicJSON(t *testing.T) {
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, "RSA key generated") {
+		return
+	}
+	ecdsakey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, "ECDSA key generated") {
+		return
+	}
+
+	privateParams := []string{"d", "p", "q", "dp", "dq", "qi"}
+	for _, raw := range []interface{}{rsakey, ecdsakey} {
+		key, err := jwk.New(raw)
+		if !assert.NoError(t, err, "jwk.New should succeed") {
+			return
+		}
+		key.Set(jwk.KeyIDKey, "my-key")
+
+		buf, err := jwk.PublicJSON(key)
+		if !assert.NoError(t, err, "PublicJSON should succeed") {
+			return
+		}
+
+		var m map[string]interface{}
+		if !assert.NoError(t, json.Unmarshal(buf, &m), "json.Unmarshal should succeed") {
+			return
+		}
+		for _, name := range privateParams {
+			if !assert.NotContains(t, m, name, "private parameter "+name+" should not be emitted") {
+				return
+			}
+		}
+		if !assert.Equal(t, "my-key", m["kid"], "kid should be preserved") {
+			return
+		}
+	}
+
+	symkey, err := jwk.New([]byte("secret"))
+	if !assert.NoError(t, err, "jwk.New should succeed") {
+		return
+	}
+	_, err = jwk.PublicJSON(symkey)
+	assert.Error(t, err, "PublicJSON should fail for symmetric keys")
+
+	_, err = jwk.PublicJSON(minimalKey{Headers: &jwk.StandardHeaders{}})
+	assert.Error(t, err, "PublicJSON should fail for keys without MarshalPublicJSON")
+}
+
+// minimalKey implements only the methods required by jwk.Key, as a
+// key type defined outside of this package would
+type minimalKey struct {
+	jwk.Headers
+}
+
+func (minimalKey) Materialize() (interface{}, error) {
+	return []byte("secret"), nil
+}
+
+func (minimalKey) Thumbprint(crypto.Hash) ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestWithAutoKeyID(t *testing.T) {
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, "RSA key generated") {
+		return
+	}
+
+	key, err := jwk.New(rsakey)
+	if !assert.NoError(t, err, "jwk.New should succeed") {
+		return
+	}
+	assert.Empty(t, key.KeyID(), "kid should not be set by default")
+
+	tp, err := key.Thumbprint(crypto.SHA256)
+	if !assert.NoError(t, err, "Thumbprint should succeed") {
+		return
+	}
+
+	// The thumbprint of the private key is the same as that of the
+	// public key, so both halves get the same kid
+	for _, raw := range []interface{}{rsakey, &rsakey.PublicKey} {
+		key, err := jwk.New(raw, jwk.WithAutoKeyID())
+		if !assert.NoError(t, err, "jwk.New should succeed") {
+			return
+		}
+		if !assert.Equal(t, base64.EncodeToString(tp), key.KeyID(), "kid should be the thumbprint") {
+			return
+		}
+	}
+}
+
+func TestParsePEM(t *testing.T) {
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, "RSA key generated") {
+		return
+	}
+	ecdsakey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, "ECDSA key generated") {
+		return
+	}
+
+	// x509.MarshalPKCS1PublicKey and x509.MarshalPKCS8PrivateKey require
+	// Go 1.10, so the PKCS #1 and PKCS #8 structures are built by hand
+	pkixRSA, _ := x509.MarshalPKIXPublicKey(&rsakey.PublicKey)
+	pkcs1RSA, _ := asn1.Marshal(struct {
+		N *big.Int
+		E int
+	}{N: rsakey.N, E: rsakey.E})
+	sec1ECDSA, _ := x509.MarshalECPrivateKey(ecdsakey)
+	oidP256, _ := asn1.Marshal(asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7})
+	pkcs8ECDSA, _ := asn1.Marshal(struct {
+		Version    int
+		Algo       pkix.AlgorithmIdentifier
+		PrivateKey []byte
+	}{
+		Algo: pkix.AlgorithmIdentifier{
+			Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1},
+			Parameters: asn1.RawValue{FullBytes: oidP256},
+		},
+		PrivateKey: sec1ECDSA,
+	})
+
+	testcases := []struct {
+		Block    *pem.Block
+		Expected interface{}
+	}{
+		{Block: &pem.Block{Type: "PUBLIC KEY", Bytes: pkixRSA}, Expected: &rsakey.PublicKey},
+		{Block: &pem.Block{Type: "RSA PUBLIC KEY", Bytes: pkcs1RSA}, Expected: &rsakey.PublicKey},
+		{Block: &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsakey)}, Expected: rsakey},
+		{Block: &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8ECDSA}, Expected: ecdsakey},
+		{Block: &pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1ECDSA}, Expected: ecdsakey},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Block.Type, func(t *testing.T) {
+			key, err := jwk.ParsePEM(pem.EncodeToMemory(tc.Block), jwk.WithAutoKeyID())
+			if !assert.NoError(t, err, "jwk.ParsePEM should succeed") {
+				return
+			}
+			if !assert.NotEmpty(t, key.KeyID(), "options should be applied") {
+				return
+			}
+
+			raw, err := key.Materialize()
+			if !assert.NoError(t, err, "Materialize should succeed") {
+				return
+			}
+			assert.Equal(t, tc.Expected, raw, "keys should match")
+		})
+	}
+
+	_, err = jwk.ParsePEM([]byte("not a PEM"))
+	assert.Error(t, err, "jwk.ParsePEM should fail for non-PEM input")
+
+	_, err = jwk.ParsePEM(pem.EncodeToMemory(&pem.Block{Type: "UNKNOWN", Bytes: []byte{0}}))
+	assert.Error(t, err, "jwk.ParsePEM should fail for unsupported block types")
+}
+
+func TestStrictThumbprint(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, "ECDSA key generated") {
+		return
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if !assert.NoError(t, err, "creating certificate should succeed") {
+		return
+	}
+
+	jwkKey, err := jwk.New(&key.PublicKey)
+	if !assert.NoError(t, err, "jwk.New should succeed") {
+		return
+	}
+
+	makeJWK := func(t *testing.T, x5tS256 string) []byte {
+		buf, err := json.Marshal(jwkKey)
+		if !assert.NoError(t, err, "json.Marshal should succeed") {
+			return nil
+		}
+		var m map[string]interface{}
+		if !assert.NoError(t, json.Unmarshal(buf, &m), "json.Unmarshal should succeed") {
+			return nil
+		}
+		m[jwk.X509CertChainKey] = []string{stdbase64.StdEncoding.EncodeToString(der)}
+		m[jwk.X509CertThumbprintS256Key] = x5tS256
+		buf, err = json.Marshal(m)
+		if !assert.NoError(t, err, "json.Marshal should succeed") {
+			return nil
+		}
+		return buf
+	}
+
+	sum := sha256.Sum256(der)
+	good := makeJWK(t, base64.EncodeToString(sum[:]))
+	sum[0] ^= 0xff
+	bad := makeJWK(t, base64.EncodeToString(sum[:]))
+	if good == nil || bad == nil {
+		return
+	}
+
+	t.Run("Matching thumbprint", func(t *testing.T) {
+		set, err := jwk.Parse(good, jwk.WithStrictThumbprint())
+		if !assert.NoError(t, err, "jwk.Parse should succeed") {
+			return
+		}
+		assert.Len(t, set.Keys, 1, "there should be 1 key")
+	})
+	t.Run("Mismatching thumbprint", func(t *testing.T) {
+		_, err := jwk.Parse(bad, jwk.WithStrictThumbprint())
+		assert.Equal(t, jwk.ErrThumbprintMismatch, errors.Cause(err), "jwk.Parse should fail with ErrThumbprintMismatch")
+	})
+	t.Run("Mismatching thumbprint in a set", func(t *testing.T) {
+		src := []byte(`{"keys":[` + string(good) + `,` + string(bad) + `]}`)
+		_, err := jwk.Parse(src, jwk.WithStrictThumbprint())
+		assert.Equal(t, jwk.ErrThumbprintMismatch, errors.Cause(err), "jwk.Parse should fail with ErrThumbprintMismatch")
+	})
+	t.Run("Not strict", func(t *testing.T) {
+		_, err := jwk.Parse(bad)
+		assert.NoError(t, err, "jwk.Parse should succeed")
+	})
+}
+
+func TestRedact(t *testing.T) {
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, "RSA key generated") {
+		return
+	}
+	ecdsakey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, "ECDSA key generated") {
+		return
+	}
+
+	for _, raw := range []interface{}{rsakey, ecdsakey, []byte("Lorem ipsum dolor sit amet")} {
+		key, err := jwk.New(raw)
+		if !assert.NoError(t, err, "jwk.New should succeed") {
+			return
+		}
+		key.Set(jwk.KeyIDKey, "my-key")
+
+		t.Run(fmt.Sprintf("%T", key), func(t *testing.T) {
+			var secret string
+			switch key.KeyType() {
+			case jwa.RSA, jwa.EC:
+				secret = `d`
+			case jwa.OctetSeq:
+				secret = `k`
+			}
+
+			serialized, err := json.Marshal(key)
+			if !assert.NoError(t, err, "json.Marshal should succeed") {
+				return
+			}
+			var m map[string]interface{}
+			if !assert.NoError(t, json.Unmarshal(serialized, &m), "json.Unmarshal should succeed") {
+				return
+			}
+			value, ok := m[secret].(string)
+			if !assert.True(t, ok, "serialized key should contain the secret parameter") {
+				return
+			}
+
+			redacted := jwk.Redact(key)
+			assert.Equal(t, "REDACTED", redacted[secret], "secret parameter should be redacted")
+			assert.Equal(t, "my-key", redacted[jwk.KeyIDKey], "kid should be kept")
+			assert.Equal(t, m[jwk.KeyTypeKey], redacted[jwk.KeyTypeKey], "kty should be kept")
+
+			for _, format := range []string{"%v", "%s", "%#v", "%+v"} {
+				s := fmt.Sprintf(format, key)
+				if !assert.NotContains(t, s, value, "formatted key should not contain the secret") {
+					return
+				}
+				if !assert.Contains(t, s, "my-key", "formatted key should contain the kid") {
+					return
+				}
+			}
+		})
+	}
+}
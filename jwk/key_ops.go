@@ -43,3 +43,19 @@ func (ops *KeyOperationList) Accept(v interface{}) error {
 		return errors.Errorf(`invalid value %T`, v)
 	}
 }
+
+// Permits returns true if any of the given operations is listed. An
+// empty list permits all operations, as "key_ops" is optional
+func (ops KeyOperationList) Permits(candidates ...KeyOperation) bool {
+	if len(ops) == 0 {
+		return true
+	}
+	for _, op := range ops {
+		for _, candidate := range candidates {
+			if op == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
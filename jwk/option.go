@@ -0,0 +1,88 @@
+package jwk
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/lestrrat-go/jwx/internal/httpclient"
+	"github.com/lestrrat-go/jwx/internal/option"
+)
+
+type Option = option.Interface
+
+const (
+	optkeyRefreshInterval     = `refresh-interval`
+	optkeyMinRefreshInterval  = `min-refresh-interval`
+	optkeyRefreshErrorHandler = `refresh-error-handler`
+	optkeyRefreshMaxSize      = `refresh-max-size`
+	optkeyHTTPClient          = `http-client`
+	optkeyAutoKeyID           = `auto-key-id`
+	optkeyStrictThumbprint    = `strict-thumbprint`
+)
+
+// DefaultHTTPTimeout is the timeout of the HTTP client used to fetch
+// remote resources, unless a client is specified via WithHTTPClient
+const DefaultHTTPTimeout = httpclient.DefaultTimeout
+
+// WithHTTPClient specifies the HTTP client used by Fetch, FetchHTTP
+// and AutoRefresh to fetch remote JWK sets. If not specified, a client
+// with a timeout of DefaultHTTPTimeout is used.
+func WithHTTPClient(cl *http.Client) Option {
+	return option.New(optkeyHTTPClient, cl)
+}
+
+func httpClientFromOptions(options []Option) *http.Client {
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyHTTPClient:
+			if cl := option.Value().(*http.Client); cl != nil {
+				return cl
+			}
+		}
+	}
+	return httpclient.Default
+}
+
+// WithAutoKeyID specifies that keys imported without a "kid" should
+// be assigned one derived from their RFC 7638 SHA-256 thumbprint.
+// See ThumbprintKeyID for the exact format.
+func WithAutoKeyID() Option {
+	return option.New(optkeyAutoKeyID, true)
+}
+
+// WithRefreshInterval specifies a fixed interval in which AutoRefresh
+// refreshes the JWK set. When specified, the caching headers sent by
+// the server are ignored.
+func WithRefreshInterval(d time.Duration) Option {
+	return option.New(optkeyRefreshInterval, d)
+}
+
+// WithMinRefreshInterval specifies the minimum interval between two
+// refreshes when AutoRefresh computes the interval from the caching
+// headers sent by the server. It is also used as the interval when
+// the server does not send any caching headers, and as the retry
+// interval after a failed refresh.
+func WithMinRefreshInterval(d time.Duration) Option {
+	return option.New(optkeyMinRefreshInterval, d)
+}
+
+// WithRefreshErrorHandler specifies a function that is called every time
+// AutoRefresh fails to refresh the JWK set, including failures during
+// background refreshes.
+func WithRefreshErrorHandler(f func(url string, err error)) Option {
+	return option.New(optkeyRefreshErrorHandler, f)
+}
+
+// WithRefreshMaxSize specifies the maximum number of bytes that
+// AutoRefresh reads when fetching the JWK set
+func WithRefreshMaxSize(n int64) Option {
+	return option.New(optkeyRefreshMaxSize, n)
+}
+
+// WithStrictThumbprint specifies that Parse should verify that the
+// "x5t" and "x5t#S256" parameters of each key match the thumbprints of
+// the leaf certificate in its "x5c" parameter. Keys whose thumbprints
+// do not match are rejected with ErrThumbprintMismatch.
+func WithStrictThumbprint() Option {
+	return option.New(optkeyStrictThumbprint, true)
+}
@@ -0,0 +1,80 @@
+package jwk
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// ParsePEM parses the first PEM block in `src` and creates a jwk.Key
+// from it. The following block types are supported:
+//
+//     PUBLIC KEY       (PKIX encoded RSA or ECDSA public key)
+//     RSA PUBLIC KEY   (PKCS #1 encoded RSA public key)
+//     RSA PRIVATE KEY  (PKCS #1 encoded RSA private key)
+//     EC PRIVATE KEY   (SEC 1 encoded ECDSA private key)
+//     PRIVATE KEY      (PKCS #8 encoded RSA or ECDSA private key)
+//     CERTIFICATE      (the public key of the certificate)
+//
+// The options are the same as those accepted by New.
+func ParsePEM(src []byte, options ...Option) (Key, error) {
+	block, _ := pem.Decode(src)
+	if block == nil {
+		return nil, errors.New(`failed to find PEM block`)
+	}
+
+	var raw interface{}
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		raw, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		raw, err = parsePKCS1PublicKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		raw, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		raw, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		raw, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			raw = cert.PublicKey
+		}
+	default:
+		return nil, errors.Errorf(`unsupported PEM block type %s`, block.Type)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, `failed to parse PEM block of type %s`, block.Type)
+	}
+
+	return New(raw, options...)
+}
+
+// pkcs1PublicKey is the ASN.1 structure of a PKCS #1 RSA public key
+type pkcs1PublicKey struct {
+	N *big.Int
+	E int
+}
+
+// parsePKCS1PublicKey parses a PKCS #1 RSA public key. It is used in
+// place of x509.ParsePKCS1PublicKey, which requires Go 1.10
+func parsePKCS1PublicKey(der []byte) (*rsa.PublicKey, error) {
+	var pub pkcs1PublicKey
+	rest, err := asn1.Unmarshal(der, &pub)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to parse PKCS #1 public key`)
+	}
+	if len(rest) > 0 {
+		return nil, errors.New(`trailing data after PKCS #1 public key`)
+	}
+	if pub.N.Sign() <= 0 || pub.E <= 0 {
+		return nil, errors.New(`invalid PKCS #1 public key`)
+	}
+	return &rsa.PublicKey{N: pub.N, E: pub.E}, nil
+}
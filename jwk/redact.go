@@ -0,0 +1,112 @@
+package jwk
+
+import (
+	"encoding/json"
+
+	"github.com/lestrrat-go/jwx/internal/redact"
+)
+
+// Redact returns the JSON representation of the key, with the values of
+// secret parameters (such as "d" and "k") replaced with "REDACTED". The
+// keys in this package are also redacted when formatted using the fmt
+// package, but their JSON serialization is unaffected.
+func Redact(k Key) map[string]interface{} {
+	if r, ok := k.(redacter); ok {
+		return r.Redact()
+	}
+	return redactKey(k)
+}
+
+// redactKey returns the JSON representation of the key, with the
+// values of the secret parameters replaced
+func redactKey(k interface{}) map[string]interface{} {
+	buf, err := json.Marshal(k)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	m, err := redact.JSON(buf)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	return m
+}
+
+// Redact returns the JSON representation of the key, with the values
+// of secret parameters replaced with "REDACTED"
+func (k RSAPublicKey) Redact() map[string]interface{} {
+	return redactKey(k)
+}
+
+// String returns the redacted JSON representation of the key
+func (k RSAPublicKey) String() string {
+	return redact.Format(``, k.Redact())
+}
+
+// GoString returns the redacted JSON representation of the key
+func (k RSAPublicKey) GoString() string {
+	return redact.Format(`jwk.RSAPublicKey`, k.Redact())
+}
+
+// Redact returns the JSON representation of the key, with the values
+// of secret parameters replaced with "REDACTED"
+func (k RSAPrivateKey) Redact() map[string]interface{} {
+	return redactKey(k)
+}
+
+// String returns the redacted JSON representation of the key
+func (k RSAPrivateKey) String() string {
+	return redact.Format(``, k.Redact())
+}
+
+// GoString returns the redacted JSON representation of the key
+func (k RSAPrivateKey) GoString() string {
+	return redact.Format(`jwk.RSAPrivateKey`, k.Redact())
+}
+
+// Redact returns the JSON representation of the key, with the values
+// of secret parameters replaced with "REDACTED"
+func (k ECDSAPublicKey) Redact() map[string]interface{} {
+	return redactKey(k)
+}
+
+// String returns the redacted JSON representation of the key
+func (k ECDSAPublicKey) String() string {
+	return redact.Format(``, k.Redact())
+}
+
+// GoString returns the redacted JSON representation of the key
+func (k ECDSAPublicKey) GoString() string {
+	return redact.Format(`jwk.ECDSAPublicKey`, k.Redact())
+}
+
+// Redact returns the JSON representation of the key, with the values
+// of secret parameters replaced with "REDACTED"
+func (k ECDSAPrivateKey) Redact() map[string]interface{} {
+	return redactKey(k)
+}
+
+// String returns the redacted JSON representation of the key
+func (k ECDSAPrivateKey) String() string {
+	return redact.Format(``, k.Redact())
+}
+
+// GoString returns the redacted JSON representation of the key
+func (k ECDSAPrivateKey) GoString() string {
+	return redact.Format(`jwk.ECDSAPrivateKey`, k.Redact())
+}
+
+// Redact returns the JSON representation of the key, with the values
+// of secret parameters replaced with "REDACTED"
+func (s SymmetricKey) Redact() map[string]interface{} {
+	return redactKey(s)
+}
+
+// String returns the redacted JSON representation of the key
+func (s SymmetricKey) String() string {
+	return redact.Format(``, s.Redact())
+}
+
+// GoString returns the redacted JSON representation of the key
+func (s SymmetricKey) GoString() string {
+	return redact.Format(`jwk.SymmetricKey`, s.Redact())
+}
@@ -0,0 +1,265 @@
+package jwk
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultMinRefreshInterval is the minimum refresh interval used by
+// AutoRefresh, unless overridden by WithMinRefreshInterval
+const DefaultMinRefreshInterval = 15 * time.Minute
+
+// DefaultRefreshMaxSize is the maximum number of bytes that AutoRefresh
+// reads from the remote server, unless overridden by WithRefreshMaxSize
+const DefaultRefreshMaxSize = 1024 * 1024
+
+// AutoRefresh keeps a remote JWK set fresh by periodically fetching it
+// in the background, and serves the cached copy to callers. Concurrent
+// requests that require a fetch are coalesced into a single request
+// to the remote server.
+//
+//     ar := jwk.NewAutoRefresh(ctx)
+//     ar.Configure(`https://example.com/.well-known/jwks.json`)
+//     ...
+//     set, err := ar.Fetch(ctx)
+//
+// The background goroutine stops when the context given to
+// NewAutoRefresh is canceled.
+type AutoRefresh struct {
+	ctx         context.Context
+	reconfigure chan struct{}
+	startOnce   sync.Once
+
+	mu                 sync.RWMutex
+	url                string
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+	errorHandler       func(string, error)
+	httpClient         *http.Client
+	maxSize            int64
+	set                *Set
+	nextRefresh        time.Time
+	inflight           map[string]*refreshCall
+}
+
+type refreshCall struct {
+	done chan struct{}
+	set  *Set
+	err  error
+}
+
+// NewAutoRefresh creates a new AutoRefresh. `ctx` controls the
+// lifetime of the background refresh goroutine, as well as the
+// requests it makes.
+func NewAutoRefresh(ctx context.Context) *AutoRefresh {
+	return &AutoRefresh{
+		ctx:                ctx,
+		reconfigure:        make(chan struct{}, 1),
+		minRefreshInterval: DefaultMinRefreshInterval,
+		maxSize:            DefaultRefreshMaxSize,
+		inflight:           make(map[string]*refreshCall),
+	}
+}
+
+// Configure sets the URL of the JWK set to be refreshed. Calling it
+// again replaces the URL and options, and discards the cached set if
+// the URL has changed. The set is fetched using the client specified
+// by WithHTTPClient.
+func (af *AutoRefresh) Configure(url string, options ...Option) {
+	refreshInterval := time.Duration(0)
+	minRefreshInterval := DefaultMinRefreshInterval
+	var maxSize int64 = DefaultRefreshMaxSize
+	var errorHandler func(string, error)
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyRefreshInterval:
+			refreshInterval = option.Value().(time.Duration)
+		case optkeyMinRefreshInterval:
+			minRefreshInterval = option.Value().(time.Duration)
+		case optkeyRefreshErrorHandler:
+			errorHandler = option.Value().(func(string, error))
+		case optkeyRefreshMaxSize:
+			maxSize = option.Value().(int64)
+		}
+	}
+	httpClient := httpClientFromOptions(options)
+
+	af.mu.Lock()
+	if af.url != url {
+		af.set = nil
+		af.nextRefresh = time.Time{}
+	}
+	af.url = url
+	af.refreshInterval = refreshInterval
+	af.minRefreshInterval = minRefreshInterval
+	af.errorHandler = errorHandler
+	af.httpClient = httpClient
+	af.maxSize = maxSize
+	af.mu.Unlock()
+
+	af.startOnce.Do(func() { go af.refreshLoop() })
+
+	select {
+	case af.reconfigure <- struct{}{}:
+	default:
+	}
+}
+
+// Fetch returns the cached JWK set. If no set has been fetched yet,
+// or the last refresh failed before anything was cached, a refresh
+// is performed (or joined, if one is already in progress) and Fetch
+// waits for it to finish or for `ctx` to be canceled.
+func (af *AutoRefresh) Fetch(ctx context.Context) (*Set, error) {
+	af.mu.RLock()
+	url, set := af.url, af.set
+	af.mu.RUnlock()
+
+	if url == "" {
+		return nil, errors.New(`AutoRefresh has not been configured`)
+	}
+	if set != nil {
+		return set, nil
+	}
+	return af.refresh(ctx)
+}
+
+// refresh fetches the JWK set, coalescing concurrent calls for the
+// same URL. Calls are never coalesced with a fetch of a URL that was
+// configured earlier
+func (af *AutoRefresh) refresh(ctx context.Context) (*Set, error) {
+	af.mu.Lock()
+	call, ok := af.inflight[af.url]
+	if !ok {
+		call = &refreshCall{done: make(chan struct{})}
+		af.inflight[af.url] = call
+		go af.doRefresh(call, af.url, af.httpClient, af.maxSize)
+	}
+	af.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-call.done:
+		return call.set, call.err
+	}
+}
+
+func (af *AutoRefresh) doRefresh(call *refreshCall, url string, cl *http.Client, maxSize int64) {
+	// The request is tied to the lifetime of AutoRefresh rather than
+	// any caller, as the result is shared among all of them
+	set, interval, err := fetchWithInterval(af.ctx, cl, url, maxSize)
+
+	af.mu.Lock()
+	// Do not touch the state if the URL was changed while fetching
+	if af.url == url {
+		now := time.Now()
+		switch {
+		case err != nil:
+			af.nextRefresh = now.Add(af.minRefreshInterval)
+		case af.refreshInterval > 0:
+			af.nextRefresh = now.Add(af.refreshInterval)
+		default:
+			if interval < af.minRefreshInterval {
+				interval = af.minRefreshInterval
+			}
+			af.nextRefresh = now.Add(interval)
+		}
+		if err == nil {
+			af.set = set
+		}
+	}
+	errorHandler := af.errorHandler
+	delete(af.inflight, url)
+	call.set, call.err = set, err
+	close(call.done)
+	af.mu.Unlock()
+
+	if err != nil && errorHandler != nil {
+		errorHandler(url, err)
+	}
+}
+
+func (af *AutoRefresh) refreshLoop() {
+	for {
+		af.mu.RLock()
+		wait := time.Until(af.nextRefresh)
+		af.mu.RUnlock()
+		if wait < 0 {
+			wait = 0
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-af.ctx.Done():
+			timer.Stop()
+			return
+		case <-af.reconfigure:
+			timer.Stop()
+		case <-timer.C:
+			af.refresh(af.ctx)
+		}
+	}
+}
+
+// fetchWithInterval fetches the JWK set, and returns the refresh
+// interval suggested by the caching headers in the response. If no
+// usable headers are present, the interval is 0.
+func fetchWithInterval(ctx context.Context, cl *http.Client, url string, maxSize int64) (*Set, time.Duration, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to create request")
+	}
+
+	res, err := cl.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to fetch remote JWK")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, 0, errors.New("failed to fetch remote JWK (status != 200)")
+	}
+
+	buf, err := ioutil.ReadAll(io.LimitReader(res.Body, maxSize+1))
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to read JWK HTTP response body")
+	}
+	if int64(len(buf)) > maxSize {
+		return nil, 0, errors.Errorf("JWK HTTP response body exceeds %d bytes", maxSize)
+	}
+
+	set, err := Parse(buf)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to parse JWK set")
+	}
+	return set, refreshIntervalFromHeaders(res.Header), nil
+}
+
+func refreshIntervalFromHeaders(h http.Header) time.Duration {
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		if secs, err := strconv.ParseInt(strings.TrimPrefix(directive, "max-age="), 10, 64); err == nil && secs > 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+
+	if v := h.Get("Expires"); v != "" {
+		if expires, err := http.ParseTime(v); err == nil {
+			if d := time.Until(expires); d > 0 {
+				return d
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,224 @@
+package jwk_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestJWKS(t *testing.T) ([]byte, bool) {
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, "RSA key generated") {
+		return nil, false
+	}
+	key, err := jwk.New(&rsakey.PublicKey)
+	if !assert.NoError(t, err, "jwk.New should succeed") {
+		return nil, false
+	}
+	buf, err := json.Marshal(jwk.Set{Keys: []jwk.Key{key}})
+	if !assert.NoError(t, err, "json.Marshal should succeed") {
+		return nil, false
+	}
+	return buf, true
+}
+
+func TestAutoRefresh(t *testing.T) {
+	jwks, ok := makeTestJWKS(t)
+	if !ok {
+		return
+	}
+
+	t.Run("Concurrent fetches are coalesced", func(t *testing.T) {
+		var hits int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			time.Sleep(100 * time.Millisecond)
+			w.Header().Set("Cache-Control", "max-age=3600")
+			w.Write(jwks)
+		}))
+		defer srv.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ar := jwk.NewAutoRefresh(ctx)
+		ar.Configure(srv.URL)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				set, err := ar.Fetch(ctx)
+				if assert.NoError(t, err, "Fetch should succeed") {
+					assert.Len(t, set.Keys, 1, "set should contain one key")
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits), "server should be hit once")
+	})
+	t.Run("Refreshes in the background", func(t *testing.T) {
+		var hits int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			w.Write(jwks)
+		}))
+		defer srv.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ar := jwk.NewAutoRefresh(ctx)
+		ar.Configure(srv.URL, jwk.WithRefreshInterval(50*time.Millisecond))
+
+		_, err := ar.Fetch(ctx)
+		if !assert.NoError(t, err, "Fetch should succeed") {
+			return
+		}
+		time.Sleep(300 * time.Millisecond)
+		assert.True(t, atomic.LoadInt32(&hits) >= 3, "server should be hit repeatedly")
+	})
+	t.Run("Reconfigured URL is not served from a stale fetch", func(t *testing.T) {
+		other, ok := makeTestJWKS(t)
+		if !ok {
+			return
+		}
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			w.Write(jwks)
+		}))
+		defer slow.Close()
+		defer close(release)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(other)
+		}))
+		defer srv.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ar := jwk.NewAutoRefresh(ctx)
+		ar.Configure(slow.URL)
+		<-started
+		ar.Configure(srv.URL)
+
+		set, err := ar.Fetch(ctx)
+		if !assert.NoError(t, err, "Fetch should succeed") {
+			return
+		}
+		expected, err := jwk.Parse(other)
+		if !assert.NoError(t, err, "jwk.Parse should succeed") {
+			return
+		}
+		expectedTP, err := expected.Keys[0].Thumbprint(crypto.SHA256)
+		if !assert.NoError(t, err, "Thumbprint should succeed") {
+			return
+		}
+		tp, err := set.Keys[0].Thumbprint(crypto.SHA256)
+		if !assert.NoError(t, err, "Thumbprint should succeed") {
+			return
+		}
+		assert.Equal(t, expectedTP, tp, "set should come from the new URL")
+	})
+	t.Run("Response too large", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(jwks)
+		}))
+		defer srv.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ar := jwk.NewAutoRefresh(ctx)
+		ar.Configure(srv.URL, jwk.WithRefreshMaxSize(16))
+		_, err := ar.Fetch(ctx)
+		assert.Error(t, err, "Fetch should fail")
+	})
+	t.Run("Errors are reported", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		errCh := make(chan error, 10)
+		ar := jwk.NewAutoRefresh(ctx)
+		ar.Configure(srv.URL, jwk.WithRefreshErrorHandler(func(_ string, err error) {
+			errCh <- err
+		}))
+
+		_, err := ar.Fetch(ctx)
+		if !assert.Error(t, err, "Fetch should fail") {
+			return
+		}
+
+		select {
+		case err := <-errCh:
+			assert.Error(t, err, "error handler should receive an error")
+		case <-time.After(time.Second):
+			t.Errorf("error handler was not called")
+		}
+	})
+}
+
+type countingTransport struct {
+	count int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.count, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	jwks, ok := makeTestJWKS(t)
+	if !ok {
+		return
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(jwks)
+	}))
+	defer srv.Close()
+
+	var transport countingTransport
+	cl := &http.Client{Transport: &transport}
+
+	_, err := jwk.Fetch(srv.URL, jwk.WithHTTPClient(cl))
+	if !assert.NoError(t, err, "jwk.Fetch should succeed") {
+		return
+	}
+	_, err = jwk.FetchHTTP(srv.URL, jwk.WithHTTPClient(cl))
+	if !assert.NoError(t, err, "jwk.FetchHTTP should succeed") {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ar := jwk.NewAutoRefresh(ctx)
+	ar.Configure(srv.URL, jwk.WithHTTPClient(cl))
+	_, err = ar.Fetch(ctx)
+	if !assert.NoError(t, err, "AutoRefresh.Fetch should succeed") {
+		return
+	}
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&transport.count), "all requests should go through the given client")
+}
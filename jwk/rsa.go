@@ -75,6 +75,11 @@ func (k RSAPublicKey) MarshalJSON() (buf []byte, err error) {
 	return json.Marshal(m)
 }
 
+// MarshalPublicJSON is the same as MarshalJSON for public keys
+func (k RSAPublicKey) MarshalPublicJSON() ([]byte, error) {
+	return k.MarshalJSON()
+}
+
 func (k RSAPublicKey) PopulateMap(m map[string]interface{}) (err error) {
 	if pdebug.Enabled {
 		g := pdebug.Marker("jwk.RSAPublicKey.PopulateJSON").BindError(&err)
@@ -161,6 +166,11 @@ func (k RSAPrivateKey) MarshalJSON() (buf []byte, err error) {
 	return json.Marshal(m)
 }
 
+// MarshalPublicJSON serializes the key, omitting all private parameters
+func (k RSAPrivateKey) MarshalPublicJSON() ([]byte, error) {
+	return RSAPublicKey{headers: k.headers, key: &k.key.PublicKey}.MarshalJSON()
+}
+
 func (k RSAPrivateKey) PopulateMap(m map[string]interface{}) (err error) {
 	if pdebug.Enabled {
 		g := pdebug.Marker("jwk.RSAPrivateKey.PopulateMap").BindError(&err)
@@ -168,12 +178,13 @@ func (k RSAPrivateKey) PopulateMap(m map[string]interface{}) (err error) {
 	}
 
 	const (
-		dKey  = `d`
-		pKey  = `p`
-		qKey  = `q`
-		dpKey = `dp`
-		dqKey = `dq`
-		qiKey = `qi`
+		dKey   = `d`
+		pKey   = `p`
+		qKey   = `q`
+		dpKey  = `dp`
+		dqKey  = `dq`
+		qiKey  = `qi`
+		othKey = `oth`
 	)
 
 	if err := k.headers.PopulateMap(m); err != nil {
@@ -200,9 +211,64 @@ func (k RSAPrivateKey) PopulateMap(m map[string]interface{}) (err error) {
 	if v := k.key.Precomputed.Qinv; v != nil {
 		m[qiKey] = base64.EncodeToString(v.Bytes())
 	}
+	if len(k.key.Primes) > 2 {
+		m[othKey] = otherPrimesInfo(k.key)
+	}
 	return nil
 }
 
+// otherPrimesInfo returns the "oth" parameter for multi-prime keys,
+// as described in https://tools.ietf.org/html/rfc7518#section-6.3.2.7
+func otherPrimesInfo(key *rsa.PrivateKey) []interface{} {
+	var list []interface{}
+	one := big.NewInt(1)
+	r := new(big.Int).Mul(key.Primes[0], key.Primes[1])
+	for _, prime := range key.Primes[2:] {
+		var d, t big.Int
+		d.Mod(key.D, new(big.Int).Sub(prime, one))
+		t.ModInverse(r, prime)
+		list = append(list, map[string]interface{}{
+			`r`: base64.EncodeToString(prime.Bytes()),
+			`d`: base64.EncodeToString(d.Bytes()),
+			`t`: base64.EncodeToString(t.Bytes()),
+		})
+		r.Mul(r, prime)
+	}
+	return list
+}
+
+// extractOtherPrimes parses the "oth" parameter of multi-prime keys
+func extractOtherPrimes(v interface{}) ([]*big.Int, []rsa.CRTValue, error) {
+	list, ok := v.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, nil, errors.Errorf(`invalid type for parameter 'oth': %T`, v)
+	}
+
+	primes := make([]*big.Int, len(list))
+	crtValues := make([]rsa.CRTValue, len(list))
+	for i, elem := range list {
+		info, ok := elem.(map[string]interface{})
+		if !ok {
+			return nil, nil, errors.Errorf(`invalid type for element #%d of 'oth': %T`, i+1, elem)
+		}
+
+		var values [3]*big.Int
+		for j, name := range []string{`r`, `d`, `t`} {
+			buf, err := getRequiredKey(info, name)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, `invalid element #%d of 'oth'`, i+1)
+			}
+			values[j] = new(big.Int).SetBytes(buf)
+		}
+		if values[0].Cmp(big.NewInt(1)) <= 0 {
+			return nil, nil, errors.Errorf(`invalid prime in element #%d of 'oth'`, i+1)
+		}
+		primes[i] = values[0]
+		crtValues[i] = rsa.CRTValue{Exp: values[1], Coeff: values[2]}
+	}
+	return primes, crtValues, nil
+}
+
 func (k *RSAPrivateKey) UnmarshalJSON(data []byte) (err error) {
 	if pdebug.Enabled {
 		g := pdebug.Marker("jwk.RSAPrivateKey.UnmarshalJSON").BindError(&err)
@@ -232,12 +298,13 @@ func (k *RSAPrivateKey) ExtractMap(m map[string]interface{}) (err error) {
 	}
 
 	const (
-		dKey  = `d`
-		pKey  = `p`
-		qKey  = `q`
-		dpKey = `dp`
-		dqKey = `dq`
-		qiKey = `qi`
+		dKey   = `d`
+		pKey   = `p`
+		qKey   = `q`
+		dpKey  = `dp`
+		dqKey  = `dq`
+		qiKey  = `qi`
+		othKey = `oth`
 	)
 
 	dbuf, err := getRequiredKey(m, dKey)
@@ -289,6 +356,17 @@ func (k *RSAPrivateKey) ExtractMap(m map[string]interface{}) (err error) {
 		qi.SetBytes(qibuf)
 	}
 
+	var othPrimes []*big.Int
+	var othCRTValues []rsa.CRTValue
+	if v, ok := m[othKey]; ok {
+		delete(m, othKey)
+
+		othPrimes, othCRTValues, err = extractOtherPrimes(v)
+		if err != nil {
+			return errors.Wrap(err, `failed to extract other primes`)
+		}
+	}
+
 	var pubkey RSAPublicKey
 	if err := pubkey.ExtractMap(m); err != nil {
 		return errors.Wrap(err, `failed to extract fields for public key`)
@@ -303,7 +381,22 @@ func (k *RSAPrivateKey) ExtractMap(m map[string]interface{}) (err error) {
 	var key rsa.PrivateKey
 	key.PublicKey = *rsaPubkey
 	key.D = &d
-	key.Primes = []*big.Int{&p, &q}
+	key.Primes = append([]*big.Int{&p, &q}, othPrimes...)
+
+	if len(othPrimes) > 0 {
+		// The primes of a multi-prime key must multiply up to the
+		// modulus, and each CRT value carries the product of the
+		// preceding primes
+		r := new(big.Int).Mul(&p, &q)
+		for i, prime := range othPrimes {
+			othCRTValues[i].R = new(big.Int).Set(r)
+			r.Mul(r, prime)
+		}
+		if r.Cmp(key.N) != 0 {
+			return errors.New(`product of primes does not match modulus`)
+		}
+		key.Precomputed.CRTValues = othCRTValues
+	}
 
 	if dp != nil {
 		key.Precomputed.Dp = dp
@@ -315,6 +408,12 @@ func (k *RSAPrivateKey) ExtractMap(m map[string]interface{}) (err error) {
 		key.Precomputed.Qinv = qi
 	}
 
+	if len(othPrimes) > 0 {
+		if err := validateMultiPrimeKey(&key); err != nil {
+			return errors.Wrap(err, `invalid multi-prime RSA private key`)
+		}
+	}
+
 	*k = RSAPrivateKey{
 		headers: pubkey.headers,
 		key:     &key,
@@ -322,6 +421,50 @@ func (k *RSAPrivateKey) ExtractMap(m map[string]interface{}) (err error) {
 	return nil
 }
 
+// validateMultiPrimeKey checks that the private exponent and the CRT
+// values of a multi-prime key are consistent with its primes, and
+// replaces the CRT values with ones computed from the validated key.
+// rsa.PrivateKey.Validate alone is not enough, as some versions of Go
+// do not check the private exponent of multi-prime keys
+func validateMultiPrimeKey(key *rsa.PrivateKey) error {
+	if err := key.Validate(); err != nil {
+		return err
+	}
+
+	one := big.NewInt(1)
+	de := new(big.Int).Mul(key.D, big.NewInt(int64(key.E)))
+	for _, prime := range key.Primes {
+		pminus1 := new(big.Int).Sub(prime, one)
+		if new(big.Int).Mod(de, pminus1).Cmp(one) != 0 {
+			return errors.New(`private exponent does not match primes`)
+		}
+	}
+
+	supplied := key.Precomputed
+	key.Precomputed = rsa.PrecomputedValues{}
+	key.Precompute()
+
+	computed := key.Precomputed
+	if !equalOptionalInt(supplied.Dp, computed.Dp) || !equalOptionalInt(supplied.Dq, computed.Dq) || !equalOptionalInt(supplied.Qinv, computed.Qinv) {
+		return errors.New(`CRT values do not match primes`)
+	}
+	if len(supplied.CRTValues) != len(computed.CRTValues) {
+		return errors.New(`CRT values do not match primes`)
+	}
+	for i, v := range supplied.CRTValues {
+		if !equalOptionalInt(v.Exp, computed.CRTValues[i].Exp) || !equalOptionalInt(v.Coeff, computed.CRTValues[i].Coeff) {
+			return errors.New(`CRT values do not match primes`)
+		}
+	}
+	return nil
+}
+
+// equalOptionalInt reports whether the supplied value is either absent
+// or equal to the computed one
+func equalOptionalInt(supplied, computed *big.Int) bool {
+	return supplied == nil || (computed != nil && supplied.Cmp(computed) == 0)
+}
+
 // Thumbprint returns the JWK thumbprint using the indicated
 // hashing algorithm, according to RFC 7638
 func (k RSAPrivateKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
@@ -2,6 +2,7 @@ package jwk_test
 
 import (
 	"crypto"
+	"crypto/rand"
 	"crypto/rsa"
 	"encoding/json"
 	"strings"
@@ -182,3 +183,83 @@ func TestRSA(t *testing.T) {
 		}
 	})
 }
+
+func TestRSAMultiPrime(t *testing.T) {
+	rsakey, err := rsa.GenerateMultiPrimeKey(rand.Reader, 3, 2048)
+	if !assert.NoError(t, err, "RSA key generated") {
+		return
+	}
+
+	key, err := jwk.New(rsakey)
+	if !assert.NoError(t, err, "jwk.New should succeed") {
+		return
+	}
+
+	buf, err := json.Marshal(key)
+	if !assert.NoError(t, err, "json.Marshal should succeed") {
+		return
+	}
+
+	var m map[string]interface{}
+	if !assert.NoError(t, json.Unmarshal(buf, &m), "json.Unmarshal should succeed") {
+		return
+	}
+	if !assert.Len(t, m["oth"], 1, "oth should contain the third prime") {
+		return
+	}
+
+	set, err := jwk.Parse(buf)
+	if !assert.NoError(t, err, "jwk.Parse should succeed") {
+		return
+	}
+	materialized, err := set.Keys[0].Materialize()
+	if !assert.NoError(t, err, "Materialize should succeed") {
+		return
+	}
+	parsed := materialized.(*rsa.PrivateKey)
+	if !assert.Equal(t, rsakey.Primes, parsed.Primes, "primes should match") {
+		return
+	}
+	if !assert.NoError(t, parsed.Validate(), "parsed key should be valid") {
+		return
+	}
+
+	buf2, err := json.Marshal(set.Keys[0])
+	if !assert.NoError(t, err, "json.Marshal should succeed") {
+		return
+	}
+	var m2 map[string]interface{}
+	if !assert.NoError(t, json.Unmarshal(buf2, &m2), "json.Unmarshal should succeed") {
+		return
+	}
+	if !assert.Equal(t, m, m2, "keys should round-trip") {
+		return
+	}
+
+	// A private exponent that does not match the primes must be detected
+	d := m["d"]
+	m["d"] = "Aw"
+	tampered, _ := json.Marshal(m)
+	_, err = jwk.Parse(tampered)
+	if !assert.Error(t, err, "jwk.Parse should fail for invalid private exponent") {
+		return
+	}
+	m["d"] = d
+
+	// So must CRT values that do not match the primes
+	oth := m["oth"].([]interface{})[0].(map[string]interface{})
+	exp := oth["d"]
+	oth["d"] = "Aw"
+	tampered, _ = json.Marshal(m)
+	_, err = jwk.Parse(tampered)
+	if !assert.Error(t, err, "jwk.Parse should fail for invalid CRT values") {
+		return
+	}
+	oth["d"] = exp
+
+	// Tampering with a prime must be detected
+	m["oth"].([]interface{})[0].(map[string]interface{})["r"] = "Aw"
+	tampered, _ = json.Marshal(m)
+	_, err = jwk.Parse(tampered)
+	assert.Error(t, err, "jwk.Parse should fail for invalid primes")
+}
@@ -102,6 +102,12 @@ func (s SymmetricKey) MarshalJSON() (buf []byte, err error) {
 	return json.Marshal(m)
 }
 
+// MarshalPublicJSON always fails, as symmetric keys do not have
+// any public parameters
+func (s SymmetricKey) MarshalPublicJSON() ([]byte, error) {
+	return nil, errors.New(`symmetric keys do not have public parameters`)
+}
+
 func (s SymmetricKey) PopulateMap(m map[string]interface{}) (err error) {
 	if pdebug.Enabled {
 		g := pdebug.Marker("jwk.SymmetricKey.PopulateMap").BindError(&err)
@@ -0,0 +1,97 @@
+package jws
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// B64Key is the name of the header parameter that specifies whether
+// the payload is base64url encoded (https://tools.ietf.org/html/rfc7797).
+// Set it to false in the protected header to sign unencoded payloads.
+const B64Key = "b64"
+
+// isPayloadEncoded reports whether the payload is base64url encoded,
+// according to the "b64" parameter in the given headers. As required by
+// RFC 7797, "b64" must be listed in "crit" when it is false.
+func isPayloadEncoded(h Headers) (bool, error) {
+	if h == nil {
+		return true, nil
+	}
+
+	v, ok := h.Get(B64Key)
+	if !ok {
+		return true, nil
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, errors.Errorf(`invalid value for %s header: %T`, B64Key, v)
+	}
+	if b {
+		return true, nil
+	}
+
+	for _, crit := range h.Critical() {
+		if crit == B64Key {
+			return false, nil
+		}
+	}
+	return false, errors.Errorf(`%s header must be listed in %s`, B64Key, CriticalKey)
+}
+
+// isPayloadEncodedProtected is the same as isPayloadEncoded, but takes
+// the base64url encoded protected header
+func isPayloadEncodedProtected(protected string) (bool, error) {
+	if len(protected) == 0 {
+		return true, nil
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(protected)
+	if err != nil {
+		return false, errors.Wrap(err, `failed to decode protected headers`)
+	}
+	var hdr StandardHeaders
+	if err := json.Unmarshal(decoded, &hdr); err != nil {
+		return false, errors.Wrap(err, `failed to parse protected headers`)
+	}
+	return isPayloadEncoded(&hdr)
+}
+
+// prepareB64 reports whether the payload should be base64url encoded
+// when signing with the given protected headers. If "b64" is false, it
+// is added to "crit" when missing.
+func prepareB64(h Headers) (bool, error) {
+	v, ok := h.Get(B64Key)
+	if !ok {
+		return true, nil
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, errors.Errorf(`invalid value for %s header: %T`, B64Key, v)
+	}
+	if b {
+		return true, nil
+	}
+
+	crit := h.Critical()
+	for _, v := range crit {
+		if v == B64Key {
+			return false, nil
+		}
+	}
+	if err := h.Set(CriticalKey, append(append([]string(nil), crit...), B64Key)); err != nil {
+		return false, errors.Wrap(err, `failed to set crit header`)
+	}
+	return false, nil
+}
+
+// decodePayload returns the payload as it was signed
+func decodePayload(payload string, encoded bool) ([]byte, error) {
+	if !encoded {
+		return []byte(payload), nil
+	}
+	return base64.RawURLEncoding.DecodeString(payload)
+}
@@ -0,0 +1,159 @@
+package jws
+
+import (
+	"container/list"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/pkg/errors"
+)
+
+// Cache is used by WithVerificationCache to remember the payloads of
+// messages that were successfully verified. Implementations must be
+// safe for concurrent use.
+type Cache interface {
+	// Get returns the payload stored under `key`, if it has not expired
+	Get(key string) ([]byte, bool)
+	// Set stores the payload under `key` for the duration of `ttl`
+	Set(key string, payload []byte, ttl time.Duration)
+}
+
+type verificationCache struct {
+	cache Cache
+	ttl   time.Duration
+}
+
+// DefaultMemoryCacheMaxEntries is the maximum number of entries kept by
+// a MemoryCache, unless specified otherwise via WithCacheMaxEntries
+const DefaultMemoryCacheMaxEntries = 10000
+
+// MemoryCache is a simple in-memory Cache. It holds at most a fixed
+// number of entries, and evicts the least recently used entry when it
+// is full. Expired entries are removed lazily when they are looked up,
+// or when they are evicted.
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List // front is the most recently used
+}
+
+type memoryCacheEntry struct {
+	key     string
+	payload []byte
+	expires time.Time
+}
+
+// NewMemoryCache creates a new MemoryCache. Use WithCacheMaxEntries to
+// specify the maximum number of entries.
+func NewMemoryCache(options ...Option) *MemoryCache {
+	maxEntries := DefaultMemoryCacheMaxEntries
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyCacheMaxEntries:
+			maxEntries = option.Value().(int)
+		}
+	}
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Get fulfills the Cache interface. The returned payload is a copy, and
+// may be modified by the caller.
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := elem.Value.(*memoryCacheEntry)
+	if !time.Now().Before(e.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return append([]byte(nil), e.payload...), true
+}
+
+// Set fulfills the Cache interface. The payload is copied, so the caller
+// may modify it afterwards.
+func (c *MemoryCache) Set(key string, payload []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := &memoryCacheEntry{
+		key:     key,
+		payload: append([]byte(nil), payload...),
+		expires: time.Now().Add(ttl),
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = e
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	for c.lru.Len() >= c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+	c.entries[key] = c.lru.PushFront(e)
+}
+
+// Len returns the number of entries in the cache, including expired
+// entries that have not been removed yet
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *MemoryCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*memoryCacheEntry).key)
+}
+
+// verificationCacheKey computes the cache key for the message `buf`
+// verified using `keys`. The fingerprint of the keys, including their
+// "alg", "use" and "key_ops", is included, so that cached results are
+// not used once the key set changes. So are the options that change the
+// outcome of the verification, so that a result obtained with lenient
+// options is not used for a stricter verification.
+func verificationCacheKey(buf []byte, keys []jwk.Key, strict bool) (string, error) {
+	h := sha256.New()
+	tokenHash := sha256.Sum256(buf)
+	h.Write(tokenHash[:])
+	if strict {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+	for _, key := range keys {
+		tp, err := key.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return "", errors.Wrap(err, `failed to compute key thumbprint`)
+		}
+		h.Write(tp)
+		h.Write([]byte(key.Algorithm()))
+		h.Write([]byte{0})
+		h.Write([]byte(key.KeyUsage()))
+		h.Write([]byte{0})
+		for _, op := range key.KeyOps() {
+			h.Write([]byte(op))
+			h.Write([]byte{0})
+		}
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
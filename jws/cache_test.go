@@ -0,0 +1,176 @@
+package jws_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingCache struct {
+	*jws.MemoryCache
+	hits int
+	sets int
+}
+
+func (c *countingCache) Get(key string) ([]byte, bool) {
+	v, ok := c.MemoryCache.Get(key)
+	if ok {
+		c.hits++
+	}
+	return v, ok
+}
+
+func (c *countingCache) Set(key string, payload []byte, ttl time.Duration) {
+	c.sets++
+	c.MemoryCache.Set(key, payload, ttl)
+}
+
+func TestVerificationCache(t *testing.T) {
+	newKey := func(secret string) jwk.Key {
+		key, err := jwk.New([]byte(secret))
+		if !assert.NoError(t, err, "jwk.New should succeed") {
+			t.FailNow()
+		}
+		key.Set(jwk.AlgorithmKey, jwa.HS256)
+		return key
+	}
+
+	signed, err := jws.Sign([]byte("Lorem ipsum"), jwa.HS256, []byte("secret"))
+	if !assert.NoError(t, err, "jws.Sign should succeed") {
+		return
+	}
+
+	cache := &countingCache{MemoryCache: jws.NewMemoryCache()}
+	option := jws.WithVerificationCache(cache, time.Minute)
+	set := &jwk.Set{Keys: []jwk.Key{newKey("secret")}}
+
+	for i := 0; i < 2; i++ {
+		payload, err := jws.VerifyWithJWKSet(signed, set, nil, option)
+		if !assert.NoError(t, err, "jws.VerifyWithJWKSet should succeed") {
+			return
+		}
+		if !assert.Equal(t, []byte("Lorem ipsum"), payload, "payload should match") {
+			return
+		}
+	}
+	if !assert.Equal(t, 1, cache.sets, "result should be cached once") {
+		return
+	}
+	if !assert.Equal(t, 1, cache.hits, "second verification should hit the cache") {
+		return
+	}
+
+	// A change in the key set invalidates the cached result
+	set.Keys = append(set.Keys, newKey("other"))
+	if _, err := jws.VerifyWithJWKSet(signed, set, nil, option); !assert.NoError(t, err, "jws.VerifyWithJWKSet should succeed") {
+		return
+	}
+	if !assert.Equal(t, 1, cache.hits, "changed key set should not hit the cache") {
+		return
+	}
+
+	// Failures are never cached
+	sets := cache.sets
+	wrong := &jwk.Set{Keys: []jwk.Key{newKey("wrong")}}
+	for i := 0; i < 2; i++ {
+		_, err := jws.VerifyWithJWKSet(signed, wrong, nil, option)
+		if !assert.Error(t, err, "jws.VerifyWithJWKSet should fail") {
+			return
+		}
+	}
+	assert.Equal(t, sets, cache.sets, "failures should not be cached")
+}
+
+func TestVerificationCache_Options(t *testing.T) {
+	key := []byte("secret")
+	signed, err := jws.Sign([]byte("Lorem ipsum"), jwa.HS256, key)
+	if !assert.NoError(t, err, "jws.Sign should succeed") {
+		return
+	}
+
+	// Same as in TestVerify_StrictBase64
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	last := strings.IndexByte(alphabet, signed[len(signed)-1])
+	tampered := append(append([]byte(nil), signed[:len(signed)-1]...), alphabet[last|1])
+
+	jwkKey, err := jwk.New(key)
+	if !assert.NoError(t, err, "jwk.New should succeed") {
+		return
+	}
+	jwkKey.Set(jwk.AlgorithmKey, jwa.HS256)
+	set := &jwk.Set{Keys: []jwk.Key{jwkKey}}
+
+	cache := &countingCache{MemoryCache: jws.NewMemoryCache()}
+	option := jws.WithVerificationCache(cache, time.Minute)
+
+	_, err = jws.VerifyWithJWKSet(tampered, set, nil, option)
+	if !assert.NoError(t, err, "lenient verification should succeed") {
+		return
+	}
+
+	_, err = jws.VerifyWithJWKSet(tampered, set, nil, option, jws.WithStrictBase64())
+	if !assert.Error(t, err, "strict verification should not use the lenient result") {
+		return
+	}
+	if !assert.Equal(t, 0, cache.hits, "strict verification should not hit the cache") {
+		return
+	}
+
+	// A change in "key_ops" invalidates the cached result
+	_, err = jws.VerifyWithJWKSet(signed, set, nil, option)
+	if !assert.NoError(t, err, "verification should succeed") {
+		return
+	}
+	jwkKey.Set(jwk.KeyOpsKey, jwk.KeyOperationList{jwk.KeyOpVerify, jwk.KeyOpSign})
+	_, err = jws.VerifyWithJWKSet(signed, set, nil, option)
+	if !assert.NoError(t, err, "verification should succeed") {
+		return
+	}
+	assert.Equal(t, 0, cache.hits, "changed key_ops should not hit the cache")
+}
+
+func TestMemoryCache(t *testing.T) {
+	t.Run("Payloads are copied", func(t *testing.T) {
+		cache := jws.NewMemoryCache()
+		payload := []byte("Lorem ipsum")
+		cache.Set("key", payload, time.Minute)
+		payload[0] = 'X'
+
+		got, ok := cache.Get("key")
+		if !assert.True(t, ok, "Get should find the entry") {
+			return
+		}
+		assert.Equal(t, []byte("Lorem ipsum"), got, "stored payload should not change")
+
+		got[0] = 'X'
+		got, _ = cache.Get("key")
+		assert.Equal(t, []byte("Lorem ipsum"), got, "cached payload should not change")
+	})
+	t.Run("Least recently used entries are evicted", func(t *testing.T) {
+		cache := jws.NewMemoryCache(jws.WithCacheMaxEntries(2))
+		cache.Set("a", []byte("a"), time.Minute)
+		cache.Set("b", []byte("b"), time.Minute)
+		cache.Get("a")
+		cache.Set("c", []byte("c"), time.Minute)
+
+		assert.Equal(t, 2, cache.Len(), "cache should be bounded")
+		_, ok := cache.Get("b")
+		assert.False(t, ok, "least recently used entry should be evicted")
+		_, ok = cache.Get("a")
+		assert.True(t, ok, "recently used entry should be kept")
+		_, ok = cache.Get("c")
+		assert.True(t, ok, "new entry should be kept")
+	})
+	t.Run("Expired entries", func(t *testing.T) {
+		cache := jws.NewMemoryCache()
+		cache.Set("key", []byte("Lorem ipsum"), -time.Second)
+		_, ok := cache.Get("key")
+		assert.False(t, ok, "expired entry should not be returned")
+		assert.Equal(t, 0, cache.Len(), "expired entry should be removed")
+	})
+}
@@ -210,9 +210,21 @@ func (h *StandardHeaders) Set(name string, value interface{}) error {
 		}
 		return errors.Errorf(`invalid value for %s key: %T`, ContentTypeKey, value)
 	case CriticalKey:
-		if v, ok := value.([]string); ok {
+		switch v := value.(type) {
+		case []string:
 			h.critical = v
 			return nil
+		case []interface{}:
+			l := make([]string, len(v))
+			for i, e := range v {
+				s, ok := e.(string)
+				if !ok {
+					return errors.Errorf(`invalid list element for %s key: %T`, CriticalKey, e)
+				}
+				l[i] = s
+			}
+			h.critical = l
+			return nil
 		}
 		return errors.Errorf(`invalid value for %s key: %T`, CriticalKey, value)
 	case JWKKey:
@@ -240,9 +252,21 @@ func (h *StandardHeaders) Set(name string, value interface{}) error {
 		}
 		return errors.Errorf(`invalid value for %s key: %T`, TypeKey, value)
 	case X509CertChainKey:
-		if v, ok := value.([]string); ok {
+		switch v := value.(type) {
+		case []string:
 			h.x509CertChain = v
 			return nil
+		case []interface{}:
+			l := make([]string, len(v))
+			for i, e := range v {
+				s, ok := e.(string)
+				if !ok {
+					return errors.Errorf(`invalid list element for %s key: %T`, X509CertChainKey, e)
+				}
+				l[i] = s
+			}
+			h.x509CertChain = l
+			return nil
 		}
 		return errors.Errorf(`invalid value for %s key: %T`, X509CertChainKey, value)
 	case X509CertThumbprintKey:
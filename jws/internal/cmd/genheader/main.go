@@ -224,6 +224,25 @@ func generateHeaders() error {
 				fmt.Fprintf(&buf, "\n}") // end if err := h.%s.Accept(value)
 			}
 			fmt.Fprintf(&buf, "\nreturn nil")
+		} else if f.typ == `[]string` {
+			// JSON decoding yields []interface{} for lists
+			fmt.Fprintf(&buf, "\nswitch v := value.(type) {")
+			fmt.Fprintf(&buf, "\ncase []string:")
+			fmt.Fprintf(&buf, "\nh.%s = v", f.name)
+			fmt.Fprintf(&buf, "\nreturn nil")
+			fmt.Fprintf(&buf, "\ncase []interface{}:")
+			fmt.Fprintf(&buf, "\nl := make([]string, len(v))")
+			fmt.Fprintf(&buf, "\nfor i, e := range v {")
+			fmt.Fprintf(&buf, "\ns, ok := e.(string)")
+			fmt.Fprintf(&buf, "\nif !ok {")
+			fmt.Fprintf(&buf, "\nreturn errors.Errorf(`invalid list element for %%s key: %%T`, %sKey, e)", f.method)
+			fmt.Fprintf(&buf, "\n}") // end if !ok
+			fmt.Fprintf(&buf, "\nl[i] = s")
+			fmt.Fprintf(&buf, "\n}") // end for i, e := range v
+			fmt.Fprintf(&buf, "\nh.%s = l", f.name)
+			fmt.Fprintf(&buf, "\nreturn nil")
+			fmt.Fprintf(&buf, "\n}") // end switch v := value.(type)
+			fmt.Fprintf(&buf, "\nreturn errors.Errorf(`invalid value for %%s key: %%T`, %sKey, value)", f.method)
 		} else {
 			if f.IsPointer() {
 				fmt.Fprintf(&buf, "\nif v, ok := value.(%s); ok {", f.PointerElem())
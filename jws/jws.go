@@ -27,9 +27,14 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"io"
+	"net/http"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
+	jwxbase64 "github.com/lestrrat-go/jwx/internal/base64"
+	"github.com/lestrrat-go/jwx/internal/envelope"
+	"github.com/lestrrat-go/jwx/internal/keyconv"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/lestrrat-go/jwx/jws/sign"
@@ -38,6 +43,26 @@ import (
 	"github.com/pkg/errors"
 )
 
+// Errors used in JWS
+var (
+	// ErrAmbiguousPayload is returned when a detached payload is supplied
+	// for verification, but the message carries a payload of its own
+	ErrAmbiguousPayload = errors.New(`message contains a payload, but a detached payload was also supplied`)
+	// ErrMissingAlgorithm is returned when the JOSE header of a message
+	// does not contain the "alg" parameter
+	ErrMissingAlgorithm = errors.New(`missing "alg" in JOSE header`)
+	// ErrNilKey is returned when a nil key is given to one of the
+	// signing or verification functions. The returned error is wrapped
+	// with the name of the offending parameter
+	ErrNilKey = errors.New(`key must not be nil`)
+	// ErrTrailingData is returned when a compact serialization is
+	// followed by extra segments or other non-whitespace data
+	ErrTrailingData = errors.New(`trailing data after compact serialization`)
+	// ErrNonCanonicalBase64 is returned by Verify when WithStrictBase64
+	// is specified, and a segment is not canonically base64url encoded
+	ErrNonCanonicalBase64 = jwxbase64.ErrNonCanonical
+)
+
 // Sign is a short way to generate a JWS in compact serialization
 // for a given payload. If you need more control over the signature
 // generation process, you should manually create signers and tweak
@@ -85,7 +110,15 @@ func (s *payloadSigner) PublicHeader() Headers {
 // multiple signers.
 //
 // If you would like to pass custom headers, use the WithHeaders option.
+//
+// If the "b64" header is set to false, the payload is written
+// unencoded (https://tools.ietf.org/html/rfc7797). In this case the
+// payload may not contain the '.' character.
 func Sign(payload []byte, alg jwa.SignatureAlgorithm, key interface{}, options ...Option) ([]byte, error) {
+	if keyconv.IsNil(key) {
+		return nil, errors.Wrap(ErrNilKey, `invalid parameter "key"`)
+	}
+
 	var hdrs Headers = &StandardHeaders{}
 	for _, o := range options {
 		switch o.Name() {
@@ -101,6 +134,14 @@ func Sign(payload []byte, alg jwa.SignatureAlgorithm, key interface{}, options .
 
 	hdrs.Set(AlgorithmKey, signer.Algorithm())
 
+	encodePayload, err := prepareB64(hdrs)
+	if err != nil {
+		return nil, err
+	}
+	if !encodePayload && bytes.IndexByte(payload, '.') >= 0 {
+		return nil, errors.New(`unencoded payload must not contain '.' in compact serialization`)
+	}
+
 	hdrbuf, err := json.Marshal(hdrs)
 	if err != nil {
 		return nil, errors.Wrap(err, `failed to marshal headers`)
@@ -116,12 +157,16 @@ func Sign(payload []byte, alg jwa.SignatureAlgorithm, key interface{}, options .
 	}
 
 	buf.WriteByte('.')
-	enc = base64.NewEncoder(base64.RawURLEncoding, &buf)
-	if _, err := enc.Write(payload); err != nil {
-		return nil, errors.Wrap(err, `failed to write payload as base64`)
-	}
-	if err := enc.Close(); err != nil {
-		return nil, errors.Wrap(err, `failed to finalize writing payload as base64`)
+	if encodePayload {
+		enc = base64.NewEncoder(base64.RawURLEncoding, &buf)
+		if _, err := enc.Write(payload); err != nil {
+			return nil, errors.Wrap(err, `failed to write payload as base64`)
+		}
+		if err := enc.Close(); err != nil {
+			return nil, errors.Wrap(err, `failed to finalize writing payload as base64`)
+		}
+	} else {
+		buf.Write(payload)
 	}
 
 	signature, err := signer.Sign(buf.Bytes(), key)
@@ -144,6 +189,9 @@ func Sign(payload []byte, alg jwa.SignatureAlgorithm, key interface{}, options .
 // SignMulti accepts multiple signers via the options parameter,
 // and creates a JWS in JSON serialization format that contains
 // signatures from applying aforementioned signers.
+//
+// If the "b64" header is set to false in the protected headers, the
+// payload is written unencoded. All signers must agree on this value.
 func SignMulti(payload []byte, options ...Option) ([]byte, error) {
 	var signers []PayloadSigner
 	for _, o := range options {
@@ -157,18 +205,48 @@ func SignMulti(payload []byte, options ...Option) ([]byte, error) {
 		return nil, errors.New(`no signers provided`)
 	}
 
-	var result EncodedMessage
-
-	result.Payload = base64.RawURLEncoding.EncodeToString(payload)
+	for i, signer := range signers {
+		if ps, ok := signer.(*payloadSigner); ok && keyconv.IsNil(ps.key) {
+			return nil, errors.Wrapf(ErrNilKey, `invalid key for signer #%d`, i+1)
+		}
+	}
 
-	for _, signer := range signers {
+	// All signatures must agree on whether the payload is encoded
+	// (https://tools.ietf.org/html/rfc7797#section-3)
+	protectedHeaders := make([]Headers, len(signers))
+	var encodePayload bool
+	for i, signer := range signers {
 		protected := signer.ProtectedHeader()
 		if protected == nil {
 			protected = &StandardHeaders{}
 		}
-
 		protected.Set(AlgorithmKey, signer.Algorithm())
 
+		encoded, err := prepareB64(protected)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 && encoded != encodePayload {
+			return nil, errors.Errorf(`all signers must use the same value for %s header`, B64Key)
+		}
+		encodePayload = encoded
+		protectedHeaders[i] = protected
+	}
+
+	var result EncodedMessage
+
+	if encodePayload {
+		result.Payload = base64.RawURLEncoding.EncodeToString(payload)
+	} else {
+		if !utf8.Valid(payload) {
+			return nil, errors.New(`unencoded payload must be valid UTF-8 in JSON serialization`)
+		}
+		result.Payload = string(payload)
+	}
+
+	for i, signer := range signers {
+		protected := protectedHeaders[i]
+
 		hdrbuf, err := json.Marshal(protected)
 		if err != nil {
 			return nil, errors.Wrap(err, `failed to marshal headers`)
@@ -198,20 +276,77 @@ func SignMulti(payload []byte, options ...Option) ([]byte, error) {
 // payload that was signed is returned. If you need more fine-grained
 // control of the verification process, manually call `Parse`, generate a
 // verifier, and call `Verify` on the parsed JWS message object.
-func Verify(buf []byte, alg jwa.SignatureAlgorithm, key interface{}) (ret []byte, err error) {
+//
+// If WithStrictBase64 is specified, messages whose segments are not
+// canonically base64url encoded are rejected with ErrNonCanonicalBase64.
+func Verify(buf []byte, alg jwa.SignatureAlgorithm, key interface{}, options ...Option) (ret []byte, err error) {
 	if pdebug.Enabled {
 		g := pdebug.Marker("jws.Verify").BindError(&err)
 		defer g.End()
 	}
 
+	ret, _, err = verifyMessage(buf, alg, key, strictFromOptions(options))
+	return ret, err
+}
+
+// strictFromOptions reports whether WithStrictBase64 was specified
+func strictFromOptions(options []Option) bool {
+	var strict bool
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyStrictBase64:
+			strict = o.Value().(bool)
+		}
+	}
+	return strict
+}
+
+// VerifyWithHeader is the same as Verify, but also returns the protected
+// header of the signature that was successfully verified. The header is
+// only returned after verification succeeds, and unprotected header
+// parameters are never included, so its contents can be trusted.
+//
+// WithStrictBase64 is honored as in Verify.
+func VerifyWithHeader(buf []byte, alg jwa.SignatureAlgorithm, key interface{}, options ...Option) (payload []byte, header Headers, err error) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("jws.VerifyWithHeader").BindError(&err)
+		defer g.End()
+	}
+
+	payload, protected, err := verifyMessage(buf, alg, key, strictFromOptions(options))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var hdr StandardHeaders
+	if len(protected) > 0 {
+		decoded, err := base64.RawURLEncoding.DecodeString(protected)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, `failed to decode protected headers`)
+		}
+		if err := json.Unmarshal(decoded, &hdr); err != nil {
+			return nil, nil, errors.Wrap(err, `failed to parse protected headers`)
+		}
+	}
+	return payload, &hdr, nil
+}
+
+// verifyMessage verifies the message, and returns the decoded payload
+// along with the encoded protected header of the verified signature.
+// If strict is true, every segment must be canonically base64url encoded
+func verifyMessage(buf []byte, alg jwa.SignatureAlgorithm, key interface{}, strict bool) ([]byte, string, error) {
+	if keyconv.IsNil(key) {
+		return nil, "", errors.Wrap(ErrNilKey, `invalid parameter "key"`)
+	}
+
 	verifier, err := verify.New(alg)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create verifier")
+		return nil, "", errors.Wrap(err, "failed to create verifier")
 	}
 
 	buf = bytes.TrimSpace(buf)
 	if len(buf) == 0 {
-		return nil, errors.New(`attempt to verify empty buffer`)
+		return nil, "", errors.New(`attempt to verify empty buffer`)
 	}
 
 	if buf[0] == '{' {
@@ -221,12 +356,12 @@ func Verify(buf []byte, alg jwa.SignatureAlgorithm, key interface{}) (ret []byte
 
 		var v FullEncodedMessage
 		if err := json.Unmarshal(buf, &v); err != nil {
-			return nil, errors.Wrap(err, `failed to unmarshal JWS message`)
+			return nil, "", errors.Wrap(err, `failed to unmarshal JWS message`)
 		}
 
 		// There's something wrong if the Message part is not initialized
 		if v.EncodedMessage == nil {
-			return nil, errors.Wrap(err, `invalid JWS message format`)
+			return nil, "", errors.Wrap(err, `invalid JWS message format`)
 		}
 
 		// if we're using the flattened serialization format, then m.Signature
@@ -236,8 +371,24 @@ func Verify(buf []byte, alg jwa.SignatureAlgorithm, key interface{}) (ret []byte
 			msg.Signatures[0] = v.EncodedSignature
 		}
 
+		for _, sig := range msg.Signatures {
+			if err := checkAlgorithmHeader(sig.Protected, sig.Headers); err != nil {
+				return nil, "", err
+			}
+		}
+
 		var buf bytes.Buffer
 		for _, sig := range msg.Signatures {
+			if strict {
+				encoded, err := isPayloadEncodedProtected(sig.Protected)
+				if err != nil {
+					return nil, "", err
+				}
+				if err := checkCanonicalSegments(sig.Protected, msg.Payload, sig.Signature, encoded); err != nil {
+					return nil, "", err
+				}
+			}
+
 			buf.Reset()
 			buf.WriteString(sig.Protected)
 			buf.WriteByte('.')
@@ -252,21 +403,41 @@ func Verify(buf []byte, alg jwa.SignatureAlgorithm, key interface{}) (ret []byte
 				continue
 			}
 
+			encoded, err := isPayloadEncodedProtected(sig.Protected)
+			if err != nil {
+				return nil, "", err
+			}
+
 			if err := verifier.Verify(buf.Bytes(), decodedSignature, key); err == nil {
 				// verified!
-				decodedPayload, err := base64.RawURLEncoding.DecodeString(msg.Payload)
+				decodedPayload, err := decodePayload(msg.Payload, encoded)
 				if err != nil {
-					return nil, errors.Wrap(err, `message verified, failed to decode payload`)
+					return nil, "", errors.Wrap(err, `message verified, failed to decode payload`)
 				}
-				return decodedPayload, nil
+				return decodedPayload, sig.Protected, nil
 			}
 		}
-		return nil, errors.New(`could not verify with any of the signatures`)
+		return nil, "", errors.New(`could not verify with any of the signatures`)
 	}
 
 	protected, payload, signature, err := SplitCompact(bytes.NewReader(buf))
 	if err != nil {
-		return nil, errors.Wrap(err, `failed extract from compact serialization format`)
+		return nil, "", errors.Wrap(err, `failed extract from compact serialization format`)
+	}
+
+	if err := checkAlgorithmHeader(string(protected), nil); err != nil {
+		return nil, "", err
+	}
+
+	encoded, err := isPayloadEncodedProtected(string(protected))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if strict {
+		if err := checkCanonicalSegments(string(protected), string(payload), string(signature), encoded); err != nil {
+			return nil, "", err
+		}
 	}
 
 	if pdebug.Enabled {
@@ -281,44 +452,217 @@ func Verify(buf []byte, alg jwa.SignatureAlgorithm, key interface{}) (ret []byte
 	verifyBuf.Write(payload)
 
 	decodedSignature := make([]byte, base64.RawURLEncoding.DecodedLen(len(signature)))
-	if _, err := base64.RawURLEncoding.Decode(decodedSignature, signature); err != nil {
-		return nil, errors.Wrap(err, `failed to decode signature`)
+	n, err := base64.RawURLEncoding.Decode(decodedSignature, signature)
+	if err != nil {
+		return nil, "", errors.Wrap(err, `failed to decode signature`)
 	}
+	decodedSignature = decodedSignature[:n]
 	if err := verifier.Verify(verifyBuf.Bytes(), decodedSignature, key); err != nil {
-		return nil, errors.Wrap(err, `failed to verify message`)
+		return nil, "", errors.Wrap(err, `failed to verify message`)
+	}
+
+	decodedPayload, err := decodePayload(string(payload), encoded)
+	if err != nil {
+		return nil, "", errors.Wrap(err, `message verified, failed to decode payload`)
+	}
+	return decodedPayload, string(protected), nil
+}
+
+// checkCanonicalSegments checks that the protected header, payload (if
+// it is base64url encoded), and signature are canonically encoded
+func checkCanonicalSegments(protected, payload, signature string, encoded bool) error {
+	segments := []string{protected, signature}
+	if encoded {
+		segments = append(segments, payload)
+	}
+	for _, segment := range segments {
+		if err := jwxbase64.CheckCanonical([]byte(segment)); err != nil {
+			return errors.Wrap(err, `invalid segment`)
+		}
+	}
+	return nil
+}
+
+// VerifyDetached checks if the given JWS message, whose payload has been
+// detached (https://tools.ietf.org/html/rfc7515#appendix-F), is verifiable
+// using `alg` and `key` against the externally supplied `payload`.
+//
+// In compact serialization the payload segment must be empty, and in
+// JSON serialization the "payload" member must be omitted. Otherwise it
+// is unclear which payload should be verified, and ErrAmbiguousPayload
+// is returned.
+//
+// If WithStrictBase64 is specified, the protected header and signature
+// must be canonically base64url encoded.
+func VerifyDetached(buf []byte, payload []byte, alg jwa.SignatureAlgorithm, key interface{}, options ...Option) (err error) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("jws.VerifyDetached").BindError(&err)
+		defer g.End()
+	}
+
+	if keyconv.IsNil(key) {
+		return errors.Wrap(ErrNilKey, `invalid parameter "key"`)
+	}
+
+	verifier, err := verify.New(alg)
+	if err != nil {
+		return errors.Wrap(err, "failed to create verifier")
+	}
+
+	buf = bytes.TrimSpace(buf)
+	if len(buf) == 0 {
+		return errors.New(`attempt to verify empty buffer`)
+	}
+
+	strict := strictFromOptions(options)
+
+	// The payload is encoded according to the "b64" header parameter
+	// of each signature
+	encodePayload := func(protected string) (string, error) {
+		encoded, err := isPayloadEncodedProtected(protected)
+		if err != nil {
+			return "", err
+		}
+		if !encoded {
+			return string(payload), nil
+		}
+		return base64.RawURLEncoding.EncodeToString(payload), nil
+	}
+
+	if buf[0] == '{' {
+		// Payload is a pointer so that we can tell if it was omitted
+		var v struct {
+			*EncodedSignatureUnmarshalProxy
+			Payload    *string                           `json:"payload"`
+			Signatures []*EncodedSignatureUnmarshalProxy `json:"signatures,omitempty"`
+		}
+		if err := json.Unmarshal(buf, &v); err != nil {
+			return errors.Wrap(err, `failed to unmarshal JWS message`)
+		}
+
+		if v.Payload != nil {
+			return ErrAmbiguousPayload
+		}
+
+		if v.EncodedSignatureUnmarshalProxy != nil {
+			if len(v.Signatures) != 0 {
+				return errors.New("invalid message: mixed flattened/full json serialization")
+			}
+			v.Signatures = append(v.Signatures, v.EncodedSignatureUnmarshalProxy)
+		}
+
+		for _, sig := range v.Signatures {
+			var public Headers
+			if sig.Headers != nil {
+				public = sig.Headers
+			}
+			if err := checkAlgorithmHeader(sig.Protected, public); err != nil {
+				return err
+			}
+		}
+
+		for _, sig := range v.Signatures {
+			if strict {
+				if err := checkCanonicalSegments(sig.Protected, "", sig.Signature, false); err != nil {
+					return err
+				}
+			}
+
+			decodedSignature, err := base64.RawURLEncoding.DecodeString(sig.Signature)
+			if err != nil {
+				continue
+			}
+
+			encodedPayload, err := encodePayload(sig.Protected)
+			if err != nil {
+				return err
+			}
+
+			if err := verifier.Verify([]byte(sig.Protected+"."+encodedPayload), decodedSignature, key); err == nil {
+				return nil
+			}
+		}
+		return errors.New(`could not verify with any of the signatures`)
+	}
+
+	protected, detached, signature, err := SplitCompact(bytes.NewReader(buf))
+	if err != nil {
+		return errors.Wrap(err, `failed extract from compact serialization format`)
+	}
+
+	if len(detached) > 0 {
+		return ErrAmbiguousPayload
+	}
+
+	if err := checkAlgorithmHeader(string(protected), nil); err != nil {
+		return err
 	}
 
-	decodedPayload := make([]byte, base64.RawURLEncoding.DecodedLen(len(payload)))
-	if _, err := base64.RawURLEncoding.Decode(decodedPayload, payload); err != nil {
-		return nil, errors.Wrap(err, `message verified, failed to decode payload`)
+	if strict {
+		if err := checkCanonicalSegments(string(protected), "", string(signature), false); err != nil {
+			return err
+		}
+	}
+
+	encodedPayload, err := encodePayload(string(protected))
+	if err != nil {
+		return err
 	}
-	return decodedPayload, nil
+
+	var verifyBuf bytes.Buffer
+	verifyBuf.Write(protected)
+	verifyBuf.WriteByte('.')
+	verifyBuf.WriteString(encodedPayload)
+
+	decodedSignature, err := base64.RawURLEncoding.DecodeString(string(signature))
+	if err != nil {
+		return errors.Wrap(err, `failed to decode signature`)
+	}
+	if err := verifier.Verify(verifyBuf.Bytes(), decodedSignature, key); err != nil {
+		return errors.Wrap(err, `failed to verify message`)
+	}
+	return nil
 }
 
 // VerifyWithJKU verifies the JWS message using a remote JWK
-// file represented in the url.
-func VerifyWithJKU(buf []byte, jwkurl string) ([]byte, error) {
-	key, err := jwk.FetchHTTP(jwkurl)
+// file represented in the url. The JWK file is fetched using the
+// client specified by WithHTTPClient. WithStrictBase64 is honored as
+// in Verify.
+func VerifyWithJKU(buf []byte, jwkurl string, options ...Option) ([]byte, error) {
+	var fetchOptions []jwk.Option
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyHTTPClient:
+			fetchOptions = append(fetchOptions, jwk.WithHTTPClient(option.Value().(*http.Client)))
+		}
+	}
+
+	key, err := jwk.FetchHTTP(jwkurl, fetchOptions...)
 	if err != nil {
 		return nil, errors.Wrap(err, `failed to fetch jwk via HTTP`)
 	}
 
-	return VerifyWithJWKSet(buf, key, nil)
+	return VerifyWithJWKSet(buf, key, nil, options...)
 }
 
-// VerifyWithJWK verifies the JWS message using the specified JWK
-func VerifyWithJWK(buf []byte, key jwk.Key) (payload []byte, err error) {
+// VerifyWithJWK verifies the JWS message using the specified JWK.
+// WithStrictBase64 is honored as in Verify.
+func VerifyWithJWK(buf []byte, key jwk.Key, options ...Option) (payload []byte, err error) {
 	if pdebug.Enabled {
 		g := pdebug.Marker("jws.VerifyWithJWK").BindError(&err)
 		defer g.End()
 	}
 
+	if keyconv.IsNil(key) {
+		return nil, errors.Wrap(ErrNilKey, `invalid parameter "key"`)
+	}
+
 	keyval, err := key.Materialize()
 	if err != nil {
 		return nil, errors.Wrap(err, `failed to materialize jwk.Key`)
 	}
 
-	payload, err = Verify(buf, jwa.SignatureAlgorithm(key.Algorithm()), keyval)
+	payload, err = Verify(buf, jwa.SignatureAlgorithm(key.Algorithm()), keyval, options...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to verify message")
 	}
@@ -329,22 +673,59 @@ func VerifyWithJWK(buf []byte, key jwk.Key) (payload []byte, err error) {
 // By default it will only pick up keys that have the "use" key
 // set to either "sig" or "enc", but you can override it by
 // providing a keyaccept function.
-func VerifyWithJWKSet(buf []byte, keyset *jwk.Set, keyaccept JWKAcceptFunc) (payload []byte, err error) {
+//
+// Regardless of keyaccept, keys whose "key_ops" do not include
+// "verify" are skipped.
+//
+// Specify WithVerificationCache to remember successful verifications.
+// WithStrictBase64 is honored as in Verify.
+func VerifyWithJWKSet(buf []byte, keyset *jwk.Set, keyaccept JWKAcceptFunc, options ...Option) (payload []byte, err error) {
 	if pdebug.Enabled {
 		g := pdebug.Marker("jws.VerifyWithJWKSet").BindError(&err)
 		defer g.End()
 	}
+	if keyset == nil {
+		return nil, errors.Wrap(ErrNilKey, `invalid parameter "keyset"`)
+	}
 	if keyaccept == nil {
 		keyaccept = DefaultJWKAcceptor
 	}
 
+	var vc *verificationCache
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyVerifyCache:
+			vc = option.Value().(*verificationCache)
+		}
+	}
+
+	var keys []jwk.Key
 	for _, key := range keyset.Keys {
-		if !keyaccept(key) {
+		if !key.KeyOps().Permits(jwk.KeyOpVerify) {
 			continue
 		}
+		if keyaccept(key) {
+			keys = append(keys, key)
+		}
+	}
 
-		payload, err := VerifyWithJWK(buf, key)
+	var cacheKey string
+	if vc != nil {
+		cacheKey, err = verificationCacheKey(buf, keys, strictFromOptions(options))
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to compute verification cache key`)
+		}
+		if payload, ok := vc.cache.Get(cacheKey); ok {
+			return payload, nil
+		}
+	}
+
+	for _, key := range keys {
+		payload, err := VerifyWithJWK(buf, key, options...)
 		if err == nil {
+			if vc != nil {
+				vc.cache.Set(cacheKey, payload, vc.ttl)
+			}
 			return payload, nil
 		}
 	}
@@ -354,7 +735,10 @@ func VerifyWithJWKSet(buf []byte, keyset *jwk.Set, keyaccept JWKAcceptFunc) (pay
 
 // Parse parses contents from the given source and creates a jws.Message
 // struct. The input can be in either compact or full JSON serialization.
-func Parse(src io.Reader) (m *Message, err error) {
+//
+// If WithStrictBase64 is specified, messages whose segments are not
+// canonically base64url encoded are rejected with ErrNonCanonicalBase64.
+func Parse(src io.Reader, options ...Option) (m *Message, err error) {
 	if pdebug.Enabled {
 		g := pdebug.Marker("jws.Parse").BindError(&err)
 		defer g.End()
@@ -374,14 +758,14 @@ func Parse(src io.Reader) (m *Message, err error) {
 		}
 	}
 
-	var parser func(io.Reader) (*Message, error)
+	var parser func(io.Reader, bool) (*Message, error)
 	if first == '{' {
 		parser = parseJSON
 	} else {
 		parser = parseCompact
 	}
 
-	m, err = parser(rdr)
+	m, err = parser(rdr, strictFromOptions(options))
 	if err != nil {
 		return nil, errors.Wrap(err, `failed to parse jws message`)
 	}
@@ -390,11 +774,23 @@ func Parse(src io.Reader) (m *Message, err error) {
 }
 
 // ParseString is the same as Parse, but take in a string
-func ParseString(s string) (*Message, error) {
-	return Parse(strings.NewReader(s))
+func ParseString(s string, options ...Option) (*Message, error) {
+	return Parse(strings.NewReader(s), options...)
+}
+
+// ParseEnvelope parses a message that is embedded as a string in the
+// named field of a JSON object, such as {"token":"eyJ..."}. This is a
+// convenience for application level wrappers, and is unrelated to the
+// JSON serialization of JWS, which Parse handles.
+func ParseEnvelope(data []byte, field string, options ...Option) (*Message, error) {
+	s, err := envelope.Field(data, field)
+	if err != nil {
+		return nil, err
+	}
+	return ParseString(s, options...)
 }
 
-func parseJSON(src io.Reader) (result *Message, err error) {
+func parseJSON(src io.Reader, strict bool) (result *Message, err error) {
 	if pdebug.Enabled {
 		g := pdebug.Marker("jws.Parse (json)").BindError(&err)
 		defer g.End()
@@ -418,6 +814,12 @@ func parseJSON(src io.Reader) (result *Message, err error) {
 		return nil, errors.Wrap(err, `failed to unmarshal jws message`)
 	}
 
+	// A flattened message with a detached payload contains neither
+	// "payload" nor "signatures"
+	if wrapper.EncodedMessageUnmarshalProxy == nil {
+		wrapper.EncodedMessageUnmarshalProxy = &EncodedMessageUnmarshalProxy{}
+	}
+
 	// if the "signature" field exist, treat it as a flattened
 	if wrapper.EncodedSignatureUnmarshalProxy != nil {
 		if len(wrapper.Signatures) != 0 {
@@ -428,24 +830,43 @@ func parseJSON(src io.Reader) (result *Message, err error) {
 	}
 
 	var plain Message
-	plain.payload, err = base64.RawURLEncoding.DecodeString(wrapper.Payload)
-	if err != nil {
-		return nil, errors.Wrap(err, `failed to decode payload`)
-	}
-
+	encodedPayload := true
 	for i, sig := range wrapper.Signatures {
 		var plainSig Signature
 
-		plainSig.headers = sig.Headers
+		if sig.Headers != nil {
+			plainSig.headers = sig.Headers
+		}
 
 		if l := len(sig.Protected); l > 0 {
 			hdrbuf, err := base64.RawURLEncoding.DecodeString(sig.Protected)
 			if err != nil {
 				return nil, errors.Wrapf(err, `failed to base64 decode protected header for signature #%d`, i+1)
 			}
-			if err := json.Unmarshal(hdrbuf, &plainSig.headers); err != nil {
+			var protected StandardHeaders
+			if err := json.Unmarshal(hdrbuf, &protected); err != nil {
 				return nil, errors.Wrapf(err, `failed to unmarshal protected header for signature #%d`, i+1)
 			}
+			plainSig.protected = &protected
+		}
+
+		if !hasAlgorithm(plainSig.protected, plainSig.headers) {
+			return nil, errors.Wrapf(ErrMissingAlgorithm, `signature #%d`, i+1)
+		}
+
+		encoded, err := isPayloadEncoded(plainSig.protected)
+		if err != nil {
+			return nil, errors.Wrapf(err, `signature #%d`, i+1)
+		}
+		if i > 0 && encoded != encodedPayload {
+			return nil, errors.Errorf(`inconsistent %s header in signature #%d`, B64Key, i+1)
+		}
+		encodedPayload = encoded
+
+		if strict {
+			if err := checkCanonicalSegments(sig.Protected, wrapper.Payload, sig.Signature, encoded); err != nil {
+				return nil, errors.Wrapf(err, `signature #%d`, i+1)
+			}
 		}
 
 		plainSig.signature, err = base64.RawURLEncoding.DecodeString(sig.Signature)
@@ -456,9 +877,29 @@ func parseJSON(src io.Reader) (result *Message, err error) {
 		plain.signatures = append(plain.signatures, &plainSig)
 	}
 
+	plain.payload, err = decodePayload(wrapper.Payload, encodedPayload)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to decode payload`)
+	}
+
 	return &plain, nil
 }
 
+// DecodeSegments splits a JWS message in compact serialization into its
+// header, payload, and signature segments, and returns each of them
+// base64url decoded, in that order. The segments are not interpreted in
+// any way, and the signature is NOT verified.
+//
+// Payloads using the unencoded ("b64":false) option can not be decoded
+// by this function.
+func DecodeSegments(compact []byte) ([][]byte, error) {
+	segments, err := jwxbase64.DecodeSegments(bytes.TrimSpace(compact), 3)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to decode compact serialization`)
+	}
+	return segments, nil
+}
+
 // splitCompact
 func SplitCompact(rdr io.Reader) ([]byte, []byte, []byte, error) {
 	var protected []byte
@@ -517,15 +958,24 @@ func SplitCompact(rdr io.Reader) ([]byte, []byte, []byte, error) {
 			}
 		}
 	}
+	if periods > 2 {
+		return nil, nil, nil, ErrTrailingData
+	}
 	if periods != 2 {
 		return nil, nil, nil, errors.New(`invalid number of segments`)
 	}
 
+	// Trailing whitespace is tolerated, but anything after it is not
+	signature = bytes.TrimRightFunc(signature, unicode.IsSpace)
+	if bytes.IndexFunc(signature, unicode.IsSpace) >= 0 {
+		return nil, nil, nil, ErrTrailingData
+	}
+
 	return protected, payload, signature, nil
 }
 
 // parseCompact parses a JWS value serialized via compact serialization.
-func parseCompact(rdr io.Reader) (m *Message, err error) {
+func parseCompact(rdr io.Reader, strict bool) (m *Message, err error) {
 	if pdebug.Enabled {
 		g := pdebug.Marker("jws.Parse (compact)").BindError(&err)
 		defer g.End()
@@ -544,9 +994,23 @@ func parseCompact(rdr io.Reader) (m *Message, err error) {
 	if err := json.Unmarshal(decodedHeader, &hdr); err != nil {
 		return nil, errors.Wrap(err, `failed to parse JOSE headers`)
 	}
+	if !hasAlgorithm(&hdr) {
+		return nil, ErrMissingAlgorithm
+	}
 
-	decodedPayload := make([]byte, base64.RawURLEncoding.DecodedLen(len(payload)))
-	if _, err = base64.RawURLEncoding.Decode(decodedPayload, payload); err != nil {
+	encoded, err := isPayloadEncoded(&hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	if strict {
+		if err := checkCanonicalSegments(string(protected), string(payload), string(signature), encoded); err != nil {
+			return nil, err
+		}
+	}
+
+	decodedPayload, err := decodePayload(string(payload), encoded)
+	if err != nil {
 		return nil, errors.Wrap(err, `failed to decode payload`)
 	}
 
@@ -563,3 +1027,36 @@ func parseCompact(rdr io.Reader) (m *Message, err error) {
 	})
 	return &msg, nil
 }
+
+// hasAlgorithm reports whether "alg" is specified in any of the headers
+func hasAlgorithm(headers ...Headers) bool {
+	for _, h := range headers {
+		if h == nil {
+			continue
+		}
+		if _, ok := h.Get(AlgorithmKey); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAlgorithmHeader decodes the base64 encoded protected header, and
+// checks that "alg" is present in either it or the public header
+func checkAlgorithmHeader(protected string, public Headers) error {
+	var hdr StandardHeaders
+	if len(protected) > 0 {
+		decoded, err := base64.RawURLEncoding.DecodeString(protected)
+		if err != nil {
+			return errors.Wrap(err, `failed to decode protected headers`)
+		}
+		if err := json.Unmarshal(decoded, &hdr); err != nil {
+			return errors.Wrap(err, `failed to parse protected headers`)
+		}
+	}
+
+	if !hasAlgorithm(&hdr, public) {
+		return ErrMissingAlgorithm
+	}
+	return nil
+}
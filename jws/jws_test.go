@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"strings"
 	"testing"
 
@@ -18,6 +20,7 @@ import (
 	"github.com/lestrrat-go/jwx/jws/sign"
 	"github.com/lestrrat-go/jwx/jws/verify"
 	pdebug "github.com/lestrrat-go/pdebug"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -54,6 +57,16 @@ func TestParse(t *testing.T) {
 			return
 		}
 	})
+	t.Run("Compact empty alg", func(t *testing.T) {
+		parts := strings.Split(exampleCompactSerialization, ".")
+		parts[0] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":""}`))
+		incoming := strings.Join(parts, ".")
+
+		_, err := jws.ParseString(incoming)
+		if !assert.Equal(t, jwa.ErrEmptyAlgorithm, errors.Cause(err), "Parsing compact serialization with empty alg should fail with jwa.ErrEmptyAlgorithm") {
+			return
+		}
+	})
 	t.Run("Compact bad payload", func(t *testing.T) {
 		parts := strings.Split(exampleCompactSerialization, ".")
 		parts[1] = "%badvalue%"
@@ -165,6 +178,18 @@ func TestVerifyWithJWKSet(t *testing.T) {
 	if !assert.Equal(t, payload, verified, "Verified payload is the same") {
 		return
 	}
+
+	t.Run("key_ops", func(t *testing.T) {
+		jwkkey.Set(jwk.KeyOpsKey, []string{string(jwk.KeyOpSign)})
+		_, err := jws.VerifyWithJWKSet(buf, &jwk.Set{Keys: []jwk.Key{jwkkey}}, nil)
+		if !assert.Error(t, err, "key with key_ops [sign] should be skipped") {
+			return
+		}
+
+		jwkkey.Set(jwk.KeyOpsKey, []string{string(jwk.KeyOpSign), jwk.KeyOpVerify})
+		_, err = jws.VerifyWithJWKSet(buf, &jwk.Set{Keys: []jwk.Key{jwkkey}}, nil)
+		assert.NoError(t, err, "key with key_ops [sign, verify] should be used")
+	})
 }
 
 func TestRoundtrip_RSACompact(t *testing.T) {
@@ -660,3 +685,423 @@ func TestDecode_ES384Compact_NoSigTrim(t *testing.T) {
 		return
 	}
 }
+
+func TestVerifyDetached(t *testing.T) {
+	payload := []byte(examplePayload)
+	sharedkey := []byte("secret")
+
+	signed, err := jws.Sign(payload, jwa.HS256, sharedkey)
+	if !assert.NoError(t, err, "Sign should succeed") {
+		return
+	}
+
+	protected, _, signature, err := jws.SplitCompact(bytes.NewReader(signed))
+	if !assert.NoError(t, err, "SplitCompact should succeed") {
+		return
+	}
+
+	t.Run("Compact", func(t *testing.T) {
+		detached := string(protected) + ".." + string(signature)
+		if !assert.NoError(t, jws.VerifyDetached([]byte(detached), payload, jwa.HS256, sharedkey), "VerifyDetached should succeed") {
+			return
+		}
+		if !assert.Error(t, jws.VerifyDetached([]byte(detached), []byte("foo"), jwa.HS256, sharedkey), "VerifyDetached should fail with the wrong payload") {
+			return
+		}
+		if !assert.Equal(t, jws.ErrAmbiguousPayload, jws.VerifyDetached(signed, payload, jwa.HS256, sharedkey), "VerifyDetached should fail with an attached payload") {
+			return
+		}
+	})
+	t.Run("JSON", func(t *testing.T) {
+		detached := `{"protected":"` + string(protected) + `","signature":"` + string(signature) + `"}`
+		if !assert.NoError(t, jws.VerifyDetached([]byte(detached), payload, jwa.HS256, sharedkey), "VerifyDetached should succeed") {
+			return
+		}
+
+		m, err := jws.ParseString(detached)
+		if !assert.NoError(t, err, "Parse should accept a message without a payload") {
+			return
+		}
+		if !assert.Empty(t, m.Payload(), "Payload should be empty") {
+			return
+		}
+
+		full := `{"payload":"` + base64.RawURLEncoding.EncodeToString(payload) + `","signatures":[{"protected":"` + string(protected) + `","signature":"` + string(signature) + `"}]}`
+		if !assert.Equal(t, jws.ErrAmbiguousPayload, jws.VerifyDetached([]byte(full), payload, jwa.HS256, sharedkey), "VerifyDetached should fail with an attached payload") {
+			return
+		}
+	})
+}
+
+func TestMissingAlgorithm(t *testing.T) {
+	key := []byte("secret")
+	protected := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(examplePayload))
+
+	signer, err := sign.New(jwa.HS256)
+	if !assert.NoError(t, err, "sign.New should succeed") {
+		return
+	}
+	signature, err := signer.Sign([]byte(protected+"."+payload), key)
+	if !assert.NoError(t, err, "Sign should succeed") {
+		return
+	}
+	encodedSignature := base64.RawURLEncoding.EncodeToString(signature)
+
+	t.Run("Compact", func(t *testing.T) {
+		compact := protected + "." + payload + "." + encodedSignature
+
+		_, err := jws.ParseString(compact)
+		if !assert.Equal(t, jws.ErrMissingAlgorithm, errors.Cause(err), "Parse should fail with ErrMissingAlgorithm") {
+			return
+		}
+
+		_, err = jws.Verify([]byte(compact), jwa.HS256, key)
+		if !assert.Equal(t, jws.ErrMissingAlgorithm, errors.Cause(err), "Verify should fail with ErrMissingAlgorithm") {
+			return
+		}
+	})
+	t.Run("JSON", func(t *testing.T) {
+		flattened := `{"protected":"` + protected + `","payload":"` + payload + `","signature":"` + encodedSignature + `"}`
+
+		_, err := jws.ParseString(flattened)
+		if !assert.Equal(t, jws.ErrMissingAlgorithm, errors.Cause(err), "Parse should fail with ErrMissingAlgorithm") {
+			return
+		}
+	})
+}
+
+func TestHMACKeyFromPassphrase(t *testing.T) {
+	payload := []byte(examplePayload)
+	salt := []byte("NaCl")
+
+	for _, alg := range []jwa.SignatureAlgorithm{jwa.HS256, jwa.HS384, jwa.HS512} {
+		key, err := jws.HMACKeyFromPassphrase([]byte("correct horse battery staple"), salt, 1000, 64)
+		if !assert.NoError(t, err, "HMACKeyFromPassphrase should succeed") {
+			return
+		}
+		if !assert.Len(t, key, 64, "derived key should be 64 bytes") {
+			return
+		}
+
+		signed, err := jws.Sign(payload, alg, key)
+		if !assert.NoError(t, err, "Sign should succeed") {
+			return
+		}
+
+		verifyKey, err := jws.HMACKeyFromPassphrase([]byte("correct horse battery staple"), salt, 1000, 64)
+		if !assert.NoError(t, err, "HMACKeyFromPassphrase should succeed") {
+			return
+		}
+		verified, err := jws.Verify(signed, alg, verifyKey)
+		if !assert.NoError(t, err, "Verify should succeed") {
+			return
+		}
+		if !assert.Equal(t, payload, verified, "verified payload matches") {
+			return
+		}
+
+		wrongKey, err := jws.HMACKeyFromPassphrase([]byte("Tr0ub4dor&3"), salt, 1000, 64)
+		if !assert.NoError(t, err, "HMACKeyFromPassphrase should succeed") {
+			return
+		}
+		if _, err := jws.Verify(signed, alg, wrongKey); !assert.Error(t, err, "Verify with a different passphrase should fail") {
+			return
+		}
+	}
+
+	for _, length := range []int{0, -1} {
+		_, err := jws.HMACKeyFromPassphrase([]byte("correct horse battery staple"), salt, 1000, length)
+		if !assert.Error(t, err, "HMACKeyFromPassphrase should fail for non-positive lengths") {
+			return
+		}
+	}
+	_, err := jws.HMACKeyFromPassphrase([]byte("correct horse battery staple"), salt, 0, 64)
+	assert.Error(t, err, "HMACKeyFromPassphrase should fail for non-positive iteration counts")
+}
+
+func TestVerifyWithHeader(t *testing.T) {
+	key := []byte(`secret`)
+
+	var hdr jws.StandardHeaders
+	hdr.Set(jws.KeyIDKey, `my-key`)
+	signed, err := jws.Sign([]byte(`Lorem ipsum`), jwa.HS256, key, jws.WithHeaders(&hdr))
+	if !assert.NoError(t, err, `jws.Sign should succeed`) {
+		return
+	}
+
+	payload, h, err := jws.VerifyWithHeader(signed, jwa.HS256, key)
+	if !assert.NoError(t, err, `jws.VerifyWithHeader should succeed`) {
+		return
+	}
+	assert.Equal(t, []byte(`Lorem ipsum`), payload, `payload should match`)
+	assert.Equal(t, `my-key`, h.KeyID(), `kid should match`)
+	assert.Equal(t, jwa.HS256, h.Algorithm(), `alg should match`)
+
+	payload, h, err = jws.VerifyWithHeader(signed, jwa.HS256, []byte(`wrong`))
+	assert.Error(t, err, `jws.VerifyWithHeader should fail`)
+	assert.Nil(t, payload, `payload should be nil`)
+	assert.Nil(t, h, `header should be nil`)
+}
+
+func TestTrailingData(t *testing.T) {
+	inputs := map[string]string{
+		"Trailing dot":                      exampleCompactSerialization + ".",
+		"Concatenated tokens":               exampleCompactSerialization + exampleCompactSerialization,
+		"Concatenated tokens with space":    exampleCompactSerialization + " " + exampleCompactSerialization,
+		"Trailing garbage after whitespace": exampleCompactSerialization + "\n garbage",
+	}
+	for name, input := range inputs {
+		input := input
+		t.Run(name, func(t *testing.T) {
+			_, err := jws.ParseString(input)
+			if !assert.Equal(t, jws.ErrTrailingData, errors.Cause(err), "Parse should fail with ErrTrailingData") {
+				return
+			}
+			_, err = jws.Verify([]byte(input), jwa.HS256, []byte("secret"))
+			assert.Equal(t, jws.ErrTrailingData, errors.Cause(err), "Verify should fail with ErrTrailingData")
+		})
+	}
+
+	_, err := jws.ParseString(exampleCompactSerialization + "\n")
+	assert.NoError(t, err, "trailing whitespace should be allowed")
+}
+
+func TestUnencodedPayload(t *testing.T) {
+	key := []byte(`secret`)
+	payload := []byte(`$.02`)
+
+	t.Run("Compact", func(t *testing.T) {
+		var hdr jws.StandardHeaders
+		hdr.Set(jws.B64Key, false)
+		signed, err := jws.Sign([]byte(`$02`), jwa.HS256, key, jws.WithHeaders(&hdr))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		parts := strings.Split(string(signed), ".")
+		if !assert.Len(t, parts, 3, `should have 3 segments`) {
+			return
+		}
+		assert.Equal(t, `$02`, parts[1], `payload should be unencoded`)
+
+		verified, err := jws.Verify(signed, jwa.HS256, key)
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		assert.Equal(t, []byte(`$02`), verified, `payload should match`)
+
+		m, err := jws.Parse(bytes.NewReader(signed))
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		assert.Equal(t, []byte(`$02`), m.Payload(), `payload should match`)
+		assert.Equal(t, []string{jws.B64Key}, m.Signatures()[0].ProtectedHeaders().Critical(), `crit should contain b64`)
+
+		_, err = jws.Sign(payload, jwa.HS256, key, jws.WithHeaders(&hdr))
+		assert.Error(t, err, `jws.Sign should fail for payload containing '.'`)
+	})
+	t.Run("JSON", func(t *testing.T) {
+		signer, err := sign.New(jwa.HS256)
+		if !assert.NoError(t, err, `sign.New should succeed`) {
+			return
+		}
+		var hdr jws.StandardHeaders
+		hdr.Set(jws.B64Key, false)
+		signed, err := jws.SignMulti(payload, jws.WithSigner(signer, key, nil, &hdr))
+		if !assert.NoError(t, err, `jws.SignMulti should succeed`) {
+			return
+		}
+
+		var raw map[string]interface{}
+		if !assert.NoError(t, json.Unmarshal(signed, &raw), `json.Unmarshal should succeed`) {
+			return
+		}
+		assert.Equal(t, string(payload), raw["payload"], `payload should be unencoded`)
+
+		verified, err := jws.Verify(signed, jwa.HS256, key)
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		assert.Equal(t, payload, verified, `payload should match`)
+
+		m, err := jws.Parse(bytes.NewReader(signed))
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		assert.Equal(t, payload, m.Payload(), `payload should match`)
+	})
+	t.Run("Missing crit", func(t *testing.T) {
+		input := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","b64":false}`)) + `.$02.AAAA`
+		_, err := jws.ParseString(input)
+		assert.Error(t, err, `jws.Parse should fail when b64 is not listed in crit`)
+	})
+}
+
+func TestNilKey(t *testing.T) {
+	var rsakey *rsa.PrivateKey
+	for _, key := range []interface{}{nil, rsakey, []byte(nil)} {
+		_, err := jws.Sign([]byte("Lorem ipsum"), jwa.RS256, key)
+		if !assert.Equal(t, jws.ErrNilKey, errors.Cause(err), "Sign should fail with ErrNilKey") {
+			return
+		}
+		_, err = jws.Verify([]byte(exampleCompactSerialization), jwa.HS256, key)
+		if !assert.Equal(t, jws.ErrNilKey, errors.Cause(err), "Verify should fail with ErrNilKey") {
+			return
+		}
+		err = jws.VerifyDetached([]byte(exampleCompactSerialization), nil, jwa.HS256, key)
+		if !assert.Equal(t, jws.ErrNilKey, errors.Cause(err), "VerifyDetached should fail with ErrNilKey") {
+			return
+		}
+	}
+
+	signer, err := sign.New(jwa.HS256)
+	if !assert.NoError(t, err, "sign.New should succeed") {
+		return
+	}
+	_, err = jws.SignMulti([]byte("Lorem ipsum"), jws.WithSigner(signer, nil, nil, nil))
+	assert.Equal(t, jws.ErrNilKey, errors.Cause(err), "SignMulti should fail with ErrNilKey")
+
+	_, err = jws.VerifyWithJWK([]byte(exampleCompactSerialization), nil)
+	assert.Equal(t, jws.ErrNilKey, errors.Cause(err), "VerifyWithJWK should fail with ErrNilKey")
+
+	_, err = jws.VerifyWithJWKSet([]byte(exampleCompactSerialization), nil, nil)
+	assert.Equal(t, jws.ErrNilKey, errors.Cause(err), "VerifyWithJWKSet should fail with ErrNilKey")
+}
+
+func TestVerifyPEM(t *testing.T) {
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, "RSA key generated") {
+		return
+	}
+	pubkey, err := x509.MarshalPKIXPublicKey(&rsakey.PublicKey)
+	if !assert.NoError(t, err, "x509.MarshalPKIXPublicKey should succeed") {
+		return
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubkey})
+
+	signed, err := jws.Sign([]byte("Lorem ipsum"), jwa.RS256, rsakey)
+	if !assert.NoError(t, err, "jws.Sign should succeed") {
+		return
+	}
+
+	payload, err := jws.VerifyPEM(signed, jwa.RS256, pemKey)
+	if !assert.NoError(t, err, "jws.VerifyPEM should succeed") {
+		return
+	}
+	assert.Equal(t, []byte("Lorem ipsum"), payload, "payload should match")
+
+	// The public half of private keys is used
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsakey)})
+	_, err = jws.VerifyPEM(signed, jwa.RS256, privPEM)
+	assert.NoError(t, err, "jws.VerifyPEM should succeed with a private key")
+
+	_, err = jws.VerifyPEM(signed, jwa.ES256, pemKey)
+	assert.Error(t, err, "jws.VerifyPEM should fail for mismatching key type")
+}
+
+func TestDecodeSegments(t *testing.T) {
+	key := []byte("secret")
+	payload := []byte("trailing zeros\x00\x00")
+	signed, err := jws.Sign(payload, jwa.HS256, key)
+	if !assert.NoError(t, err, "jws.Sign should succeed") {
+		return
+	}
+
+	segments, err := jws.DecodeSegments(signed)
+	if !assert.NoError(t, err, "DecodeSegments should succeed") {
+		return
+	}
+	if !assert.Len(t, segments, 3, "there should be 3 segments") {
+		return
+	}
+	assert.Equal(t, []byte(`{"alg":"HS256"}`), segments[0], "header should match")
+	assert.Equal(t, payload, segments[1], "payload should match, including trailing zeros")
+	assert.Len(t, segments[2], 32, "HS256 signature should be 32 bytes")
+
+	segments, err = jws.DecodeSegments([]byte("eyJhbGciOiJIUzI1NiJ9..c2ln"))
+	if assert.NoError(t, err, "DecodeSegments should succeed for detached payloads") {
+		assert.Empty(t, segments[1], "payload should be empty")
+		assert.Equal(t, []byte("sig"), segments[2], "signature should match")
+	}
+
+	_, err = jws.DecodeSegments([]byte("eyJhbGciOiJIUzI1NiJ9.cGF5bG9hZA"))
+	assert.Error(t, err, "DecodeSegments should fail for 2 segments")
+	_, err = jws.DecodeSegments([]byte("eyJhbGciOiJIUzI1NiJ9.cGF5bG9hZA.!!!"))
+	assert.Error(t, err, "DecodeSegments should fail for invalid base64")
+}
+
+func TestVerify_StrictBase64(t *testing.T) {
+	key := []byte("secret")
+	signed, err := jws.Sign([]byte("Lorem ipsum"), jwa.HS256, key)
+	if !assert.NoError(t, err, "jws.Sign should succeed") {
+		return
+	}
+
+	// A 32 byte signature leaves 2 unused bits in the last character.
+	// Setting one of them yields a different encoding of the same bytes
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	last := strings.IndexByte(alphabet, signed[len(signed)-1])
+	tampered := append(append([]byte(nil), signed[:len(signed)-1]...), alphabet[last|1])
+
+	_, err = jws.Verify(signed, jwa.HS256, key, jws.WithStrictBase64())
+	assert.NoError(t, err, "Verify should succeed for canonical encodings")
+
+	_, err = jws.Verify(tampered, jwa.HS256, key)
+	assert.NoError(t, err, "Verify should accept non-canonical encodings by default")
+
+	_, err = jws.Verify(tampered, jwa.HS256, key, jws.WithStrictBase64())
+	assert.Equal(t, jws.ErrNonCanonicalBase64, errors.Cause(err), "Verify should fail with ErrNonCanonicalBase64")
+
+	_, _, err = jws.VerifyWithHeader(tampered, jwa.HS256, key, jws.WithStrictBase64())
+	assert.Equal(t, jws.ErrNonCanonicalBase64, errors.Cause(err), "VerifyWithHeader should fail with ErrNonCanonicalBase64")
+
+	_, err = jws.Parse(bytes.NewReader(tampered))
+	assert.NoError(t, err, "Parse should accept non-canonical encodings by default")
+
+	_, err = jws.Parse(bytes.NewReader(tampered), jws.WithStrictBase64())
+	assert.Equal(t, jws.ErrNonCanonicalBase64, errors.Cause(err), "Parse should fail with ErrNonCanonicalBase64")
+
+	jwkKey, err := jwk.New(key)
+	if !assert.NoError(t, err, "jwk.New should succeed") {
+		return
+	}
+	jwkKey.Set(jwk.AlgorithmKey, jwa.HS256)
+	_, err = jws.VerifyWithJWK(tampered, jwkKey, jws.WithStrictBase64())
+	assert.Equal(t, jws.ErrNonCanonicalBase64, errors.Cause(err), "VerifyWithJWK should fail with ErrNonCanonicalBase64")
+
+	segments := bytes.Split(tampered, []byte{'.'})
+	detached := bytes.Join([][]byte{segments[0], nil, segments[2]}, []byte{'.'})
+	err = jws.VerifyDetached(detached, []byte("Lorem ipsum"), jwa.HS256, key)
+	assert.NoError(t, err, "VerifyDetached should accept non-canonical encodings by default")
+
+	err = jws.VerifyDetached(detached, []byte("Lorem ipsum"), jwa.HS256, key, jws.WithStrictBase64())
+	assert.Equal(t, jws.ErrNonCanonicalBase64, errors.Cause(err), "VerifyDetached should fail with ErrNonCanonicalBase64")
+}
+
+func TestParseEnvelope(t *testing.T) {
+	envelope := []byte(`{"token_type":"Bearer","token":"` + exampleCompactSerialization + `"}`)
+
+	m, err := jws.ParseEnvelope(envelope, "token")
+	if !assert.NoError(t, err, "ParseEnvelope should succeed") {
+		return
+	}
+	expected, err := jws.ParseString(exampleCompactSerialization)
+	if !assert.NoError(t, err, "ParseString should succeed") {
+		return
+	}
+	assert.Equal(t, expected, m, "messages should match")
+
+	for name, input := range map[string]string{
+		"Missing field":  `{"access_token":"` + exampleCompactSerialization + `"}`,
+		"Non-string":     `{"token":{"payload":"eyJ9"}}`,
+		"Not an object":  `["` + exampleCompactSerialization + `"]`,
+		"Invalid token":  `{"token":"Lorem ipsum"}`,
+		"Invalid object": `{"token":`,
+	} {
+		input := input
+		t.Run(name, func(t *testing.T) {
+			_, err := jws.ParseEnvelope([]byte(input), "token")
+			assert.Error(t, err, "ParseEnvelope should fail")
+		})
+	}
+}
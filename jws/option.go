@@ -1,6 +1,11 @@
 package jws
 
 import (
+	"crypto/x509"
+	"net/http"
+	"time"
+
+	"github.com/lestrrat-go/jwx/internal/httpclient"
 	"github.com/lestrrat-go/jwx/internal/option"
 	"github.com/lestrrat-go/jwx/jws/sign"
 )
@@ -11,8 +16,19 @@ const (
 	optkeyPayloadSigner    = `payload-signer`
 	optkeyHeaders          = `headers`
 	optkeyPrettyJSONFormat = `format-json-pretty`
+	optkeyX5UAllowInsecure = `x5u-allow-insecure`
+	optkeyX5UMaxSize       = `x5u-max-size`
+	optkeyVerifyCache      = `verification-cache`
+	optkeyHTTPClient       = `http-client`
+	optkeyStrictBase64     = `strict-base64`
+	optkeyX509ExtKeyUsages = `x509-ext-key-usages`
+	optkeyCacheMaxEntries  = `cache-max-entries`
 )
 
+// DefaultHTTPTimeout is the timeout of the HTTP client used to fetch
+// remote resources, unless a client is specified via WithHTTPClient
+const DefaultHTTPTimeout = httpclient.DefaultTimeout
+
 func WithPretty(b bool) Option {
 	return option.New(optkeyPrettyJSONFormat, b)
 }
@@ -29,3 +45,66 @@ func WithSigner(signer sign.Signer, key interface{}, public, protected Headers)
 func WithHeaders(h Headers) Option {
 	return option.New(optkeyHeaders, h)
 }
+
+// WithHTTPClient specifies the HTTP client used by VerifyWithJKU and
+// VerifyWithX5U to fetch remote resources. If not specified, a client
+// with a timeout of DefaultHTTPTimeout is used.
+func WithHTTPClient(cl *http.Client) Option {
+	return option.New(optkeyHTTPClient, cl)
+}
+
+// WithX5UAllowInsecure specifies if VerifyWithX5U may fetch the
+// certificate chain over plain http
+func WithX5UAllowInsecure(b bool) Option {
+	return option.New(optkeyX5UAllowInsecure, b)
+}
+
+// WithX509ExtKeyUsages specifies the extended key usages for which the
+// certificate chain must be valid in VerifyWithX5C and VerifyWithX5U.
+// If not specified, only leaf certificates without the extended key usage
+// extension are accepted.
+func WithX509ExtKeyUsages(usages ...x509.ExtKeyUsage) Option {
+	return option.New(optkeyX509ExtKeyUsages, usages)
+}
+
+// WithX5UMaxSize specifies the maximum number of bytes that
+// VerifyWithX5U reads when fetching the certificate chain
+func WithX5UMaxSize(n int64) Option {
+	return option.New(optkeyX5UMaxSize, n)
+}
+
+// WithVerificationCache specifies that VerifyWithJWKSet should remember
+// successful verifications in `cache` for the duration of `ttl`. The
+// entries are keyed by a hash of the exact message bytes, of the keys
+// that were eligible for verification (including their "alg", "use" and
+// "key_ops"), and of WithStrictBase64, so a change in the key set or in
+// the options invalidates previous results. Failed verifications are
+// never cached.
+//
+// Using a cache is a trade-off between performance and security: for
+// the duration of `ttl` a cached message is accepted without checking
+// its signature again. Keep `ttl` short, and remember that
+// claims such as expiration times are not part of the JWS layer, and
+// must still be checked by the caller on every use.
+func WithVerificationCache(cache Cache, ttl time.Duration) Option {
+	return option.New(optkeyVerifyCache, &verificationCache{
+		cache: cache,
+		ttl:   ttl,
+	})
+}
+
+// WithCacheMaxEntries specifies the maximum number of entries kept by
+// the cache created by NewMemoryCache
+func WithCacheMaxEntries(n int) Option {
+	return option.New(optkeyCacheMaxEntries, n)
+}
+
+// WithStrictBase64 specifies that Verify, Parse, and the other
+// verification functions of this package must reject messages whose
+// segments are not canonically base64url encoded, that is, whose last
+// character has non-zero unused bits, or that contain line breaks. The
+// standard library accepts such encodings, which allows several encodings
+// of the same signature. By default, they are accepted.
+func WithStrictBase64() Option {
+	return option.New(optkeyStrictBase64, true)
+}
@@ -0,0 +1,35 @@
+package jws
+
+import (
+	"crypto"
+	_ "crypto/sha256" // registers SHA-256 for PBKDF2
+
+	"github.com/lestrrat-go/jwx/internal/pbkdf2"
+	"github.com/pkg/errors"
+)
+
+// HMACKeyFromPassphrase derives a key of `length` bytes from a passphrase,
+// using PBKDF2 with HMAC-SHA256 as described in RFC 8018. The resulting
+// key can be used with the HS256, HS384, and HS512 algorithms. It is
+// recommended that `length` be at least the size of the hash used by the
+// algorithm (32, 48, and 64 bytes respectively). An error is returned
+// if `length` or `iterations` is not positive.
+//
+// The same passphrase, salt, and iteration count must be used when
+// signing and verifying:
+//
+//     key, err := jws.HMACKeyFromPassphrase([]byte("secret"), salt, 100000, 32)
+//     signed, err := jws.Sign(payload, jwa.HS256, key)
+//     ...
+//     verified, err := jws.Verify(signed, jwa.HS256, key)
+//
+// Note that this is not part of the JOSE specifications.
+func HMACKeyFromPassphrase(pass []byte, salt []byte, iterations int, length int) ([]byte, error) {
+	if length <= 0 {
+		return nil, errors.Errorf(`invalid key length %d`, length)
+	}
+	if iterations <= 0 {
+		return nil, errors.Errorf(`invalid iteration count %d`, iterations)
+	}
+	return pbkdf2.Key(crypto.SHA256, pass, salt, iterations, length), nil
+}
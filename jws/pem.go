@@ -0,0 +1,42 @@
+package jws
+
+import (
+	"github.com/lestrrat-go/jwx/internal/keyconv"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/pkg/errors"
+)
+
+// VerifyPEM verifies the JWS message using the key in the PEM encoded
+// `pemKey`. See jwk.ParsePEM for the supported formats. If a private
+// key is given, its public half is used.
+//
+// The key must be usable with `alg`: for example, an ECDSA key can not
+// be used to verify a message signed with RS256.
+func VerifyPEM(buf []byte, alg jwa.SignatureAlgorithm, pemKey []byte) ([]byte, error) {
+	key, err := jwk.ParsePEM(pemKey)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to parse PEM key`)
+	}
+
+	raw, err := key.Materialize()
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to materialize key`)
+	}
+
+	if !supportsSignatureAlgorithm(raw, alg) {
+		return nil, errors.Errorf(`key of type %T can not be used with %s`, raw, alg)
+	}
+
+	return Verify(buf, alg, keyconv.PublicKey(raw))
+}
+
+func supportsSignatureAlgorithm(key interface{}, alg jwa.SignatureAlgorithm) bool {
+	algs, _ := jwk.SupportedAlgorithms(key)
+	for _, v := range algs {
+		if v == alg {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/ecdsa"
 	"crypto/rand"
 
+	"github.com/lestrrat-go/jwx/internal/keyconv"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/pkg/errors"
 )
@@ -67,9 +68,9 @@ func (s ECDSASigner) Sign(payload []byte, key interface{}) ([]byte, error) {
 		return nil, errors.New(`missing private key while signing payload`)
 	}
 
-	ecdsakey, ok := key.(*ecdsa.PrivateKey)
+	ecdsakey, ok := keyconv.ECDSAPrivateKey(key)
 	if !ok {
-		return nil, errors.Errorf(`invalid key type %T. *ecdsa.PrivateKey is required`, key)
+		return nil, errors.Errorf(`invalid key type %T. *ecdsa.PrivateKey or ecdsa.PrivateKey is required`, key)
 	}
 
 	return s.sign(payload, ecdsakey)
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 
+	"github.com/lestrrat-go/jwx/internal/keyconv"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/pkg/errors"
 )
@@ -86,9 +87,9 @@ func (s RSASigner) Sign(payload []byte, key interface{}) ([]byte, error) {
 	if key == nil {
 		return nil, errors.New(`missing private key while signing payload`)
 	}
-	rsakey, ok := key.(*rsa.PrivateKey)
+	rsakey, ok := keyconv.RSAPrivateKey(key)
 	if !ok {
-		return nil, errors.Errorf(`invalid key type %T. *rsa.PrivateKey is required`, key)
+		return nil, errors.Errorf(`invalid key type %T. *rsa.PrivateKey or rsa.PrivateKey is required`, key)
 	}
 
 	return s.sign(payload, rsakey)
@@ -98,3 +98,47 @@ func TestSignMulti(t *testing.T) {
 
 	t.Logf("%s", m)
 }
+
+func TestKeyForms(t *testing.T) {
+	payload := []byte("Hello, World!")
+
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, "RSA key generated") {
+		return
+	}
+	dsakey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, "ECDSA key generated") {
+		return
+	}
+
+	testcases := []struct {
+		Name    string
+		Alg     jwa.SignatureAlgorithm
+		Signing interface{}
+		Verify  interface{}
+	}{
+		{Name: "RSA pointer", Alg: jwa.RS256, Signing: rsakey, Verify: &rsakey.PublicKey},
+		{Name: "RSA value", Alg: jwa.RS256, Signing: *rsakey, Verify: rsakey.PublicKey},
+		{Name: "ECDSA pointer", Alg: jwa.ES256, Signing: dsakey, Verify: &dsakey.PublicKey},
+		{Name: "ECDSA value", Alg: jwa.ES256, Signing: *dsakey, Verify: dsakey.PublicKey},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			signed, err := jws.Sign(payload, tc.Alg, tc.Signing)
+			if !assert.NoError(t, err, "jws.Sign should succeed") {
+				return
+			}
+
+			verified, err := jws.Verify(signed, tc.Alg, tc.Verify)
+			if !assert.NoError(t, err, "jws.Verify should succeed") {
+				return
+			}
+
+			if !assert.Equal(t, payload, verified, "verified payload matches") {
+				return
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/ecdsa"
 	"math/big"
 
+	"github.com/lestrrat-go/jwx/internal/keyconv"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/pkg/errors"
 )
@@ -60,9 +61,9 @@ func (v ECDSAVerifier) Verify(payload []byte, signature []byte, key interface{})
 	if key == nil {
 		return errors.New(`missing public key while verifying payload`)
 	}
-	ecdsakey, ok := key.(*ecdsa.PublicKey)
+	ecdsakey, ok := keyconv.ECDSAPublicKey(key)
 	if !ok {
-		return errors.Errorf(`invalid key type %T. *ecdsa.PublicKey is required`, key)
+		return errors.Errorf(`invalid key type %T. *ecdsa.PublicKey or ecdsa.PublicKey is required`, key)
 	}
 
 	return v.verify(payload, signature, ecdsakey)
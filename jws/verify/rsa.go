@@ -4,6 +4,7 @@ import (
 	"crypto"
 	"crypto/rsa"
 
+	"github.com/lestrrat-go/jwx/internal/keyconv"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/pkg/errors"
 )
@@ -77,9 +78,9 @@ func (v RSAVerifier) Verify(payload, signature []byte, key interface{}) error {
 	if key == nil {
 		return errors.New(`missing public key while verifying payload`)
 	}
-	rsakey, ok := key.(*rsa.PublicKey)
+	rsakey, ok := keyconv.RSAPublicKey(key)
 	if !ok {
-		return errors.Errorf(`invalid key type %T. *rsa.PublicKey is required`, key)
+		return errors.Errorf(`invalid key type %T. *rsa.PublicKey or rsa.PublicKey is required`, key)
 	}
 
 	return v.verify(payload, signature, rsakey)
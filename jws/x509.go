@@ -0,0 +1,316 @@
+package jws
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/lestrrat-go/jwx/internal/httpclient"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	pdebug "github.com/lestrrat-go/pdebug"
+	"github.com/pkg/errors"
+)
+
+// DefaultX5UMaxSize is the maximum number of bytes that VerifyWithX5U
+// reads from the "x5u" URL, unless overridden by WithX5UMaxSize
+const DefaultX5UMaxSize = 64 * 1024
+
+// X509Thumbprints computes the base64url encoded SHA-1 ("x5t") and
+// SHA-256 ("x5t#S256") thumbprints of the DER encoding of `cert`
+func X509Thumbprints(cert *x509.Certificate) (x5t string, x5tS256 string) {
+	s1 := sha1.Sum(cert.Raw)
+	s256 := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(s1[:]), base64.RawURLEncoding.EncodeToString(s256[:])
+}
+
+// SetX509CertChain sets the "x5c" parameter of the header to `certs`,
+// which must start with the leaf certificate, as well as the "x5t" and
+// "x5t#S256" thumbprints of the leaf certificate
+func SetX509CertChain(h Headers, certs ...*x509.Certificate) error {
+	if len(certs) == 0 {
+		return errors.New(`empty certificate chain`)
+	}
+
+	x5c := make([]string, len(certs))
+	for i, cert := range certs {
+		x5c[i] = base64.StdEncoding.EncodeToString(cert.Raw)
+	}
+	if err := h.Set(X509CertChainKey, x5c); err != nil {
+		return errors.Wrapf(err, `failed to set %s`, X509CertChainKey)
+	}
+	return setX509Thumbprints(h, certs[0])
+}
+
+// SetX509Thumbprints sets the "x5t" and "x5t#S256" parameters of the
+// header from the leaf certificate of the "x5c" parameter, which
+// must already be present
+func SetX509Thumbprints(h Headers) error {
+	chain := h.X509CertChain()
+	if len(chain) == 0 {
+		return errors.Errorf(`missing %s in header`, X509CertChainKey)
+	}
+
+	var certs jwk.CertificateChain
+	if err := certs.Accept(chain); err != nil {
+		return errors.Wrapf(err, `failed to parse %s`, X509CertChainKey)
+	}
+	return setX509Thumbprints(h, certs.Get()[0])
+}
+
+func setX509Thumbprints(h Headers, leaf *x509.Certificate) error {
+	x5t, x5tS256 := X509Thumbprints(leaf)
+	if err := h.Set(X509CertThumbprintKey, x5t); err != nil {
+		return errors.Wrapf(err, `failed to set %s`, X509CertThumbprintKey)
+	}
+	if err := h.Set(X509CertThumbprintS256Key, x5tS256); err != nil {
+		return errors.Wrapf(err, `failed to set %s`, X509CertThumbprintS256Key)
+	}
+	return nil
+}
+
+// VerifyWithX5C verifies the JWS message using the public key of the
+// leaf certificate found in the "x5c" parameter of the protected header.
+// The certificate chain must verify against `roots` before the key is used.
+// `roots` must not be nil: the system trust store is never used, as it
+// would make any publicly trusted certificate a valid signing key.
+//
+// Unless WithX509ExtKeyUsages is specified, the leaf certificate must not
+// have the extended key usage extension. WithStrictBase64 is honored as
+// in Verify.
+func VerifyWithX5C(buf []byte, roots *x509.CertPool, options ...Option) (payload []byte, err error) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("jws.VerifyWithX5C").BindError(&err)
+		defer g.End()
+	}
+
+	return verifyWithCertChain(buf, roots, options, func(h Headers) ([]*x509.Certificate, error) {
+		chain := h.X509CertChain()
+		if len(chain) == 0 {
+			return nil, errors.New(`missing "x5c" in protected header`)
+		}
+
+		var certs jwk.CertificateChain
+		if err := certs.Accept(chain); err != nil {
+			return nil, errors.Wrap(err, `failed to parse "x5c"`)
+		}
+		return certs.Get(), nil
+	})
+}
+
+// VerifyWithX5U verifies the JWS message using the public key of the
+// leaf certificate in the PEM encoded chain referenced by the "x5u"
+// parameter of the protected header. The certificate chain must verify
+// against `roots` before the key is used, as described in VerifyWithX5C.
+//
+// Note that "x5u" is chosen by whoever created the message, and that it
+// is fetched before anything about the message is trusted. This allows
+// an attacker to make requests to arbitrary URLs, including internal
+// ones (server-side request forgery). Use WithHTTPClient to specify a
+// client that restricts the hosts that may be contacted.
+//
+// Only "https" URLs are fetched unless WithX5UAllowInsecure(true) is
+// specified, including when following redirects, and at most
+// DefaultX5UMaxSize bytes are read unless WithX5UMaxSize is specified.
+// The chain is fetched using the client specified by WithHTTPClient.
+func VerifyWithX5U(buf []byte, roots *x509.CertPool, options ...Option) (payload []byte, err error) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("jws.VerifyWithX5U").BindError(&err)
+		defer g.End()
+	}
+
+	var allowInsecure bool
+	var maxSize int64 = DefaultX5UMaxSize
+	cl := httpclient.Default
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyX5UAllowInsecure:
+			allowInsecure = option.Value().(bool)
+		case optkeyX5UMaxSize:
+			maxSize = option.Value().(int64)
+		case optkeyHTTPClient:
+			if v := option.Value().(*http.Client); v != nil {
+				cl = v
+			}
+		}
+	}
+
+	return verifyWithCertChain(buf, roots, options, func(h Headers) ([]*x509.Certificate, error) {
+		u := h.X509URL()
+		if u == "" {
+			return nil, errors.New(`missing "x5u" in protected header`)
+		}
+		return fetchX5U(cl, u, allowInsecure, maxSize)
+	})
+}
+
+// verifyWithCertChain parses the message, and for each signature obtains
+// the certificate chain from the protected header using `getChain`. The
+// first chain that is trusted and whose leaf key verifies the message wins.
+func verifyWithCertChain(buf []byte, roots *x509.CertPool, options []Option, getChain func(Headers) ([]*x509.Certificate, error)) ([]byte, error) {
+	if roots == nil {
+		return nil, errors.New(`missing root certificates`)
+	}
+
+	usages := extKeyUsagesFromOptions(options)
+
+	m, err := Parse(bytes.NewReader(buf), options...)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to parse message`)
+	}
+
+	lastErr := errors.New(`no signatures with a protected header`)
+	for _, sig := range m.Signatures() {
+		h := sig.ProtectedHeaders()
+		if h == nil {
+			continue
+		}
+
+		certs, err := getChain(h)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		key, err := verifyCertChain(certs, roots, usages)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		payload, err := Verify(buf, jwa.SignatureAlgorithm(h.Algorithm()), key, options...)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return payload, nil
+	}
+	return nil, errors.Wrap(lastErr, `failed to verify message using certificate chain`)
+}
+
+// verifyCertChain verifies that the chain, with the leaf certificate
+// first, is trusted by `roots` for one of `usages`, and returns the
+// leaf's public key. If `usages` is empty, the leaf must not have any
+// extended key usages
+func verifyCertChain(certs []*x509.Certificate, roots *x509.CertPool, usages []x509.ExtKeyUsage) (interface{}, error) {
+	if len(certs) == 0 {
+		return nil, errors.New(`empty certificate chain`)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	leaf := certs[0]
+	if len(usages) == 0 {
+		if len(leaf.ExtKeyUsage) > 0 || len(leaf.UnknownExtKeyUsage) > 0 {
+			return nil, errors.New(`leaf certificate has extended key usages, but none were specified as acceptable`)
+		}
+		usages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     usages,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to verify certificate chain`)
+	}
+	return leaf.PublicKey, nil
+}
+
+func extKeyUsagesFromOptions(options []Option) []x509.ExtKeyUsage {
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyX509ExtKeyUsages:
+			return option.Value().([]x509.ExtKeyUsage)
+		}
+	}
+	return nil
+}
+
+// checkX5UScheme checks that "x5u" may be fetched from `u`
+func checkX5UScheme(u *url.URL, allowInsecure bool) error {
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if !allowInsecure {
+			return errors.New(`refusing to fetch "x5u" over plain http`)
+		}
+	default:
+		return errors.Errorf(`unsupported "x5u" scheme: %s`, u.Scheme)
+	}
+	return nil
+}
+
+func fetchX5U(cl *http.Client, u string, allowInsecure bool, maxSize int64) ([]*x509.Certificate, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to parse "x5u"`)
+	}
+	if err := checkX5UScheme(parsed, allowInsecure); err != nil {
+		return nil, err
+	}
+
+	// Apply the same restrictions to every redirect, on a copy of the
+	// client so that the caller's client is not modified
+	clcopy := *cl
+	checkRedirect := cl.CheckRedirect
+	clcopy.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := checkX5UScheme(req.URL, allowInsecure); err != nil {
+			return err
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New(`stopped after 10 redirects`)
+		}
+		return nil
+	}
+
+	res, err := clcopy.Get(parsed.String())
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to fetch "x5u"`)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf(`failed to fetch "x5u": %s`, res.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to read "x5u" response`)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, errors.Errorf(`"x5u" response exceeds %d bytes`, maxSize)
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to parse certificate`)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
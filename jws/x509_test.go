@@ -0,0 +1,306 @@
+package jws_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCertChain struct {
+	roots *x509.CertPool
+	key   *ecdsa.PrivateKey
+	certs [][]byte // DER, leaf first
+}
+
+func makeTestCertChain(t *testing.T, usages ...x509.ExtKeyUsage) (*testCertChain, bool) {
+	cakey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, `generating CA key should succeed`) {
+		return nil, false
+	}
+	catmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, catmpl, catmpl, &cakey.PublicKey, cakey)
+	if !assert.NoError(t, err, `creating CA certificate should succeed`) {
+		return nil, false
+	}
+	cacert, err := x509.ParseCertificate(caDER)
+	if !assert.NoError(t, err, `parsing CA certificate should succeed`) {
+		return nil, false
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, `generating leaf key should succeed`) {
+		return nil, false
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  usages,
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, tmpl, cacert, &key.PublicKey, cakey)
+	if !assert.NoError(t, err, `creating leaf certificate should succeed`) {
+		return nil, false
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cacert)
+	return &testCertChain{
+		roots: roots,
+		key:   key,
+		certs: [][]byte{leafDER, caDER},
+	}, true
+}
+
+func signWithHeader(t *testing.T, key interface{}, name string, value interface{}) ([]byte, bool) {
+	var hdr jws.StandardHeaders
+	if !assert.NoError(t, hdr.Set(name, value), `setting header should succeed`) {
+		return nil, false
+	}
+	signed, err := jws.Sign([]byte(`Lorem ipsum`), jwa.ES256, key, jws.WithHeaders(&hdr))
+	if !assert.NoError(t, err, `jws.Sign should succeed`) {
+		return nil, false
+	}
+	return signed, true
+}
+
+func TestVerifyWithX5C(t *testing.T) {
+	chain, ok := makeTestCertChain(t)
+	if !ok {
+		return
+	}
+
+	var x5c []string
+	for _, der := range chain.certs {
+		x5c = append(x5c, base64.StdEncoding.EncodeToString(der))
+	}
+	signed, ok := signWithHeader(t, chain.key, jws.X509CertChainKey, x5c)
+	if !ok {
+		return
+	}
+
+	payload, err := jws.VerifyWithX5C(signed, chain.roots)
+	if !assert.NoError(t, err, `jws.VerifyWithX5C should succeed`) {
+		return
+	}
+	assert.Equal(t, []byte(`Lorem ipsum`), payload, `payload should match`)
+
+	_, err = jws.VerifyWithX5C(signed, x509.NewCertPool())
+	assert.Error(t, err, `jws.VerifyWithX5C should fail with untrusted roots`)
+
+	_, err = jws.VerifyWithX5C(signed, nil)
+	assert.Error(t, err, `jws.VerifyWithX5C should fail without roots`)
+
+	t.Run("Extended key usages", func(t *testing.T) {
+		chain, ok := makeTestCertChain(t, x509.ExtKeyUsageServerAuth)
+		if !ok {
+			return
+		}
+
+		var x5c []string
+		for _, der := range chain.certs {
+			x5c = append(x5c, base64.StdEncoding.EncodeToString(der))
+		}
+		signed, ok := signWithHeader(t, chain.key, jws.X509CertChainKey, x5c)
+		if !ok {
+			return
+		}
+
+		_, err := jws.VerifyWithX5C(signed, chain.roots)
+		assert.Error(t, err, `jws.VerifyWithX5C should fail for unexpected extended key usages`)
+
+		_, err = jws.VerifyWithX5C(signed, chain.roots, jws.WithX509ExtKeyUsages(x509.ExtKeyUsageCodeSigning))
+		assert.Error(t, err, `jws.VerifyWithX5C should fail for other extended key usages`)
+
+		_, err = jws.VerifyWithX5C(signed, chain.roots, jws.WithX509ExtKeyUsages(x509.ExtKeyUsageServerAuth))
+		assert.NoError(t, err, `jws.VerifyWithX5C should succeed for the specified extended key usage`)
+	})
+}
+
+func TestSetX509CertChain(t *testing.T) {
+	chain, ok := makeTestCertChain(t)
+	if !ok {
+		return
+	}
+
+	var certs []*x509.Certificate
+	for _, der := range chain.certs {
+		cert, err := x509.ParseCertificate(der)
+		if !assert.NoError(t, err, `parsing certificate should succeed`) {
+			return
+		}
+		certs = append(certs, cert)
+	}
+
+	s1 := sha1.Sum(chain.certs[0])
+	s256 := sha256.Sum256(chain.certs[0])
+	expectedX5T := base64.RawURLEncoding.EncodeToString(s1[:])
+	expectedX5TS256 := base64.RawURLEncoding.EncodeToString(s256[:])
+
+	t.Run("From certificates", func(t *testing.T) {
+		var hdr jws.StandardHeaders
+		if !assert.NoError(t, jws.SetX509CertChain(&hdr, certs...), `jws.SetX509CertChain should succeed`) {
+			return
+		}
+		assert.Len(t, hdr.X509CertChain(), 2, `x5c should contain the whole chain`)
+		assert.Equal(t, expectedX5T, hdr.X509CertThumbprint(), `x5t should match`)
+		assert.Equal(t, expectedX5TS256, hdr.X509CertThumbprintS256(), `x5t#S256 should match`)
+
+		signed, err := jws.Sign([]byte(`Lorem ipsum`), jwa.ES256, chain.key, jws.WithHeaders(&hdr))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		_, err = jws.VerifyWithX5C(signed, chain.roots)
+		assert.NoError(t, err, `jws.VerifyWithX5C should succeed`)
+	})
+	t.Run("From x5c", func(t *testing.T) {
+		var hdr jws.StandardHeaders
+		if !assert.Error(t, jws.SetX509Thumbprints(&hdr), `jws.SetX509Thumbprints should fail without x5c`) {
+			return
+		}
+
+		x5c := []string{base64.StdEncoding.EncodeToString(chain.certs[0])}
+		if !assert.NoError(t, hdr.Set(jws.X509CertChainKey, x5c), `setting x5c should succeed`) {
+			return
+		}
+		if !assert.NoError(t, jws.SetX509Thumbprints(&hdr), `jws.SetX509Thumbprints should succeed`) {
+			return
+		}
+		assert.Equal(t, expectedX5T, hdr.X509CertThumbprint(), `x5t should match`)
+		assert.Equal(t, expectedX5TS256, hdr.X509CertThumbprintS256(), `x5t#S256 should match`)
+	})
+	t.Run("Empty chain", func(t *testing.T) {
+		var hdr jws.StandardHeaders
+		assert.Error(t, jws.SetX509CertChain(&hdr), `jws.SetX509CertChain should fail`)
+	})
+}
+
+func TestVerifyWithX5U(t *testing.T) {
+	chain, ok := makeTestCertChain(t)
+	if !ok {
+		return
+	}
+
+	var pemChain bytes.Buffer
+	for _, der := range chain.certs {
+		pem.Encode(&pemChain, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(pemChain.Bytes())
+	}))
+	defer srv.Close()
+
+	signed, ok := signWithHeader(t, chain.key, jws.X509URLKey, srv.URL)
+	if !ok {
+		return
+	}
+
+	t.Run("Plain http is refused by default", func(t *testing.T) {
+		_, err := jws.VerifyWithX5U(signed, chain.roots)
+		assert.Error(t, err, `jws.VerifyWithX5U should fail`)
+	})
+	t.Run("Plain http allowed", func(t *testing.T) {
+		payload, err := jws.VerifyWithX5U(signed, chain.roots, jws.WithX5UAllowInsecure(true))
+		if !assert.NoError(t, err, `jws.VerifyWithX5U should succeed`) {
+			return
+		}
+		assert.Equal(t, []byte(`Lorem ipsum`), payload, `payload should match`)
+	})
+	t.Run("Response too large", func(t *testing.T) {
+		_, err := jws.VerifyWithX5U(signed, chain.roots, jws.WithX5UAllowInsecure(true), jws.WithX5UMaxSize(16))
+		assert.Error(t, err, `jws.VerifyWithX5U should fail`)
+	})
+	t.Run("Untrusted roots", func(t *testing.T) {
+		_, err := jws.VerifyWithX5U(signed, x509.NewCertPool(), jws.WithX5UAllowInsecure(true))
+		assert.Error(t, err, `jws.VerifyWithX5U should fail`)
+	})
+	t.Run("Redirect to plain http", func(t *testing.T) {
+		tlssrv := httptest.NewTLSServer(http.RedirectHandler(srv.URL, http.StatusFound))
+		defer tlssrv.Close()
+
+		signed, ok := signWithHeader(t, chain.key, jws.X509URLKey, tlssrv.URL)
+		if !ok {
+			return
+		}
+
+		_, err := jws.VerifyWithX5U(signed, chain.roots, jws.WithHTTPClient(tlssrv.Client()))
+		assert.Error(t, err, `jws.VerifyWithX5U should fail`)
+
+		payload, err := jws.VerifyWithX5U(signed, chain.roots, jws.WithHTTPClient(tlssrv.Client()), jws.WithX5UAllowInsecure(true))
+		if !assert.NoError(t, err, `jws.VerifyWithX5U should succeed`) {
+			return
+		}
+		assert.Equal(t, []byte(`Lorem ipsum`), payload, `payload should match`)
+	})
+}
+
+type countingTransport struct {
+	count int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.count++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, "RSA key generated") {
+		return
+	}
+	pubkey, err := jwk.New(&rsakey.PublicKey)
+	if !assert.NoError(t, err, "jwk.New should succeed") {
+		return
+	}
+	pubkey.Set(jwk.AlgorithmKey, jwa.RS256.String())
+	jwks, err := json.Marshal(jwk.Set{Keys: []jwk.Key{pubkey}})
+	if !assert.NoError(t, err, "json.Marshal should succeed") {
+		return
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(jwks)
+	}))
+	defer srv.Close()
+
+	signed, err := jws.Sign([]byte("Lorem ipsum"), jwa.RS256, rsakey)
+	if !assert.NoError(t, err, "jws.Sign should succeed") {
+		return
+	}
+
+	var transport countingTransport
+	payload, err := jws.VerifyWithJKU(signed, srv.URL, jws.WithHTTPClient(&http.Client{Transport: &transport}))
+	if !assert.NoError(t, err, "jws.VerifyWithJKU should succeed") {
+		return
+	}
+	assert.Equal(t, []byte("Lorem ipsum"), payload, "payload should match")
+	assert.Equal(t, 1, transport.count, "request should go through the given client")
+}
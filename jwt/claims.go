@@ -0,0 +1,123 @@
+package jwt
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// GetString returns the value of the claim `name` as a string. An error
+// is returned if the claim does not exist or is not a string.
+func (t *Token) GetString(name string) (string, error) {
+	v, ok := t.Get(name)
+	if !ok {
+		return "", errors.Errorf(`claim %s does not exist`, name)
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return "", errors.Errorf(`claim %s is not a string: %T`, name, v)
+	}
+	return s, nil
+}
+
+// GetInt64 returns the value of the claim `name` as an int64. Numbers
+// decoded from JSON (float64 or json.Number) are accepted as long as
+// they hold an integral value. An error is returned if the claim does
+// not exist or is not an integer.
+func (t *Token) GetInt64(name string) (int64, error) {
+	v, ok := t.Get(name)
+	if !ok {
+		return 0, errors.Errorf(`claim %s does not exist`, name)
+	}
+
+	switch x := v.(type) {
+	case int64:
+		return x, nil
+	case int32:
+		return int64(x), nil
+	case int:
+		return int64(x), nil
+	case float64:
+		// math.MaxInt64 is not representable as a float64, and rounds
+		// up to 2^63, which is already out of range
+		if x != math.Trunc(x) || x >= 1<<63 || x < -1<<63 {
+			return 0, errors.Errorf(`claim %s is not an integer: %v`, name, x)
+		}
+		return int64(x), nil
+	case json.Number:
+		i, err := x.Int64()
+		if err != nil {
+			return 0, errors.Wrapf(err, `claim %s is not an integer`, name)
+		}
+		return i, nil
+	default:
+		return 0, errors.Errorf(`claim %s is not an integer: %T`, name, v)
+	}
+}
+
+// GetBool returns the value of the claim `name` as a bool. An error
+// is returned if the claim does not exist or is not a boolean.
+func (t *Token) GetBool(name string) (bool, error) {
+	v, ok := t.Get(name)
+	if !ok {
+		return false, errors.Errorf(`claim %s does not exist`, name)
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, errors.Errorf(`claim %s is not a boolean: %T`, name, v)
+	}
+	return b, nil
+}
+
+// GetStringSlice returns the value of the claim `name` as a list of
+// strings. An error is returned if the claim does not exist, is not
+// a list, or contains elements that are not strings.
+func (t *Token) GetStringSlice(name string) ([]string, error) {
+	v, ok := t.Get(name)
+	if !ok {
+		return nil, errors.Errorf(`claim %s does not exist`, name)
+	}
+
+	switch x := v.(type) {
+	case []string:
+		return x, nil
+	case stringList:
+		return []string(x), nil
+	case []interface{}:
+		var l stringList
+		if err := l.Accept(x); err != nil {
+			return nil, errors.Wrapf(err, `claim %s is not a list of strings`, name)
+		}
+		return []string(l), nil
+	default:
+		return nil, errors.Errorf(`claim %s is not a list of strings: %T`, name, v)
+	}
+}
+
+// GetTime returns the value of the claim `name` as a time.Time. Numeric
+// values are treated as NumericDate values, i.e. the number of seconds
+// since the epoch. An error is returned if the claim does not exist or
+// can not be converted.
+func (t *Token) GetTime(name string) (time.Time, error) {
+	v, ok := t.Get(name)
+	if !ok {
+		return time.Time{}, errors.Errorf(`claim %s does not exist`, name)
+	}
+
+	switch x := v.(type) {
+	case *NumericDate:
+		return x.Get(), nil
+	case NumericDate:
+		return x.Time, nil
+	}
+
+	var n NumericDate
+	if err := n.Accept(v); err != nil {
+		return time.Time{}, errors.Wrapf(err, `claim %s is not a time`, name)
+	}
+	return n.Get(), nil
+}
@@ -0,0 +1,63 @@
+package jwt
+
+// Clone creates a deep copy of the token. Modifying the returned token
+// (or any of its claims) does not affect the original, which makes it
+// the recommended way to share a token across goroutines.
+func (t *Token) Clone() *Token {
+	dst := New()
+	if t.audience != nil {
+		dst.audience = make(stringList, len(t.audience))
+		copy(dst.audience, t.audience)
+	}
+	dst.expiration = cloneNumericDate(t.expiration)
+	dst.issuedAt = cloneNumericDate(t.issuedAt)
+	dst.issuer = cloneString(t.issuer)
+	dst.jwtID = cloneString(t.jwtID)
+	dst.notBefore = cloneNumericDate(t.notBefore)
+	dst.subject = cloneString(t.subject)
+	for k, v := range t.privateClaims {
+		dst.privateClaims[k] = cloneClaimValue(v)
+	}
+	return dst
+}
+
+func cloneNumericDate(v *NumericDate) *NumericDate {
+	if v == nil {
+		return nil
+	}
+	n := *v
+	return &n
+}
+
+func cloneString(v *string) *string {
+	if v == nil {
+		return nil
+	}
+	s := *v
+	return &s
+}
+
+// cloneClaimValue copies the container types that encoding/json produces
+// when decoding arbitrary values. Other values are copied as-is.
+func cloneClaimValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			m[k] = cloneClaimValue(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(x))
+		for i, e := range x {
+			l[i] = cloneClaimValue(e)
+		}
+		return l
+	case []string:
+		l := make([]string, len(x))
+		copy(l, x)
+		return l
+	default:
+		return v
+	}
+}
@@ -65,12 +65,18 @@ func ExampleToken() {
 	}
 
 	fmt.Printf("%s\n", buf)
-	fmt.Printf("aud -> '%s'\n", t.Audience())
-	fmt.Printf("iat -> '%s'\n", t.IssuedAt().Format(time.RFC3339))
+	if v, ok := t.Audience(); ok {
+		fmt.Printf("aud -> '%s'\n", v)
+	}
+	if v, ok := t.IssuedAt(); ok {
+		fmt.Printf("iat -> '%s'\n", v.Format(time.RFC3339))
+	}
 	if v, ok := t.Get(`privateClaimKey`); ok {
 		fmt.Printf("privateClaimKey -> '%s'\n", v)
 	}
-	fmt.Printf("sub -> '%s'\n", t.Subject())
+	if v, ok := t.Subject(); ok {
+		fmt.Printf("sub -> '%s'\n", v)
+	}
 
 	// OUTPUT:
 	// {
@@ -79,7 +85,7 @@ func ExampleToken() {
 	//   "privateClaimKey": "Hello, World!",
 	//   "sub": "https://github.com/lestrrat-go/jwx/jwt"
 	// }
-	// aud -> 'Golang Users'
+	// aud -> '[Golang Users]'
 	// iat -> '1977-05-25T18:00:00Z'
 	// privateClaimKey -> 'Hello, World!'
 	// sub -> 'https://github.com/lestrrat-go/jwx/jwt'
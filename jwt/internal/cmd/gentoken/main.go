@@ -35,12 +35,20 @@ type tokenField struct {
 	hasAccept bool
 	noDeref   bool
 	elemType  string
+	getter    string
 }
 
 func (t tokenField) UpperName() string {
 	return strings.Title(t.Name)
 }
 
+func (t tokenField) GetterName() string {
+	if t.getter != "" {
+		return t.getter
+	}
+	return t.UpperName()
+}
+
 func (t tokenField) IsList() bool {
 	return t.isList || strings.HasPrefix(t.Type, `[]`)
 }
@@ -111,6 +119,7 @@ func generateToken() error {
 			JSONKey: "jti",
 			Type:    "*string",
 			Comment: `https://tools.ietf.org/html/rfc7519#section-4.1.7`,
+			getter:  "JWTID",
 		},
 		{
 			Name:      "notBefore",
@@ -157,6 +166,9 @@ func generateToken() error {
 	fmt.Fprintf(&buf, "\n// methods but their types are not taken into consideration at all. If you have non-standard")
 	fmt.Fprintf(&buf, "\n// claims that you must frequently access, consider wrapping the token in a wrapper")
 	fmt.Fprintf(&buf, "\n// by embedding the jwt.Token type in it")
+	fmt.Fprintf(&buf, "\n//")
+	fmt.Fprintf(&buf, "\n// A Token is not safe for concurrent mutation. If a token needs to be")
+	fmt.Fprintf(&buf, "\n// shared across goroutines, hand out independent copies using `Clone`")
 	fmt.Fprintf(&buf, "\ntype Token struct {")
 	for _, field := range fields {
 		fmt.Fprintf(&buf, "\n%s %s // %s", field.Name, field.Type, field.Comment)
@@ -280,43 +292,33 @@ func generateToken() error {
 	fmt.Fprintf(&buf, "\n}") // end func MarshalJSON
 
 	for _, field := range fields {
+		fmt.Fprintf(&buf, "\n\n// %s returns the value of the %s claim, and whether", field.GetterName(), strconv.Quote(field.JSONKey))
+		fmt.Fprintf(&buf, "\n// the claim is present in the token")
 		switch {
 		case field.IsList():
-			fmt.Fprintf(&buf, "\n\nfunc (t Token) %s() %s {", field.UpperName(), field.ListElem())
-			fmt.Fprintf(&buf, "\nif v, ok := t.Get(%sKey); ok {", field.UpperName())
-			fmt.Fprintf(&buf, "\nreturn (v.(%s))[0]", field.Type)
-			fmt.Fprintf(&buf, "\n}") // end if v, ok := t.Get(%sKey)
-			fmt.Fprintf(&buf, "\nreturn %s", zeroval(field.ListElem()))
-			fmt.Fprintf(&buf, "\n}") // end func (t Token) %s() %s
+			fmt.Fprintf(&buf, "\nfunc (t *Token) %s() ([]%s, bool) {", field.GetterName(), field.ListElem())
+			fmt.Fprintf(&buf, "\nif len(t.%s) == 0 {", field.Name)
+			fmt.Fprintf(&buf, "\nreturn nil, false")
+			fmt.Fprintf(&buf, "\n}") // end if len(t.%s) == 0
+			fmt.Fprintf(&buf, "\nreturn append([]%s(nil), t.%s...), true", field.ListElem(), field.Name)
+			fmt.Fprintf(&buf, "\n}") // end func (t *Token) %s()
 		case field.Type == "*NumericDate":
-			fmt.Fprintf(&buf, "\n\nfunc (t Token) %s() time.Time {", field.UpperName())
-			fmt.Fprintf(&buf, "\nreturn timeFromNumericDateClaim(&t, %sKey)", field.UpperName())
-			fmt.Fprintf(&buf, "\n}") // end func (t Token) %s()
+			fmt.Fprintf(&buf, "\nfunc (t *Token) %s() (time.Time, bool) {", field.GetterName())
+			fmt.Fprintf(&buf, "\nif t.%s == nil {", field.Name)
+			fmt.Fprintf(&buf, "\nreturn time.Time{}, false")
+			fmt.Fprintf(&buf, "\n}") // end if t.%s == nil
+			fmt.Fprintf(&buf, "\nreturn t.%s.Time, true", field.Name)
+			fmt.Fprintf(&buf, "\n}") // end func (t *Token) %s()
 		case field.IsPointer():
-			fmt.Fprintf(&buf, "\n\nfunc (t Token) %s() %s {", field.UpperName(), field.PointerElem())
-			fmt.Fprintf(&buf, "\nif v, ok := t.Get(%sKey); ok {", field.UpperName())
-			fmt.Fprintf(&buf, "\nreturn v.(%s)", field.PointerElem())
-			fmt.Fprintf(&buf, "\n}") // end if v, ok := t.Get(%sKey)
-			fmt.Fprintf(&buf, "\nreturn %s", zeroval(field.PointerElem()))
-			fmt.Fprintf(&buf, "\n}") // end func (t Token) %s() %s
+			fmt.Fprintf(&buf, "\nfunc (t *Token) %s() (%s, bool) {", field.GetterName(), field.PointerElem())
+			fmt.Fprintf(&buf, "\nif t.%s == nil {", field.Name)
+			fmt.Fprintf(&buf, "\nreturn %s, false", zeroval(field.PointerElem()))
+			fmt.Fprintf(&buf, "\n}") // end if t.%s == nil
+			fmt.Fprintf(&buf, "\nreturn *(t.%s), true", field.Name)
+			fmt.Fprintf(&buf, "\n}") // end func (t *Token) %s()
 		}
 	}
 
-	fmt.Fprintf(&buf, "\n\nfunc timeFromNumericDateClaim(t *Token, key string) time.Time {")
-	fmt.Fprintf(&buf, "\nv, ok := t.Get(key)")
-	fmt.Fprintf(&buf, "\nif !ok {")
-	fmt.Fprintf(&buf, "\nreturn time.Time{}")
-	fmt.Fprintf(&buf, "\n}") // end if !ok
-	fmt.Fprintf(&buf, "\n\nswitch x := v.(type) {")
-	fmt.Fprintf(&buf, "\ncase time.Time:")
-	fmt.Fprintf(&buf, "\nreturn x")
-	fmt.Fprintf(&buf, "\ncase *NumericDate:")
-	fmt.Fprintf(&buf, "\nreturn x.Time")
-	fmt.Fprintf(&buf, "\ndefault:")
-	fmt.Fprintf(&buf, "\nreturn time.Time{}")
-	fmt.Fprintf(&buf, "\n}") // end switch x
-	fmt.Fprintf(&buf, "\n}") // end func (t *Token) timeFromNumericDate
-
 	formatted, err := format.Source(buf.Bytes())
 	if err != nil {
 		log.Printf("%s", buf.Bytes())
@@ -0,0 +1,170 @@
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/pkg/errors"
+)
+
+// ErrUnknownIssuer is returned by IssuerVerifier when the "iss" claim of
+// a token does not name any of the configured issuers. Use errors.Cause
+// to compare it.
+var ErrUnknownIssuer = errors.New(`unknown issuer`)
+
+// PeekIssuer returns the "iss" claim of a signed token WITHOUT verifying
+// its signature. The result must not be trusted by itself: it is only
+// useful to decide which keys should be used to verify the token.
+func PeekIssuer(buf []byte) (string, error) {
+	m, err := jws.Parse(bytes.NewReader(buf))
+	if err != nil {
+		return "", errors.Wrap(err, `invalid jws message`)
+	}
+
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+	if err := json.Unmarshal(m.Payload(), &claims); err != nil {
+		return "", errors.Wrap(err, `failed to parse token`)
+	}
+	return claims.Issuer, nil
+}
+
+// IssuerVerifier verifies tokens issued by any one of a fixed set of
+// issuers, each of which publishes its keys as a JWK set.
+//
+// The JWK set of an issuer is fetched the first time a token from that
+// issuer is verified, and is then kept up to date using jwk.AutoRefresh.
+type IssuerVerifier struct {
+	ctx     context.Context
+	urls    map[string]string
+	options []jwk.Option
+
+	mu    sync.Mutex
+	cache map[string]*jwk.AutoRefresh
+}
+
+// NewIssuerVerifier creates a verifier for the issuers in `urls`, which
+// maps the value of the "iss" claim to the URL of the issuer's JWK set.
+// The JWK sets are refreshed until `ctx` is canceled. The options are
+// passed to jwk.AutoRefresh.Configure.
+func NewIssuerVerifier(ctx context.Context, urls map[string]string, options ...jwk.Option) *IssuerVerifier {
+	m := make(map[string]string, len(urls))
+	for iss, u := range urls {
+		m[iss] = u
+	}
+	return &IssuerVerifier{
+		ctx:     ctx,
+		urls:    m,
+		options: options,
+		cache:   make(map[string]*jwk.AutoRefresh),
+	}
+}
+
+// Verify verifies the signature of a token in compact or JSON
+// serialization, and returns the parsed token.
+//
+// The key is picked from the JWK set of the issuer named in the "iss"
+// claim, using the "kid" header of the signature. If the signature has
+// no "kid", every key in the set is tried. Tokens from issuers that are
+// not configured are rejected with ErrUnknownIssuer before anything is
+// fetched.
+//
+// Only the signature is verified. Use Token.Verify to validate the claims.
+func (v *IssuerVerifier) Verify(ctx context.Context, buf []byte) (*Token, error) {
+	iss, err := PeekIssuer(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to read issuer`)
+	}
+
+	ar, err := v.autoRefresh(iss)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := jws.Parse(bytes.NewReader(buf))
+	if err != nil {
+		return nil, errors.Wrap(err, `invalid jws message`)
+	}
+	sigs := m.Signatures()
+	if len(sigs) != 1 || sigs[0].ProtectedHeaders() == nil {
+		return nil, errors.New(`expected exactly one signature with protected headers`)
+	}
+	hdr := sigs[0].ProtectedHeaders()
+
+	set, err := ar.Fetch(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, `failed to fetch JWK set for issuer %q`, iss)
+	}
+
+	keys := set.Keys
+	if kid := hdr.KeyID(); kid != "" {
+		keys = set.LookupKeyID(kid)
+	}
+
+	alg := hdr.Algorithm()
+	for _, key := range keys {
+		payload, err := verifyWithKey(buf, alg, key)
+		if err != nil {
+			continue
+		}
+
+		var token Token
+		if err := json.Unmarshal(payload, &token); err != nil {
+			return nil, errors.Wrap(err, `failed to parse token`)
+		}
+		return &token, nil
+	}
+	return nil, errors.Errorf(`failed to verify token with any key of issuer %q`, iss)
+}
+
+func (v *IssuerVerifier) autoRefresh(iss string) (*jwk.AutoRefresh, error) {
+	u, ok := v.urls[iss]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownIssuer, `issuer %q`, iss)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	ar, ok := v.cache[iss]
+	if !ok {
+		ar = jwk.NewAutoRefresh(v.ctx)
+		ar.Configure(u, v.options...)
+		v.cache[iss] = ar
+	}
+	return ar, nil
+}
+
+// verifyWithKey verifies buf with the algorithm named in its header, as
+// long as the key may be used for it: the key's own "alg" (if any) must
+// match, and its type must support the algorithm.
+func verifyWithKey(buf []byte, alg jwa.SignatureAlgorithm, key jwk.Key) ([]byte, error) {
+	if !key.KeyOps().Permits(jwk.KeyOpVerify) {
+		return nil, errors.New(`key may not be used for verification`)
+	}
+	if use := key.KeyUsage(); use != "" && use != string(jwk.ForSignature) {
+		return nil, errors.New(`key may not be used for signatures`)
+	}
+	if keyalg := key.Algorithm(); keyalg != "" && keyalg != alg.String() {
+		return nil, errors.Errorf(`key is for algorithm %q`, keyalg)
+	}
+
+	supported, _ := jwk.SupportedAlgorithms(key)
+	for _, candidate := range supported {
+		if candidate != alg {
+			continue
+		}
+		raw, err := key.Materialize()
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to materialize key`)
+		}
+		return jws.Verify(buf, alg, raw)
+	}
+	return nil, errors.Errorf(`key does not support algorithm %q`, alg)
+}
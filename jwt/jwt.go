@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe"
 	"github.com/lestrrat-go/jwx/jws"
 	"github.com/pkg/errors"
 )
@@ -31,26 +32,52 @@ func ParseBytes(s []byte, options ...Option) (*Token, error) {
 // If the token is signed and you want to verify the payload, you must
 // pass the jwt.WithVerify(alg, key) option. If you do not specify these
 // parameters, no verification will be performed.
+//
+// If the jwt.WithCanonicalPayload() option is specified, the payload
+// must also be in canonical JSON form.
+//
+// If the jwt.WithStrictBase64() option is specified, tokens whose
+// segments are not canonically base64url encoded are rejected.
 func Parse(src io.Reader, options ...Option) (*Token, error) {
 	var params VerifyParameters
+	var canonical bool
+	var jwsOptions []jws.Option
 	for _, o := range options {
 		switch o.Name() {
 		case optkeyVerify:
 			params = o.Value().(VerifyParameters)
+		case optkeyCanonicalPayload:
+			canonical = o.Value().(bool)
+		case optkeyStrictBase64:
+			if o.Value().(bool) {
+				jwsOptions = append(jwsOptions, jws.WithStrictBase64())
+			}
 		}
 	}
 
+	var payload []byte
 	if params != nil {
-		return ParseVerify(src, params.Algorithm(), params.Key())
+		v, err := verifyPayload(src, params.Algorithm(), params.Key(), jwsOptions...)
+		if err != nil {
+			return nil, err
+		}
+		payload = v
+	} else {
+		m, err := jws.Parse(src, jwsOptions...)
+		if err != nil {
+			return nil, errors.Wrap(err, `invalid jws message`)
+		}
+		payload = m.Payload()
 	}
 
-	m, err := jws.Parse(src)
-	if err != nil {
-		return nil, errors.Wrap(err, `invalid jws message`)
+	if canonical {
+		if err := checkCanonicalPayload(payload); err != nil {
+			return nil, errors.Wrap(err, `failed to validate payload`)
+		}
 	}
 
 	var token Token
-	if err := json.Unmarshal(m.Payload(), &token); err != nil {
+	if err := json.Unmarshal(payload, &token); err != nil {
 		return nil, errors.Wrap(err, `failed to parse token`)
 	}
 	return &token, nil
@@ -58,15 +85,21 @@ func Parse(src io.Reader, options ...Option) (*Token, error) {
 
 // ParseVerify is a function that is similar to Parse(), but does not
 // allow for parsing without signature verification parameters.
-func ParseVerify(src io.Reader, alg jwa.SignatureAlgorithm, key interface{}) (*Token, error) {
-	data, err := ioutil.ReadAll(src)
-	if err != nil {
-		return nil, errors.Wrap(err, `failed to read token from source`)
+// jwt.WithStrictBase64() is honored as in Parse.
+func ParseVerify(src io.Reader, alg jwa.SignatureAlgorithm, key interface{}, options ...Option) (*Token, error) {
+	var jwsOptions []jws.Option
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyStrictBase64:
+			if o.Value().(bool) {
+				jwsOptions = append(jwsOptions, jws.WithStrictBase64())
+			}
+		}
 	}
 
-	v, err := jws.Verify(data, alg, key)
+	v, err := verifyPayload(src, alg, key, jwsOptions...)
 	if err != nil {
-		return nil, errors.Wrap(err, `failed to verify jws signature`)
+		return nil, err
 	}
 
 	var token Token
@@ -76,6 +109,45 @@ func ParseVerify(src io.Reader, alg jwa.SignatureAlgorithm, key interface{}) (*T
 	return &token, nil
 }
 
+func verifyPayload(src io.Reader, alg jwa.SignatureAlgorithm, key interface{}, options ...jws.Option) ([]byte, error) {
+	data, err := ioutil.ReadAll(src)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to read token from source`)
+	}
+
+	v, err := jws.Verify(data, alg, key, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to verify jws signature`)
+	}
+	return v, nil
+}
+
+// checkCanonicalPayload checks that the payload is in canonical JSON
+// form, that is, object keys are sorted and there is no insignificant
+// whitespace.
+func checkCanonicalPayload(payload []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return errors.Wrap(err, `failed to decode payload`)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return errors.Wrap(err, `failed to encode payload`)
+	}
+
+	// json.Encoder always appends a newline
+	if !bytes.Equal(bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), payload) {
+		return errors.New(`payload is not in canonical JSON form`)
+	}
+	return nil
+}
+
 // New creates a new empty JWT token
 func New() *Token {
 	return &Token{
@@ -83,10 +155,27 @@ func New() *Token {
 	}
 }
 
+// DefaultType is the value of the "typ" header that Sign and Encrypt
+// set unless specified otherwise via WithType
+const DefaultType = `JWT`
+
+func typeFromOptions(options []Option) string {
+	typ := DefaultType
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyType:
+			typ = o.Value().(string)
+		}
+	}
+	return typ
+}
+
 // Sign is a convenience function to create a signed JWT token serialized in
 // compact form. `key` must match the key type required by the given
 // signature method `method`
-func (t *Token) Sign(method jwa.SignatureAlgorithm, key interface{}) ([]byte, error) {
+//
+// The "typ" header is set to DefaultType, unless WithType is specified.
+func (t *Token) Sign(method jwa.SignatureAlgorithm, key interface{}, options ...Option) ([]byte, error) {
 	buf, err := json.Marshal(t)
 	if err != nil {
 		return nil, errors.Wrap(err, `failed to marshal token`)
@@ -94,7 +183,9 @@ func (t *Token) Sign(method jwa.SignatureAlgorithm, key interface{}) ([]byte, er
 
 	var hdr jws.StandardHeaders
 	hdr.Set(`alg`, method.String())
-	hdr.Set(`typ`, `JWT`)
+	if typ := typeFromOptions(options); typ != "" {
+		hdr.Set(`typ`, typ)
+	}
 	sign, err := jws.Sign(buf, method, key, jws.WithHeaders(&hdr))
 	if err != nil {
 		return nil, errors.Wrap(err, `failed to sign payload`)
@@ -102,3 +193,30 @@ func (t *Token) Sign(method jwa.SignatureAlgorithm, key interface{}) ([]byte, er
 
 	return sign, nil
 }
+
+// Encrypt is a convenience function to create an encrypted JWT token
+// serialized in compact form. `key` must match the key type required
+// by the key encryption algorithm `keyalg`.
+//
+// The "typ" header is set to DefaultType, unless WithType is specified.
+// Options of the jwe package, such as jwe.WithAEADFactory, are passed
+// to jwe.EncryptWithHeader.
+func (t *Token) Encrypt(keyalg jwa.KeyEncryptionAlgorithm, key interface{}, contentalg jwa.ContentEncryptionAlgorithm, options ...Option) ([]byte, error) {
+	buf, err := json.Marshal(t)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to marshal token`)
+	}
+
+	hdr := jwe.NewHeader()
+	hdr.Set(`alg`, keyalg)
+	hdr.Set(`enc`, contentalg)
+	if typ := typeFromOptions(options); typ != "" {
+		hdr.Set(`typ`, typ)
+	}
+	encrypted, err := jwe.EncryptWithHeader(buf, key, hdr, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to encrypt payload`)
+	}
+
+	return encrypted, nil
+}
@@ -2,18 +2,28 @@ package jwt_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe"
+	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/lestrrat-go/jwx/jws"
 	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -154,7 +164,8 @@ func TestGHIssue10(t *testing.T) {
 		}
 
 		// This should succeed, because WithIssuer is provided with same value
-		if !assert.NoError(t, t1.Verify(jwt.WithIssuer(t1.Issuer())), "t1.Verify should succeed") {
+		iss, _ := t1.Issuer()
+		if !assert.NoError(t, t1.Verify(jwt.WithIssuer(iss)), "t1.Verify should succeed") {
 			return
 		}
 
@@ -197,7 +208,8 @@ func TestGHIssue10(t *testing.T) {
 		}
 
 		// This should succeed, because WithSubject is provided with same value
-		if !assert.NoError(t, t1.Verify(jwt.WithSubject(t1.Subject())), "token.Verify should succeed") {
+		sub, _ := t1.Subject()
+		if !assert.NoError(t, t1.Verify(jwt.WithSubject(sub)), "token.Verify should succeed") {
 			return
 		}
 
@@ -259,6 +271,35 @@ func TestGHIssue10(t *testing.T) {
 			return
 		}
 	})
+	t.Run(jwt.ExpirationKey+" with WithExpiredOK", func(t *testing.T) {
+		t1 := jwt.New()
+		tm := time.Now()
+		t1.Set(jwt.IssuerKey, "github.com/lestrrat-go/jwx")
+		t1.Set(jwt.ExpirationKey, tm.Add(-1*time.Minute))
+
+		if !assert.Equal(t, jwt.ErrTokenExpired, t1.Verify(), "token.Verify should fail with ErrTokenExpired") {
+			return
+		}
+
+		// Expired, but otherwise valid
+		if !assert.Equal(t, jwt.ErrTokenExpired, t1.Verify(jwt.WithExpiredOK(), jwt.WithIssuer("github.com/lestrrat-go/jwx")), "token.Verify should report the token as expired") {
+			return
+		}
+
+		// Expired and invalid: the other failure takes precedence
+		err := t1.Verify(jwt.WithExpiredOK(), jwt.WithIssuer("example.com"))
+		if !assert.Error(t, err, "token.Verify should fail") {
+			return
+		}
+		if !assert.NotEqual(t, jwt.ErrTokenExpired, err, "token.Verify should not report the token as merely expired") {
+			return
+		}
+
+		t1.Set(jwt.ExpirationKey, tm.Add(time.Hour))
+		if !assert.NoError(t, t1.Verify(jwt.WithExpiredOK()), "token.Verify should succeed for unexpired tokens") {
+			return
+		}
+	})
 }
 
 func TestVerifyClaims(t *testing.T) {
@@ -276,12 +317,149 @@ func TestVerifyClaims(t *testing.T) {
 		}
 
 		if !assert.NoError(t, token.Verify(args...), "token.Verify should validate tokens in the same second they are created") {
-			if now.Equal(token.IssuedAt()) {
+			if iat, _ := token.IssuedAt(); now.Equal(iat) {
 				t.Errorf("iat claim failed: iat == now")
 			}
 			return
 		}
 	})
+	t.Run(jwt.IssuedAtKey+" in the future", func(t *testing.T) {
+		now := time.Now().UTC()
+		clock := jwt.WithClock(jwt.ClockFunc(func() time.Time { return now }))
+
+		token := jwt.New()
+		token.Set(jwt.IssuedAtKey, now.Add(time.Hour))
+
+		if !assert.Error(t, token.Verify(clock), "future iat should be rejected by default") {
+			return
+		}
+		if !assert.Error(t, token.Verify(clock, jwt.WithRejectFutureIssuedAt()), "future iat should be rejected") {
+			return
+		}
+		if !assert.NoError(t, token.Verify(clock, jwt.WithAllowFutureIssuedAt()), "future iat should be accepted when allowed") {
+			return
+		}
+		if !assert.Error(t, token.Verify(clock, jwt.WithAllowFutureIssuedAt(), jwt.WithRejectFutureIssuedAt()), "the last option should win") {
+			return
+		}
+		if !assert.NoError(t, token.Verify(clock, jwt.WithRejectFutureIssuedAt(), jwt.WithAcceptableSkew(2*time.Hour)), "future iat within skew should be accepted") {
+			return
+		}
+
+		missing := jwt.New()
+		if !assert.NoError(t, missing.Verify(clock, jwt.WithRejectFutureIssuedAt()), "missing iat should pass") {
+			return
+		}
+		if !assert.Error(t, missing.Verify(clock, jwt.WithRejectFutureIssuedAt(), jwt.WithRequireIssuedAt()), "missing iat should fail when required") {
+			return
+		}
+	})
+	t.Run(jwt.NonceKey, func(t *testing.T) {
+		token := jwt.New()
+		if _, ok := token.Nonce(); !assert.False(t, ok, "Nonce should report the claim as absent") {
+			return
+		}
+		if !assert.NoError(t, token.Verify(), "nonce should not be checked by default") {
+			return
+		}
+		if !assert.Error(t, token.Verify(jwt.WithNonce("n-0S6_WzA2Mj")), "missing nonce should fail") {
+			return
+		}
+
+		if !assert.NoError(t, token.SetNonce("n-0S6_WzA2Mj"), "SetNonce should succeed") {
+			return
+		}
+		nonce, ok := token.Nonce()
+		if !assert.True(t, ok, "Nonce should report the claim as present") {
+			return
+		}
+		if !assert.Equal(t, "n-0S6_WzA2Mj", nonce, "Nonce should return the claim") {
+			return
+		}
+		if !assert.NoError(t, token.Verify(jwt.WithNonce("n-0S6_WzA2Mj")), "matching nonce should pass") {
+			return
+		}
+		if !assert.Error(t, token.Verify(jwt.WithNonce("n-0S6_WzA2Mk")), "mismatching nonce should fail") {
+			return
+		}
+	})
+	t.Run("consistency", func(t *testing.T) {
+		now := time.Now().UTC()
+		clock := jwt.WithClock(jwt.ClockFunc(func() time.Time { return now }))
+
+		token := jwt.New()
+		token.Set(jwt.ExpirationKey, now.Add(time.Hour))
+		token.Set(jwt.IssuedAtKey, now.Add(2*time.Hour))
+		// The future iat would be rejected on its own, regardless of exp
+		allowIat := jwt.WithAllowFutureIssuedAt()
+		if !assert.NoError(t, token.Verify(clock, allowIat), "iat after exp should be accepted by default") {
+			return
+		}
+		if !assert.Equal(t, jwt.ErrInconsistentClaims, token.Verify(clock, allowIat, jwt.WithClaimConsistencyCheck()), "iat after exp should be rejected") {
+			return
+		}
+
+		token = jwt.New()
+		token.Set(jwt.ExpirationKey, now.Add(-1*time.Hour))
+		token.Set(jwt.NotBeforeKey, now)
+		if !assert.Equal(t, jwt.ErrInconsistentClaims, token.Verify(clock, jwt.WithExpiredOK(), jwt.WithClaimConsistencyCheck()), "nbf after exp should be rejected") {
+			return
+		}
+
+		token = jwt.New()
+		token.Set(jwt.NotBeforeKey, now.Add(-1*time.Hour))
+		token.Set(jwt.IssuedAtKey, now.Add(-1*time.Hour))
+		if !assert.NoError(t, token.Verify(clock, jwt.WithClaimConsistencyCheck()), "tokens without exp should pass") {
+			return
+		}
+		token.Set(jwt.ExpirationKey, now.Add(time.Hour))
+		if !assert.NoError(t, token.Verify(clock, jwt.WithClaimConsistencyCheck()), "consistent claims should pass") {
+			return
+		}
+	})
+	t.Run("required claims", func(t *testing.T) {
+		token := jwt.New()
+		token.Set(jwt.SubjectKey, "")
+		token.Set("scope", "read")
+
+		if !assert.NoError(t, token.Verify(jwt.WithRequiredClaims(jwt.SubjectKey, "scope")), "present claims should pass regardless of value") {
+			return
+		}
+
+		err := token.Verify(jwt.WithRequiredClaims(jwt.SubjectKey), jwt.WithRequiredClaims(jwt.IssuerKey, "role"))
+		if !assert.Equal(t, jwt.ErrMissingRequiredClaim, errors.Cause(err), "missing claim should fail with ErrMissingRequiredClaim") {
+			return
+		}
+		if !assert.Contains(t, err.Error(), `"iss"`, "error should name the first missing claim") {
+			return
+		}
+	})
+	t.Run(jwt.AudienceKey+" groups", func(t *testing.T) {
+		token := jwt.New()
+		token.Set(jwt.AudienceKey, []string{"api", "billing"})
+
+		if !assert.NoError(t, token.Verify(jwt.WithAudienceOneOf([]string{"api", "admin"}, []string{"billing", "api"})), "second group should match") {
+			return
+		}
+
+		err := token.Verify(jwt.WithAudienceOneOf([]string{"api", "admin"}, []string{"reports"}))
+		if !assert.Error(t, err, "no group should match") {
+			return
+		}
+		if !assert.Contains(t, err.Error(), `missing ["admin"]`, "error should describe the first group") {
+			return
+		}
+		if !assert.Contains(t, err.Error(), `missing ["reports"]`, "error should describe the second group") {
+			return
+		}
+
+		if !assert.NoError(t, token.Verify(jwt.WithAudienceOneOf([]string{"api", "admin"}), jwt.WithAudienceGroupIntersect()), "intersecting group should match") {
+			return
+		}
+		if !assert.Error(t, token.Verify(jwt.WithAudienceOneOf([]string{"admin"}, []string{}), jwt.WithAudienceGroupIntersect()), "disjoint groups should not match") {
+			return
+		}
+	})
 }
 
 const aLongLongTimeAgo = 233431200
@@ -353,7 +531,8 @@ func TestGet(t *testing.T) {
 			Title: `Get IssuedAt`,
 			Test: func(t *testing.T, token *jwt.Token) {
 				expected := time.Unix(aLongLongTimeAgo, 0).UTC()
-				if !assert.Equal(t, expected, token.IssuedAt(), `IssuedAt should match`) {
+				iat, _ := token.IssuedAt()
+				if !assert.Equal(t, expected, iat, `IssuedAt should match`) {
 					return
 				}
 			},
@@ -396,3 +575,521 @@ func TestGH52(t *testing.T) {
 		}
 	}
 }
+
+func TestCanonicalPayload(t *testing.T) {
+	key := []byte("secret")
+	testcases := []struct {
+		Payload   string
+		Canonical bool
+	}{
+		{Payload: `{"iss":"joe","sub":"foo"}`, Canonical: true},
+		{Payload: `{"sub":"foo","iss":"joe"}`, Canonical: false},
+		{Payload: `{"iss": "joe","sub":"foo"}`, Canonical: false},
+		{Payload: `{"aud":["a","b"],"exp":1300819380,"iss":"<joe>"}`, Canonical: true},
+	}
+
+	for _, tc := range testcases {
+		signed, err := jws.Sign([]byte(tc.Payload), jwa.HS256, key)
+		if !assert.NoError(t, err, "jws.Sign should succeed") {
+			return
+		}
+
+		if _, err := jwt.ParseBytes(signed, jwt.WithVerify(jwa.HS256, key)); !assert.NoError(t, err, "jwt.Parse without WithCanonicalPayload should succeed") {
+			return
+		}
+
+		_, err = jwt.ParseBytes(signed, jwt.WithVerify(jwa.HS256, key), jwt.WithCanonicalPayload())
+		if tc.Canonical {
+			if !assert.NoError(t, err, "jwt.Parse should succeed for "+tc.Payload) {
+				return
+			}
+		} else {
+			if !assert.Error(t, err, "jwt.Parse should fail for "+tc.Payload) {
+				return
+			}
+		}
+	}
+}
+
+func TestStrictBase64(t *testing.T) {
+	key := []byte("secret")
+	signed, err := jws.Sign([]byte(`{"iss":"joe"}`), jwa.HS256, key)
+	if !assert.NoError(t, err, "jws.Sign should succeed") {
+		return
+	}
+
+	// Setting one of the unused bits of the last character yields a
+	// different encoding of the same signature
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	last := strings.IndexByte(alphabet, signed[len(signed)-1])
+	tampered := append(append([]byte(nil), signed[:len(signed)-1]...), alphabet[last|1])
+
+	if _, err := jwt.ParseBytes(tampered, jwt.WithVerify(jwa.HS256, key)); !assert.NoError(t, err, "jwt.Parse should accept non-canonical encodings by default") {
+		return
+	}
+
+	_, err = jwt.ParseBytes(tampered, jwt.WithVerify(jwa.HS256, key), jwt.WithStrictBase64())
+	if !assert.Equal(t, jws.ErrNonCanonicalBase64, errors.Cause(err), "jwt.Parse should fail with ErrNonCanonicalBase64") {
+		return
+	}
+
+	_, err = jwt.ParseBytes(tampered, jwt.WithStrictBase64())
+	if !assert.Equal(t, jws.ErrNonCanonicalBase64, errors.Cause(err), "jwt.Parse without verification should fail with ErrNonCanonicalBase64") {
+		return
+	}
+
+	_, err = jwt.ParseVerify(bytes.NewReader(tampered), jwa.HS256, key, jwt.WithStrictBase64())
+	if !assert.Equal(t, jws.ErrNonCanonicalBase64, errors.Cause(err), "jwt.ParseVerify should fail with ErrNonCanonicalBase64") {
+		return
+	}
+}
+
+func TestClone(t *testing.T) {
+	src := []byte(`{"aud":["a","b"],"exp":1500000000,"iss":"issuer","sub":"subject","nested":{"list":[1,2,{"k":"v"}]}}`)
+
+	var t1 jwt.Token
+	if !assert.NoError(t, json.Unmarshal(src, &t1), `json.Unmarshal should succeed`) {
+		return
+	}
+
+	t2 := t1.Clone()
+	if !assert.Equal(t, &t1, t2, `clone should be equal to the original`) {
+		return
+	}
+
+	t2.Set(jwt.IssuerKey, `other`)
+	t2.Set(jwt.ExpirationKey, time.Unix(1600000000, 0))
+	v, _ := t2.Get(`nested`)
+	v.(map[string]interface{})[`list`].([]interface{})[2].(map[string]interface{})[`k`] = `modified`
+
+	iss, _ := t1.Issuer()
+	assert.Equal(t, `issuer`, iss, `original issuer should be untouched`)
+	exp, _ := t1.Expiration()
+	assert.Equal(t, int64(1500000000), exp.Unix(), `original expiration should be untouched`)
+	orig, _ := t1.Get(`nested`)
+	assert.Equal(t, `v`, orig.(map[string]interface{})[`list`].([]interface{})[2].(map[string]interface{})[`k`], `original nested claim should be untouched`)
+}
+
+func TestTypedGetters(t *testing.T) {
+	src := `{"iss":"issuer","exp":1500000000,"aud":["a","b"],"str":"foo","int":42,"frac":1.5,"bool":true,"list":["x","y"],"mixed":["x",1],"when":1600000000,"huge":9223372036854775808,"min":-9223372036854775808}`
+
+	var token jwt.Token
+	if !assert.NoError(t, json.Unmarshal([]byte(src), &token), "json.Unmarshal should succeed") {
+		return
+	}
+
+	s, err := token.GetString("str")
+	if assert.NoError(t, err, "GetString should succeed") {
+		assert.Equal(t, "foo", s, "GetString should return the claim")
+	}
+	s, err = token.GetString(jwt.IssuerKey)
+	if assert.NoError(t, err, "GetString should succeed for iss") {
+		assert.Equal(t, "issuer", s, "GetString should return iss")
+	}
+	_, err = token.GetString("int")
+	assert.Error(t, err, "GetString should fail for numbers")
+	_, err = token.GetString("missing")
+	assert.Error(t, err, "GetString should fail for missing claims")
+
+	i, err := token.GetInt64("int")
+	if assert.NoError(t, err, "GetInt64 should succeed") {
+		assert.Equal(t, int64(42), i, "GetInt64 should return the claim")
+	}
+	_, err = token.GetInt64("frac")
+	assert.Error(t, err, "GetInt64 should fail for fractional numbers")
+	_, err = token.GetInt64("huge")
+	assert.Error(t, err, "GetInt64 should fail for numbers larger than math.MaxInt64")
+	i, err = token.GetInt64("min")
+	if assert.NoError(t, err, "GetInt64 should succeed for math.MinInt64") {
+		assert.Equal(t, int64(math.MinInt64), i, "GetInt64 should return the claim")
+	}
+
+	b, err := token.GetBool("bool")
+	if assert.NoError(t, err, "GetBool should succeed") {
+		assert.True(t, b, "GetBool should return the claim")
+	}
+	_, err = token.GetBool("str")
+	assert.Error(t, err, "GetBool should fail for strings")
+
+	l, err := token.GetStringSlice("list")
+	if assert.NoError(t, err, "GetStringSlice should succeed") {
+		assert.Equal(t, []string{"x", "y"}, l, "GetStringSlice should return the claim")
+	}
+	l, err = token.GetStringSlice(jwt.AudienceKey)
+	if assert.NoError(t, err, "GetStringSlice should succeed for aud") {
+		assert.Equal(t, []string{"a", "b"}, l, "GetStringSlice should return aud")
+	}
+	_, err = token.GetStringSlice("mixed")
+	assert.Error(t, err, "GetStringSlice should fail for mixed lists")
+
+	tm, err := token.GetTime("when")
+	if assert.NoError(t, err, "GetTime should succeed") {
+		assert.Equal(t, int64(1600000000), tm.Unix(), "GetTime should return the claim")
+	}
+	tm, err = token.GetTime(jwt.ExpirationKey)
+	if assert.NoError(t, err, "GetTime should succeed for exp") {
+		assert.Equal(t, int64(1500000000), tm.Unix(), "GetTime should return exp")
+	}
+	_, err = token.GetTime("str")
+	assert.Error(t, err, "GetTime should fail for strings")
+}
+
+func TestClaimGetters(t *testing.T) {
+	src := `{"iss":"issuer","sub":"","aud":["a","b"],"exp":1500000000,"nbf":1400000000,"jti":"id"}`
+
+	var token jwt.Token
+	if !assert.NoError(t, json.Unmarshal([]byte(src), &token), "json.Unmarshal should succeed") {
+		return
+	}
+
+	iss, ok := token.Issuer()
+	assert.True(t, ok, "iss should be present")
+	assert.Equal(t, "issuer", iss, "Issuer should return the claim")
+
+	sub, ok := token.Subject()
+	assert.True(t, ok, "empty sub should be present")
+	assert.Equal(t, "", sub, "Subject should return the claim")
+
+	aud, ok := token.Audience()
+	assert.True(t, ok, "aud should be present")
+	assert.Equal(t, []string{"a", "b"}, aud, "Audience should return the claim")
+
+	exp, ok := token.Expiration()
+	assert.True(t, ok, "exp should be present")
+	assert.Equal(t, int64(1500000000), exp.Unix(), "Expiration should return the claim")
+
+	nbf, ok := token.NotBefore()
+	assert.True(t, ok, "nbf should be present")
+	assert.Equal(t, int64(1400000000), nbf.Unix(), "NotBefore should return the claim")
+
+	jti, ok := token.JWTID()
+	assert.True(t, ok, "jti should be present")
+	assert.Equal(t, "id", jti, "JWTID should return the claim")
+
+	iat, ok := token.IssuedAt()
+	assert.False(t, ok, "iat should be absent")
+	assert.True(t, iat.IsZero(), "IssuedAt should return the zero value")
+
+	_, ok = jwt.New().Audience()
+	assert.False(t, ok, "aud should be absent")
+}
+
+func TestSignType(t *testing.T) {
+	key := []byte("secret")
+	t1 := jwt.New()
+	t1.Set(jwt.SubjectKey, "lestrrat")
+
+	typeOf := func(t *testing.T, signed []byte) string {
+		m, err := jws.Parse(bytes.NewReader(signed))
+		if !assert.NoError(t, err, "jws.Parse should succeed") {
+			return "<error>"
+		}
+		return m.Signatures()[0].ProtectedHeaders().Type()
+	}
+
+	signed, err := t1.Sign(jwa.HS256, key)
+	if assert.NoError(t, err, "Sign should succeed") {
+		assert.Equal(t, jwt.DefaultType, typeOf(t, signed), "typ should default to JWT")
+	}
+
+	signed, err = t1.Sign(jwa.HS256, key, jwt.WithType("at+jwt"))
+	if assert.NoError(t, err, "Sign should succeed") {
+		assert.Equal(t, "at+jwt", typeOf(t, signed), "typ should be overridden")
+	}
+
+	signed, err = t1.Sign(jwa.HS256, key, jwt.WithType(""))
+	if assert.NoError(t, err, "Sign should succeed") {
+		assert.Empty(t, typeOf(t, signed), "typ should be omitted")
+	}
+
+	// The generic JWS helper does not assume JWT
+	signed, err = jws.Sign([]byte("Lorem ipsum"), jwa.HS256, key)
+	if assert.NoError(t, err, "jws.Sign should succeed") {
+		assert.Empty(t, typeOf(t, signed), "typ should not be set by jws.Sign")
+	}
+
+	encrypted, err := t1.Encrypt(jwa.A128KW, []byte("Lorem ipsum dolo"), jwa.A128GCM)
+	if !assert.NoError(t, err, "Encrypt should succeed") {
+		return
+	}
+	msg, err := jwe.Parse(encrypted)
+	if !assert.NoError(t, err, "jwe.Parse should succeed") {
+		return
+	}
+	// The compact serialization places typ in the per-recipient header
+	assert.Equal(t, jwt.DefaultType, msg.Recipients[0].Header.Type, "typ should default to JWT")
+
+	decrypted, err := msg.Decrypt(jwa.A128KW, []byte("Lorem ipsum dolo"))
+	if !assert.NoError(t, err, "Decrypt should succeed") {
+		return
+	}
+	t2 := jwt.New()
+	if !assert.NoError(t, json.Unmarshal(decrypted, t2), "json.Unmarshal should succeed") {
+		return
+	}
+	assert.Equal(t, t1, t2, "tokens should match")
+}
+
+func TestEncryptOptions(t *testing.T) {
+	encKey := []byte("Lorem ipsum dolo")
+	signKey := []byte("secret")
+
+	var calls int
+	factory := func(key []byte) (cipher.AEAD, error) {
+		calls++
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	}
+
+	t1 := jwt.New()
+	t1.Set(jwt.SubjectKey, "lestrrat")
+	if _, err := t1.Encrypt(jwa.A128KW, encKey, jwa.A128GCM, jwe.WithAEADFactory(factory)); !assert.NoError(t, err, "Encrypt should succeed") {
+		return
+	}
+	if !assert.Equal(t, 1, calls, "Encrypt should pass options to jwe") {
+		return
+	}
+
+	if _, err := jwt.EncryptedThenSigned([]byte("Lorem ipsum"), jwa.A128KW, encKey, jwa.A128GCM, jwa.HS256, signKey, jwe.WithAEADFactory(factory)); !assert.NoError(t, err, "EncryptedThenSigned should succeed") {
+		return
+	}
+	if !assert.Equal(t, 2, calls, "EncryptedThenSigned should pass options to jwe") {
+		return
+	}
+
+	if _, err := jwt.SignedThenEncrypted([]byte("Lorem ipsum"), jwa.HS256, signKey, nil, jwa.A128KW, encKey, jwa.A128GCM, nil, jwe.WithAEADFactory(factory)); !assert.NoError(t, err, "SignedThenEncrypted should succeed") {
+		return
+	}
+	assert.Equal(t, 3, calls, "SignedThenEncrypted should pass options to jwe")
+}
+
+func TestEncryptedThenSigned(t *testing.T) {
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, "ecdsa.GenerateKey should succeed") {
+		return
+	}
+	encKey := []byte("Lorem ipsum dolo")
+	payload := []byte(`{"sub":"lestrrat"}`)
+
+	signed, err := jwt.EncryptedThenSigned(payload, jwa.A128KW, encKey, jwa.A128GCM, jwa.ES256, signKey)
+	if !assert.NoError(t, err, "EncryptedThenSigned should succeed") {
+		return
+	}
+
+	m, err := jws.Parse(bytes.NewReader(signed))
+	if !assert.NoError(t, err, "jws.Parse should succeed") {
+		return
+	}
+	assert.Equal(t, jwt.ContentTypeJWE, m.Signatures()[0].ProtectedHeaders().ContentType(), "cty should be JWE")
+
+	t.Run("Success", func(t *testing.T) {
+		decrypted, err := jwt.VerifyThenDecrypt(signed, jwa.ES256, &signKey.PublicKey, jwa.A128KW, encKey)
+		if !assert.NoError(t, err, "VerifyThenDecrypt should succeed") {
+			return
+		}
+		assert.Equal(t, payload, decrypted, "payload should match")
+	})
+	t.Run("Bad signature", func(t *testing.T) {
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if !assert.NoError(t, err, "ecdsa.GenerateKey should succeed") {
+			return
+		}
+		_, err = jwt.VerifyThenDecrypt(signed, jwa.ES256, &otherKey.PublicKey, jwa.A128KW, encKey)
+		assertNestedError(t, err, jwt.ErrOuterSignature)
+	})
+	t.Run("Bad decryption key", func(t *testing.T) {
+		_, err := jwt.VerifyThenDecrypt(signed, jwa.ES256, &signKey.PublicKey, jwa.A128KW, []byte("dolor sit amet!!"))
+		assertNestedError(t, err, jwt.ErrInnerDecrypt)
+	})
+	t.Run("Missing cty", func(t *testing.T) {
+		encrypted, err := jwe.Encrypt(payload, jwa.A128KW, encKey, jwa.A128GCM, jwa.NoCompress)
+		if !assert.NoError(t, err, "jwe.Encrypt should succeed") {
+			return
+		}
+		signed, err := jws.Sign(encrypted, jwa.ES256, signKey)
+		if !assert.NoError(t, err, "jws.Sign should succeed") {
+			return
+		}
+		_, err = jwt.VerifyThenDecrypt(signed, jwa.ES256, &signKey.PublicKey, jwa.A128KW, encKey)
+		assert.Error(t, err, "VerifyThenDecrypt should fail")
+	})
+}
+
+func assertNestedError(t *testing.T, err error, layer error) {
+	nerr, ok := err.(*jwt.NestedError)
+	if !assert.True(t, ok, "error should be a NestedError") {
+		return
+	}
+	if !assert.Equal(t, layer, nerr.Layer, "Layer should match") {
+		return
+	}
+	if !assert.Error(t, nerr.Err, "the underlying error should be kept") {
+		return
+	}
+	if !assert.True(t, nerr.Is(layer), "Is should match the layer") {
+		return
+	}
+	assert.Equal(t, errors.Cause(nerr.Err), errors.Cause(err), "errors.Cause should return the underlying error")
+}
+
+func TestSignedThenEncrypted(t *testing.T) {
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, "ecdsa.GenerateKey should succeed") {
+		return
+	}
+	encKey := []byte("Lorem ipsum dolo")
+	payload := []byte(`{"sub":"lestrrat"}`)
+
+	var shdr jws.StandardHeaders
+	shdr.Set(jws.KeyIDKey, "signing-key")
+	shdr.Set(jws.TypeKey, "at+jwt")
+	ehdr := jwe.NewHeader()
+	ehdr.Set(`kid`, "encryption-key")
+
+	encrypted, err := jwt.SignedThenEncrypted(payload, jwa.ES256, signKey, &shdr, jwa.A128KW, encKey, jwa.A128GCM, ehdr)
+	if !assert.NoError(t, err, "SignedThenEncrypted should succeed") {
+		return
+	}
+	_, ok := shdr.Get(jws.AlgorithmKey)
+	assert.False(t, ok, "signature template should not be modified")
+	assert.Empty(t, ehdr.ContentType, "encryption template should not be modified")
+
+	t.Run("Success", func(t *testing.T) {
+		nested, err := jwt.DecryptThenVerify(encrypted, jwa.A128KW, encKey, jwa.ES256, &signKey.PublicKey)
+		if !assert.NoError(t, err, "DecryptThenVerify should succeed") {
+			return
+		}
+		assert.Equal(t, payload, nested.Payload, "payload should match")
+		assert.Equal(t, "signing-key", nested.SignatureHeaders.KeyID(), "inner kid should match")
+		assert.Equal(t, "at+jwt", nested.SignatureHeaders.Type(), "inner typ should match")
+		assert.Equal(t, jwa.ES256, nested.SignatureHeaders.Algorithm(), "inner alg should match")
+		assert.Equal(t, "encryption-key", nested.EncryptionHeaders.KeyID, "outer kid should match")
+		assert.Equal(t, jwt.ContentTypeJWT, nested.EncryptionHeaders.ContentType, "outer cty should be JWT")
+		assert.Equal(t, jwa.A128GCM, nested.EncryptionHeaders.ContentEncryption, "outer enc should match")
+	})
+	t.Run("Bad decryption key", func(t *testing.T) {
+		_, err := jwt.DecryptThenVerify(encrypted, jwa.A128KW, []byte("dolor sit amet!!"), jwa.ES256, &signKey.PublicKey)
+		assertNestedError(t, err, jwt.ErrOuterDecrypt)
+	})
+	t.Run("Bad signature", func(t *testing.T) {
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if !assert.NoError(t, err, "ecdsa.GenerateKey should succeed") {
+			return
+		}
+		_, err = jwt.DecryptThenVerify(encrypted, jwa.A128KW, encKey, jwa.ES256, &otherKey.PublicKey)
+		assertNestedError(t, err, jwt.ErrInnerSignature)
+	})
+	t.Run("Conflicting templates", func(t *testing.T) {
+		var shdr jws.StandardHeaders
+		shdr.Set(jws.AlgorithmKey, jwa.RS256)
+		_, err := jwt.SignedThenEncrypted(payload, jwa.ES256, signKey, &shdr, jwa.A128KW, encKey, jwa.A128GCM, nil)
+		assert.Error(t, err, "mismatched alg should be rejected")
+
+		ehdr := jwe.NewHeader()
+		ehdr.Set(`enc`, jwa.A256GCM)
+		_, err = jwt.SignedThenEncrypted(payload, jwa.ES256, signKey, nil, jwa.A128KW, encKey, jwa.A128GCM, ehdr)
+		assert.Error(t, err, "mismatched enc should be rejected")
+
+		ehdr = jwe.NewHeader()
+		ehdr.Set(`cty`, "JWE")
+		_, err = jwt.SignedThenEncrypted(payload, jwa.ES256, signKey, nil, jwa.A128KW, encKey, jwa.A128GCM, ehdr)
+		assert.Error(t, err, "cty other than JWT should be rejected")
+	})
+	t.Run("Missing cty", func(t *testing.T) {
+		signed, err := jws.Sign(payload, jwa.ES256, signKey)
+		if !assert.NoError(t, err, "jws.Sign should succeed") {
+			return
+		}
+		encrypted, err := jwe.Encrypt(signed, jwa.A128KW, encKey, jwa.A128GCM, jwa.NoCompress)
+		if !assert.NoError(t, err, "jwe.Encrypt should succeed") {
+			return
+		}
+		_, err = jwt.DecryptThenVerify(encrypted, jwa.A128KW, encKey, jwa.ES256, &signKey.PublicKey)
+		assert.Error(t, err, "DecryptThenVerify should fail")
+	})
+}
+
+func TestIssuerVerifier(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, "ecdsa.GenerateKey should succeed") {
+		return
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, "ecdsa.GenerateKey should succeed") {
+		return
+	}
+
+	var keys []jwk.Key
+	for kid, k := range map[string]*ecdsa.PrivateKey{"key1": key, "key2": otherKey} {
+		pubkey, err := jwk.New(&k.PublicKey)
+		if !assert.NoError(t, err, "jwk.New should succeed") {
+			return
+		}
+		if !assert.NoError(t, pubkey.Set(jwk.KeyIDKey, kid), "Set should succeed") {
+			return
+		}
+		keys = append(keys, pubkey)
+	}
+	jwks, err := json.Marshal(jwk.Set{Keys: keys})
+	if !assert.NoError(t, err, "json.Marshal should succeed") {
+		return
+	}
+
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Write(jwks)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	v := jwt.NewIssuerVerifier(ctx, map[string]string{"https://issuer.example.com": srv.URL})
+
+	sign := func(iss, kid string, k *ecdsa.PrivateKey) []byte {
+		var hdr jws.StandardHeaders
+		hdr.Set(jws.KeyIDKey, kid)
+		signed, err := jws.Sign([]byte(`{"iss":"`+iss+`","sub":"lestrrat"}`), jwa.ES256, k, jws.WithHeaders(&hdr))
+		if !assert.NoError(t, err, "jws.Sign should succeed") {
+			t.FailNow()
+		}
+		return signed
+	}
+
+	t.Run("Unknown issuer", func(t *testing.T) {
+		signed := sign("https://evil.example.com", "key1", key)
+		iss, err := jwt.PeekIssuer(signed)
+		if !assert.NoError(t, err, "PeekIssuer should succeed") {
+			return
+		}
+		assert.Equal(t, "https://evil.example.com", iss, "PeekIssuer should return the issuer")
+
+		_, err = v.Verify(ctx, signed)
+		assert.Equal(t, jwt.ErrUnknownIssuer, errors.Cause(err), "Verify should fail with ErrUnknownIssuer")
+		assert.Equal(t, int32(0), atomic.LoadInt32(&fetches), "JWK set should not be fetched")
+	})
+	t.Run("Success", func(t *testing.T) {
+		token, err := v.Verify(ctx, sign("https://issuer.example.com", "key1", key))
+		if !assert.NoError(t, err, "Verify should succeed") {
+			return
+		}
+		sub, _ := token.Subject()
+		assert.Equal(t, "lestrrat", sub, "subject should match")
+
+		_, err = v.Verify(ctx, sign("https://issuer.example.com", "key2", otherKey))
+		assert.NoError(t, err, "Verify should succeed")
+		assert.Equal(t, int32(1), atomic.LoadInt32(&fetches), "JWK set should be fetched once")
+	})
+	t.Run("Mismatched kid", func(t *testing.T) {
+		_, err := v.Verify(ctx, sign("https://issuer.example.com", "key2", key))
+		assert.Error(t, err, "Verify should fail")
+	})
+	t.Run("Unknown kid", func(t *testing.T) {
+		_, err := v.Verify(ctx, sign("https://issuer.example.com", "key3", key))
+		assert.Error(t, err, "Verify should fail")
+	})
+}
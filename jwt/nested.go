@@ -0,0 +1,288 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/pkg/errors"
+)
+
+// ContentTypeJWE is the value of the "cty" header of a JWS whose
+// payload is a JWE message
+const ContentTypeJWE = `JWE`
+
+// ContentTypeJWT is the value of the "cty" header of a JWE whose
+// payload is a signed JWT
+const ContentTypeJWT = `JWT`
+
+// Layers of a nested token, reported by the Layer field of the
+// NestedError returned by VerifyThenDecrypt and DecryptThenVerify, so
+// that the caller may tell which layer of the nested token was rejected.
+var (
+	ErrOuterSignature = errors.New(`outer signature invalid`)
+	ErrInnerDecrypt   = errors.New(`inner decryption failed`)
+	ErrOuterDecrypt   = errors.New(`outer decryption failed`)
+	ErrInnerSignature = errors.New(`inner signature invalid`)
+)
+
+// NestedError is returned when one of the layers of a nested token is
+// rejected. Layer is one of ErrOuterSignature, ErrInnerDecrypt,
+// ErrOuterDecrypt, or ErrInnerSignature, and Err is the error that
+// caused the layer to be rejected. errors.Is from the standard library
+// reports true for both.
+type NestedError struct {
+	Layer error
+	Err   error
+}
+
+// Error returns the string representation of the error
+func (e *NestedError) Error() string {
+	return e.Layer.Error() + `: ` + e.Err.Error()
+}
+
+// Is reports whether target is the layer that was rejected
+func (e *NestedError) Is(target error) bool {
+	return target == e.Layer
+}
+
+// Unwrap returns the underlying error
+func (e *NestedError) Unwrap() error {
+	return e.Err
+}
+
+// Cause returns the underlying error, so that errors.Cause from
+// github.com/pkg/errors works
+func (e *NestedError) Cause() error {
+	return e.Err
+}
+
+// NestedToken is the result of DecryptThenVerify. It holds the payload
+// of the inner signature, along with the protected headers of both
+// layers.
+type NestedToken struct {
+	Payload           []byte
+	SignatureHeaders  jws.Headers
+	EncryptionHeaders *jwe.Header
+}
+
+// EncryptedThenSigned encrypts the payload using the key encryption
+// algorithm `keyalg` and `encKey`, and signs the resulting compact JWE
+// message using the signature algorithm `sigalg` and `signKey`. The
+// "cty" header of the signature is set to "JWE". The options are passed
+// to jwe.Encrypt.
+func EncryptedThenSigned(payload []byte, keyalg jwa.KeyEncryptionAlgorithm, encKey interface{}, contentalg jwa.ContentEncryptionAlgorithm, sigalg jwa.SignatureAlgorithm, signKey interface{}, options ...jwe.Option) ([]byte, error) {
+	encrypted, err := jwe.Encrypt(payload, keyalg, encKey, contentalg, jwa.NoCompress, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to encrypt payload`)
+	}
+
+	var hdr jws.StandardHeaders
+	hdr.Set(jws.ContentTypeKey, ContentTypeJWE)
+	signed, err := jws.Sign(encrypted, sigalg, signKey, jws.WithHeaders(&hdr))
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to sign encrypted payload`)
+	}
+	return signed, nil
+}
+
+// VerifyThenDecrypt verifies the signature of a JWS message whose payload
+// is a JWE message, as produced by EncryptedThenSigned, and returns the
+// decrypted inner payload.
+//
+// The "cty" header of every signature must be "JWE". If the signature
+// can not be verified, the returned error is a *NestedError whose Layer
+// is ErrOuterSignature. If the inner message can not be decrypted, its
+// Layer is ErrInnerDecrypt.
+func VerifyThenDecrypt(buf []byte, sigalg jwa.SignatureAlgorithm, verifyKey interface{}, keyalg jwa.KeyEncryptionAlgorithm, decryptKey interface{}, options ...jwe.Option) ([]byte, error) {
+	encrypted, err := jws.Verify(buf, sigalg, verifyKey)
+	if err != nil {
+		return nil, &NestedError{Layer: ErrOuterSignature, Err: err}
+	}
+
+	// Only look at the headers once the signature has been verified
+	m, err := jws.Parse(bytes.NewReader(buf))
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to parse message`)
+	}
+	for _, sig := range m.Signatures() {
+		h := sig.ProtectedHeaders()
+		if h == nil || !strings.EqualFold(h.ContentType(), ContentTypeJWE) {
+			return nil, errors.Errorf(`expected "cty" to be %q`, ContentTypeJWE)
+		}
+	}
+
+	payload, err := jwe.Decrypt(encrypted, keyalg, decryptKey, options...)
+	if err != nil {
+		return nil, &NestedError{Layer: ErrInnerDecrypt, Err: err}
+	}
+	return payload, nil
+}
+
+// SignedThenEncrypted signs the payload using the signature algorithm
+// `sigalg` and `signKey`, and encrypts the resulting compact JWS message
+// using the key encryption algorithm `keyalg` and `encKey`.
+//
+// `signHeaders` and `encHeaders` are optional templates for the
+// protected headers of the inner signature and the outer encryption.
+// They are copied, not modified. The "alg" (and "enc") parameters of
+// the templates must be empty or agree with the given algorithms, and
+// the "cty" parameter of `encHeaders` must be empty or "JWT". The "cty"
+// header of the encryption is always set to "JWT". The options are
+// passed to jwe.EncryptWithHeader.
+func SignedThenEncrypted(payload []byte, sigalg jwa.SignatureAlgorithm, signKey interface{}, signHeaders jws.Headers, keyalg jwa.KeyEncryptionAlgorithm, encKey interface{}, contentalg jwa.ContentEncryptionAlgorithm, encHeaders *jwe.Header, options ...jwe.Option) ([]byte, error) {
+	shdr, err := signatureHeaders(sigalg, signHeaders)
+	if err != nil {
+		return nil, errors.Wrap(err, `invalid signature headers`)
+	}
+	ehdr, err := encryptionHeaders(keyalg, contentalg, encHeaders)
+	if err != nil {
+		return nil, errors.Wrap(err, `invalid encryption headers`)
+	}
+
+	signed, err := jws.Sign(payload, sigalg, signKey, jws.WithHeaders(shdr))
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to sign payload`)
+	}
+
+	encrypted, err := jwe.EncryptWithHeader(signed, encKey, ehdr, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to encrypt signed payload`)
+	}
+	return encrypted, nil
+}
+
+func signatureHeaders(alg jwa.SignatureAlgorithm, tmpl jws.Headers) (jws.Headers, error) {
+	hdr := &jws.StandardHeaders{}
+	if tmpl == nil {
+		return hdr, nil
+	}
+
+	if _, ok := tmpl.Get(jws.AlgorithmKey); ok && tmpl.Algorithm() != alg {
+		return nil, errors.Errorf(`"alg" is %q, expected %q`, tmpl.Algorithm(), alg)
+	}
+
+	// Round trip through JSON, so that private parameters are copied
+	// too. "alg" is always marshaled, and is set by jws.Sign anyway
+	buf, err := json.Marshal(tmpl)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to marshal headers`)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return nil, errors.Wrap(err, `failed to unmarshal headers`)
+	}
+	delete(m, jws.AlgorithmKey)
+	for k, v := range m {
+		if err := hdr.Set(k, v); err != nil {
+			return nil, errors.Wrapf(err, `failed to set value for key %s`, k)
+		}
+	}
+	return hdr, nil
+}
+
+func encryptionHeaders(keyalg jwa.KeyEncryptionAlgorithm, contentalg jwa.ContentEncryptionAlgorithm, tmpl *jwe.Header) (*jwe.Header, error) {
+	hdr := jwe.NewHeader()
+	if tmpl != nil {
+		if err := hdr.Copy(tmpl); err != nil {
+			return nil, errors.Wrap(err, `failed to copy headers`)
+		}
+	}
+
+	if hdr.Algorithm != "" && hdr.Algorithm != keyalg {
+		return nil, errors.Errorf(`"alg" is %q, expected %q`, hdr.Algorithm, keyalg)
+	}
+	if hdr.ContentEncryption != "" && hdr.ContentEncryption != contentalg {
+		return nil, errors.Errorf(`"enc" is %q, expected %q`, hdr.ContentEncryption, contentalg)
+	}
+	if hdr.ContentType != "" && !strings.EqualFold(hdr.ContentType, ContentTypeJWT) {
+		return nil, errors.Errorf(`"cty" is %q, expected %q`, hdr.ContentType, ContentTypeJWT)
+	}
+
+	hdr.Algorithm = keyalg
+	hdr.ContentEncryption = contentalg
+	hdr.ContentType = ContentTypeJWT
+	return hdr, nil
+}
+
+// DecryptThenVerify decrypts a JWE message whose payload is a JWS
+// message, as produced by SignedThenEncrypted, verifies the inner
+// signature, and returns the inner payload along with the protected
+// headers of both layers.
+//
+// The "cty" header of the encryption must be "JWT". If the message can
+// not be decrypted, the returned error is a *NestedError whose Layer is
+// ErrOuterDecrypt. If the inner signature can not be verified, its Layer
+// is ErrInnerSignature.
+func DecryptThenVerify(buf []byte, keyalg jwa.KeyEncryptionAlgorithm, decryptKey interface{}, sigalg jwa.SignatureAlgorithm, verifyKey interface{}, options ...jwe.Option) (*NestedToken, error) {
+	m, err := jwe.Parse(buf, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to parse message`)
+	}
+
+	signed, err := m.Decrypt(keyalg, decryptKey, options...)
+	if err != nil {
+		return nil, &NestedError{Layer: ErrOuterDecrypt, Err: err}
+	}
+
+	// Only look at the headers once the message has been decrypted
+	ehdr, err := resolvedHeaders(m)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to resolve encryption headers`)
+	}
+	if !strings.EqualFold(ehdr.ContentType, ContentTypeJWT) {
+		return nil, errors.Errorf(`expected "cty" to be %q`, ContentTypeJWT)
+	}
+
+	payload, err := jws.Verify(signed, sigalg, verifyKey)
+	if err != nil {
+		return nil, &NestedError{Layer: ErrInnerSignature, Err: err}
+	}
+
+	sm, err := jws.Parse(bytes.NewReader(signed))
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to parse signed payload`)
+	}
+	sigs := sm.Signatures()
+	if len(sigs) != 1 {
+		return nil, errors.New(`expected exactly one signature`)
+	}
+
+	return &NestedToken{
+		Payload:           payload,
+		SignatureHeaders:  sigs[0].ProtectedHeaders(),
+		EncryptionHeaders: ehdr,
+	}, nil
+}
+
+// resolvedHeaders merges the protected, shared unprotected, and per
+// recipient headers of a message with a single recipient. In the
+// compact serialization, all of them come from the protected header
+func resolvedHeaders(m *jwe.Message) (*jwe.Header, error) {
+	if len(m.Recipients) != 1 {
+		return nil, errors.New(`expected exactly one recipient`)
+	}
+
+	hdr := jwe.NewHeader()
+	for _, h := range []*jwe.Header{protectedHeader(m), m.UnprotectedHeader, m.Recipients[0].Header} {
+		if h == nil || h.EssentialHeader == nil {
+			continue
+		}
+		merged, err := hdr.Merge(h)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to merge headers`)
+		}
+		hdr = merged
+	}
+	return hdr, nil
+}
+
+func protectedHeader(m *jwe.Message) *jwe.Header {
+	if m.ProtectedHeader == nil {
+		return nil
+	}
+	return m.ProtectedHeader.Header
+}
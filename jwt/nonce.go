@@ -0,0 +1,19 @@
+package jwt
+
+// NonceKey is the name of the "nonce" claim used by OpenID Connect ID
+// tokens to mitigate replay attacks
+// (https://openid.net/specs/openid-connect-core-1_0.html#IDToken)
+const NonceKey = "nonce"
+
+// Nonce returns the value of the "nonce" claim, and whether
+// the claim is present in the token. A claim that is not a string is
+// treated as absent.
+func (t *Token) Nonce() (string, bool) {
+	v, ok := t.privateClaims[NonceKey].(string)
+	return v, ok
+}
+
+// SetNonce sets the "nonce" claim
+func (t *Token) SetNonce(s string) error {
+	return t.Set(NonceKey, s)
+}
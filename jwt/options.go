@@ -8,7 +8,10 @@ import (
 type Option = option.Interface
 
 const (
-	optkeyVerify = `verify`
+	optkeyVerify           = `verify`
+	optkeyCanonicalPayload = `canonical-payload`
+	optkeyType             = `type`
+	optkeyStrictBase64     = `strict-base64`
 )
 
 type VerifyParameters interface {
@@ -35,3 +38,23 @@ func WithVerify(alg jwa.SignatureAlgorithm, key interface{}) Option {
 		key: key,
 	})
 }
+
+// WithCanonicalPayload specifies that the payload must be in canonical
+// JSON form (sorted keys, no insignificant whitespace). This is useful
+// when the payload is hashed, and a stable representation is required.
+func WithCanonicalPayload() Option {
+	return option.New(optkeyCanonicalPayload, true)
+}
+
+// WithType specifies the value of the "typ" header set by Token.Sign
+// and Token.Encrypt. Specify an empty string to omit the header.
+func WithType(typ string) Option {
+	return option.New(optkeyType, typ)
+}
+
+// WithStrictBase64 specifies that Parse and ParseVerify must reject
+// tokens whose segments are not canonically base64url encoded. See
+// jws.WithStrictBase64 for details.
+func WithStrictBase64() Option {
+	return option.New(optkeyStrictBase64, true)
+}
@@ -23,6 +23,9 @@ const (
 // methods but their types are not taken into consideration at all. If you have non-standard
 // claims that you must frequently access, consider wrapping the token in a wrapper
 // by embedding the jwt.Token type in it
+//
+// A Token is not safe for concurrent mutation. If a token needs to be
+// shared across goroutines, hand out independent copies using `Clone`
 type Token struct {
 	audience      stringList   // https://tools.ietf.org/html/rfc7519#section-4.1.3
 	expiration    *NumericDate // https://tools.ietf.org/html/rfc7519#section-4.1.4
@@ -192,58 +195,65 @@ func (t Token) MarshalJSON() ([]byte, error) {
 	return json.Marshal(m)
 }
 
-func (t Token) Audience() string {
-	if v, ok := t.Get(AudienceKey); ok {
-		return (v.(stringList))[0]
+// Audience returns the value of the "aud" claim, and whether
+// the claim is present in the token
+func (t *Token) Audience() ([]string, bool) {
+	if len(t.audience) == 0 {
+		return nil, false
 	}
-	return ""
+	return append([]string(nil), t.audience...), true
 }
 
-func (t Token) Expiration() time.Time {
-	return timeFromNumericDateClaim(&t, ExpirationKey)
-}
-
-func (t Token) IssuedAt() time.Time {
-	return timeFromNumericDateClaim(&t, IssuedAtKey)
-}
-
-func (t Token) Issuer() string {
-	if v, ok := t.Get(IssuerKey); ok {
-		return v.(string)
+// Expiration returns the value of the "exp" claim, and whether
+// the claim is present in the token
+func (t *Token) Expiration() (time.Time, bool) {
+	if t.expiration == nil {
+		return time.Time{}, false
 	}
-	return ""
+	return t.expiration.Time, true
 }
 
-func (t Token) JwtID() string {
-	if v, ok := t.Get(JwtIDKey); ok {
-		return v.(string)
+// IssuedAt returns the value of the "iat" claim, and whether
+// the claim is present in the token
+func (t *Token) IssuedAt() (time.Time, bool) {
+	if t.issuedAt == nil {
+		return time.Time{}, false
 	}
-	return ""
+	return t.issuedAt.Time, true
 }
 
-func (t Token) NotBefore() time.Time {
-	return timeFromNumericDateClaim(&t, NotBeforeKey)
+// Issuer returns the value of the "iss" claim, and whether
+// the claim is present in the token
+func (t *Token) Issuer() (string, bool) {
+	if t.issuer == nil {
+		return "", false
+	}
+	return *(t.issuer), true
 }
 
-func (t Token) Subject() string {
-	if v, ok := t.Get(SubjectKey); ok {
-		return v.(string)
+// JWTID returns the value of the "jti" claim, and whether
+// the claim is present in the token
+func (t *Token) JWTID() (string, bool) {
+	if t.jwtID == nil {
+		return "", false
 	}
-	return ""
+	return *(t.jwtID), true
 }
 
-func timeFromNumericDateClaim(t *Token, key string) time.Time {
-	v, ok := t.Get(key)
-	if !ok {
-		return time.Time{}
+// NotBefore returns the value of the "nbf" claim, and whether
+// the claim is present in the token
+func (t *Token) NotBefore() (time.Time, bool) {
+	if t.notBefore == nil {
+		return time.Time{}, false
 	}
+	return t.notBefore.Time, true
+}
 
-	switch x := v.(type) {
-	case time.Time:
-		return x
-	case *NumericDate:
-		return x.Time
-	default:
-		return time.Time{}
+// Subject returns the value of the "sub" claim, and whether
+// the claim is present in the token
+func (t *Token) Subject() (string, bool) {
+	if t.subject == nil {
+		return "", false
 	}
+	return *(t.subject), true
 }
@@ -1,21 +1,46 @@
 package jwt
 
 import (
-	"errors"
+	"crypto/subtle"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/lestrrat-go/jwx/internal/option"
+	"github.com/pkg/errors"
 )
 
 const (
-	optkeyAcceptableSkew = "acceptableSkew"
-	optkeyClock          = "clock"
-	optkeyIssuer         = "issuer"
-	optkeySubject        = "subject"
-	optkeyAudience       = "audience"
-	optkeyJwtid          = "jwtid"
+	optkeyAcceptableSkew  = "acceptableSkew"
+	optkeyClock           = "clock"
+	optkeyIssuer          = "issuer"
+	optkeySubject         = "subject"
+	optkeyAudience        = "audience"
+	optkeyJwtid           = "jwtid"
+	optkeyRejectFutureIat = "rejectFutureIat"
+	optkeyRequireIat      = "requireIat"
+	optkeyNonce           = "nonce"
+	optkeyAudienceOneOf   = "audienceOneOf"
+	optkeyAudienceAnyOf   = "audienceAnyOf"
+	optkeyExpiredOK       = "expiredOK"
+	optkeyConsistency     = "consistency"
+	optkeyRequiredClaims  = "requiredClaims"
 )
 
+// ErrTokenExpired is returned by Verify when the exp claim is not
+// satisfied. When WithExpiredOK is specified, it is only returned if
+// all the other checks have passed.
+var ErrTokenExpired = errors.New(`exp not satisfied`)
+
+// ErrInconsistentClaims is returned by Verify when WithClaimConsistencyCheck
+// is specified, and the nbf or iat claim is after the exp claim.
+var ErrInconsistentClaims = errors.New(`inconsistent claims`)
+
+// ErrMissingRequiredClaim is returned by Verify when a claim specified
+// with WithRequiredClaims is absent. The error names the first missing
+// claim: use errors.Cause to compare it.
+var ErrMissingRequiredClaim = errors.New(`missing required claim`)
+
 type Clock interface {
 	Now() time.Time
 }
@@ -63,6 +88,91 @@ func WithAudience(s string) Option {
 	return option.New(optkeyAudience, s)
 }
 
+// WithAudienceOneOf specifies groups of acceptable audience values.
+// Verify will succeed if the `aud` element contains every value of at
+// least one of the groups. To accept a token whose `aud` element
+// contains any value of a group instead, also specify
+// WithAudienceGroupIntersect.
+//
+// If none of the groups match, the returned error describes each group
+// and the reason it did not match.
+func WithAudienceOneOf(groups ...[]string) Option {
+	return option.New(optkeyAudienceOneOf, groups)
+}
+
+// WithAudienceGroupIntersect specifies that a group given to
+// WithAudienceOneOf matches when it has at least one value in
+// common with the `aud` element, rather than when all of its values
+// are present.
+func WithAudienceGroupIntersect() Option {
+	return option.New(optkeyAudienceAnyOf, true)
+}
+
+// WithNonce specifies the expected nonce value. Unlike the other
+// claims, a token without a nonce claim fails verification when this
+// option is specified. The values are compared in constant time.
+func WithNonce(s string) Option {
+	return option.New(optkeyNonce, s)
+}
+
+// WithExpiredOK specifies that an expired token should not stop the
+// verification of the other claims. If the token is expired but
+// otherwise valid, Verify returns ErrTokenExpired, which allows
+// the caller to tell an expired token that may be refreshed from
+// one that is invalid altogether:
+//
+//     switch err := token.Verify(jwt.WithExpiredOK(), jwt.WithIssuer(iss)); err {
+//     case nil:
+//       // valid
+//     case jwt.ErrTokenExpired:
+//       // valid, but expired
+//     default:
+//       // invalid
+//     }
+func WithExpiredOK() Option {
+	return option.New(optkeyExpiredOK, true)
+}
+
+// WithRejectFutureIssuedAt specifies that tokens whose iat claim is
+// in the future (taking the acceptable skew into account) should be
+// rejected. Tokens without an iat claim pass this check, unless
+// WithRequireIssuedAt is also specified.
+//
+// This is the default, so the option only serves to override an
+// earlier WithAllowFutureIssuedAt.
+func WithRejectFutureIssuedAt() Option {
+	return option.New(optkeyRejectFutureIat, true)
+}
+
+// WithAllowFutureIssuedAt specifies that tokens whose iat claim is in
+// the future should not be rejected. This may be needed for issuers
+// whose clocks run ahead by more than the acceptable skew, but note
+// that such a token may also have been forged.
+func WithAllowFutureIssuedAt() Option {
+	return option.New(optkeyRejectFutureIat, false)
+}
+
+// WithRequireIssuedAt specifies that the iat claim must be present.
+func WithRequireIssuedAt() Option {
+	return option.New(optkeyRequireIat, true)
+}
+
+// WithClaimConsistencyCheck specifies that tokens whose nbf or iat claim
+// is after their exp claim should be rejected with ErrInconsistentClaims.
+// Such tokens can never be valid, and are likely malformed or forged.
+// The check does not depend on the current time, and only applies when
+// the claims are present.
+func WithClaimConsistencyCheck() Option {
+	return option.New(optkeyConsistency, true)
+}
+
+// WithRequiredClaims specifies the names of claims that must be present,
+// regardless of their values. This option may be specified multiple
+// times, in which case all of the named claims are required.
+func WithRequiredClaims(names ...string) Option {
+	return option.New(optkeyRequiredClaims, names)
+}
+
 // Verify makes sure that the essential claims stand.
 //
 // See the various `WithXXX` functions for optional parameters
@@ -74,6 +184,14 @@ func (t *Token) Verify(options ...Option) error {
 	var jwtid string
 	var clock Clock = ClockFunc(time.Now)
 	var skew time.Duration
+	rejectFutureIat := true
+	var requireIat bool
+	var nonce *string
+	var audienceGroups [][]string
+	var audienceIntersect bool
+	var expiredOK bool
+	var consistency bool
+	var requiredClaims []string
 	for _, o := range options {
 		switch o.Name() {
 		case optkeyClock:
@@ -88,6 +206,30 @@ func (t *Token) Verify(options ...Option) error {
 			audience = o.Value().(string)
 		case optkeyJwtid:
 			jwtid = o.Value().(string)
+		case optkeyRejectFutureIat:
+			rejectFutureIat = o.Value().(bool)
+		case optkeyRequireIat:
+			requireIat = o.Value().(bool)
+		case optkeyNonce:
+			v := o.Value().(string)
+			nonce = &v
+		case optkeyAudienceOneOf:
+			audienceGroups = o.Value().([][]string)
+		case optkeyAudienceAnyOf:
+			audienceIntersect = o.Value().(bool)
+		case optkeyExpiredOK:
+			expiredOK = o.Value().(bool)
+		case optkeyConsistency:
+			consistency = o.Value().(bool)
+		case optkeyRequiredClaims:
+			requiredClaims = append(requiredClaims, o.Value().([]string)...)
+		}
+	}
+
+	// check that the required claims are present
+	for _, name := range requiredClaims {
+		if _, ok := t.Get(name); !ok {
+			return errors.Wrapf(ErrMissingRequiredClaim, `claim %q`, name)
 		}
 	}
 
@@ -112,6 +254,14 @@ func (t *Token) Verify(options ...Option) error {
 		}
 	}
 
+	// check for nonce
+	if nonce != nil {
+		v, ok := t.privateClaims[NonceKey].(string)
+		if !ok || subtle.ConstantTimeCompare([]byte(v), []byte(*nonce)) != 1 {
+			return errors.New(`nonce not satisfied`)
+		}
+	}
+
 	// check for aud
 	if len(audience) > 0 {
 		var found bool
@@ -126,17 +276,39 @@ func (t *Token) Verify(options ...Option) error {
 		}
 	}
 
+	// check for aud against groups
+	if len(audienceGroups) > 0 {
+		if err := t.verifyAudienceGroups(audienceGroups, audienceIntersect); err != nil {
+			return err
+		}
+	}
+
+	// check that nbf and iat are not after exp
+	if consistency {
+		if err := t.verifyConsistency(); err != nil {
+			return err
+		}
+	}
+
 	// check for exp
+	var expired bool
 	if tv := t.expiration; tv != nil {
 		now := clock.Now().Truncate(time.Second)
 		ttv := tv.Time.Truncate(time.Second)
 		if !now.Before(ttv.Add(skew)) {
-			return errors.New(`exp not satisfied`)
+			if !expiredOK {
+				return ErrTokenExpired
+			}
+			// report after the remaining claims have been checked
+			expired = true
 		}
 	}
 
 	// check for iat
-	if tv := t.issuedAt; tv != nil {
+	if requireIat && t.issuedAt == nil {
+		return errors.New(`iat not satisfied: missing`)
+	}
+	if tv := t.issuedAt; rejectFutureIat && tv != nil {
 		now := clock.Now().Truncate(time.Second)
 		ttv := tv.Time.Truncate(time.Second)
 		if now.Before(ttv.Add(-1 * skew)) {
@@ -153,5 +325,60 @@ func (t *Token) Verify(options ...Option) error {
 			return errors.New(`nbf not satisfied`)
 		}
 	}
+
+	if expired {
+		return ErrTokenExpired
+	}
+	return nil
+}
+
+// verifyConsistency checks that neither nbf nor iat is after exp
+func (t *Token) verifyConsistency() error {
+	exp := t.expiration
+	if exp == nil {
+		return nil
+	}
+	if nbf := t.notBefore; nbf != nil && nbf.Time.After(exp.Time) {
+		return ErrInconsistentClaims
+	}
+	if iat := t.issuedAt; iat != nil && iat.Time.After(exp.Time) {
+		return ErrInconsistentClaims
+	}
 	return nil
 }
+
+// verifyAudienceGroups checks that the aud claim matches at least one
+// of the groups
+func (t *Token) verifyAudienceGroups(groups [][]string, intersect bool) error {
+	present := make(map[string]struct{}, len(t.audience))
+	for _, v := range t.audience {
+		present[v] = struct{}{}
+	}
+
+	reasons := make([]string, len(groups))
+	for i, group := range groups {
+		if len(group) == 0 {
+			reasons[i] = `[]: empty group`
+			continue
+		}
+
+		var missing []string
+		for _, v := range group {
+			if _, ok := present[v]; !ok {
+				missing = append(missing, v)
+			}
+		}
+
+		switch {
+		case intersect && len(missing) < len(group):
+			return nil
+		case intersect:
+			reasons[i] = fmt.Sprintf(`%q: no common values`, group)
+		case len(missing) == 0:
+			return nil
+		default:
+			reasons[i] = fmt.Sprintf(`%q: missing %q`, group, missing)
+		}
+	}
+	return errors.New(`aud not satisfied: no audience group matched (` + strings.Join(reasons, `; `) + `)`)
+}
@@ -31,12 +31,18 @@ func ExampleJWT() {
 	}
 
 	fmt.Printf("%s\n", buf)
-	fmt.Printf("aud -> '%s'\n", t.Audience())
-	fmt.Printf("iat -> '%s'\n", t.IssuedAt().Format(time.RFC3339))
+	if v, ok := t.Audience(); ok {
+		fmt.Printf("aud -> '%s'\n", v)
+	}
+	if v, ok := t.IssuedAt(); ok {
+		fmt.Printf("iat -> '%s'\n", v.Format(time.RFC3339))
+	}
 	if v, ok := t.Get(`privateClaimKey`); ok {
 		fmt.Printf("privateClaimKey -> '%s'\n", v)
 	}
-	fmt.Printf("sub -> '%s'\n", t.Subject())
+	if v, ok := t.Subject(); ok {
+		fmt.Printf("sub -> '%s'\n", v)
+	}
 }
 
 func ExampleJWK() {
@@ -0,0 +1,61 @@
+package jwx_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/lestrrat-go/jwx"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsEncryptedIsSigned(t *testing.T) {
+	payload := []byte("Lorem ipsum")
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, "RSA key generated") {
+		return
+	}
+
+	signed, err := jws.Sign(payload, jwa.RS256, key)
+	if !assert.NoError(t, err, "jws.Sign should succeed") {
+		return
+	}
+
+	encrypted, err := jwe.Encrypt(payload, jwa.RSA_OAEP, &key.PublicKey, jwa.A128GCM, jwa.NoCompress)
+	if !assert.NoError(t, err, "jwe.Encrypt should succeed") {
+		return
+	}
+
+	encryptedJSON, err := jwe.ConvertCompactToJSON(encrypted)
+	if !assert.NoError(t, err, "jwe.ConvertCompactToJSON should succeed") {
+		return
+	}
+
+	testcases := []struct {
+		Name      string
+		Token     []byte
+		Encrypted bool
+		Signed    bool
+	}{
+		{Name: "JWS compact", Token: signed, Signed: true},
+		{Name: "JWS JSON", Token: []byte(`{"payload":"eyJ9","signatures":[{"protected":"eyJ9","signature":"AAAA"}]}`), Signed: true},
+		{Name: "JWS flattened JSON", Token: []byte(`{"payload":"eyJ9","protected":"eyJ9","signature":"AAAA"}`), Signed: true},
+		{Name: "JWE compact", Token: encrypted, Encrypted: true},
+		{Name: "JWE JSON", Token: encryptedJSON, Encrypted: true},
+		{Name: "Empty", Token: []byte("  ")},
+		{Name: "Garbage", Token: []byte("foo")},
+		{Name: "Invalid JSON", Token: []byte("{foo")},
+	}
+
+	for _, tc := range testcases {
+		if !assert.Equal(t, tc.Encrypted, jwx.IsEncrypted(tc.Token), "IsEncrypted ("+tc.Name+")") {
+			return
+		}
+		if !assert.Equal(t, tc.Signed, jwx.IsSigned(tc.Token), "IsSigned ("+tc.Name+")") {
+			return
+		}
+	}
+}